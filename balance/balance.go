@@ -28,6 +28,21 @@ const (
 // Class 负载均衡分类
 type Class int
 
+// String 负载均衡分类名称
+func (c Class) String() string {
+	switch c {
+	case Round:
+		return "round"
+	case Random:
+		return "random"
+	case Hash:
+		return "hash"
+	case Smooth:
+		return "smooth"
+	}
+	return "unknown"
+}
+
 // Balancer 负载均衡器
 type Balancer interface {
 	// Add 新增负载对象
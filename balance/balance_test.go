@@ -14,7 +14,10 @@
 
 package balance
 
-import "testing"
+import (
+	"sync"
+	"testing"
+)
 
 func TestNewBalanceRound(t *testing.T) {
 	b := NewBalance(Round)
@@ -75,3 +78,67 @@ func TestNewBalanceSmooth(t *testing.T) {
 		t.Log(b.Acquire())
 	}
 }
+
+func TestBalanceWeightRemove(t *testing.T) {
+	for _, class := range []Class{Round, Random, Hash, Smooth} {
+		b := NewBalance(class)
+		b.Add("a")
+		b.Weight("a", 3)
+		b.Add("b")
+		b.Weight("a", 2)
+		counts := map[interface{}]int{}
+		for i := 0; i < 300; i++ {
+			obj, err := b.Acquire()
+			if nil != err {
+				t.Fatal(err)
+			}
+			counts[obj]++
+		}
+		if class == Round || class == Smooth {
+			if counts["a"] != 200 || counts["b"] != 100 {
+				t.Errorf("%s expect a:200 b:100, got %v", class, counts)
+			}
+		} else if counts["a"] == 0 || counts["b"] == 0 {
+			t.Errorf("%s expect both objects acquired, got %v", class, counts)
+		}
+		b.Remove("a")
+		for i := 0; i < 10; i++ {
+			if obj, _ := b.Acquire(); obj != "b" {
+				t.Errorf("%s expect b after remove a, got %v", class, obj)
+			}
+		}
+		b.Remove("b")
+		if _, err := b.Acquire(); nil == err {
+			t.Errorf("%s expect no instance error", class)
+		}
+	}
+}
+
+func TestBalanceConcurrent(t *testing.T) {
+	for _, class := range []Class{Round, Random, Hash, Smooth} {
+		b := NewBalance(class)
+		b.Add("a")
+		b.Add("b")
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					_, _ = b.Acquire()
+				}
+			}()
+			go func(weight int) {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					b.Weight("a", weight+j%3)
+				}
+			}(i + 1)
+		}
+		wg.Wait()
+		b.Remove("a")
+		if obj, _ := b.Acquire(); obj != "b" {
+			t.Errorf("%s expect b after remove a, got %v", class, obj)
+		}
+	}
+}
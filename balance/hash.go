@@ -52,11 +52,13 @@ func (h *hash) Weight(obj interface{}, weight int) {
 func (h *hash) Remove(obj interface{}) {
 	defer h.lock.Unlock()
 	h.lock.Lock()
-	for index, i := range h.interSlice {
-		if i == obj {
-			h.interSlice = append(h.interSlice[:index], h.interSlice[index+1:]...)
+	interSlice := make([]interface{}, 0, len(h.interSlice))
+	for _, i := range h.interSlice {
+		if i != obj {
+			interSlice = append(interSlice, i)
 		}
 	}
+	h.interSlice = interSlice
 }
 
 // Class 获取负载均衡分类
@@ -66,6 +68,8 @@ func (h *hash) Class() Class {
 
 // Acquire 执行负载均衡算法得到期望对象
 func (h *hash) Acquire() (interface{}, error) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
 	lens := len(h.interSlice)
 	if lens == 0 {
 		return nil, errors.New("no instance")
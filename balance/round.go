@@ -65,11 +65,13 @@ func (r *round) Weight(obj interface{}, weight int) {
 func (r *round) Remove(obj interface{}) {
 	defer r.lock.Unlock()
 	r.lock.Lock()
-	for index, i := range r.interSlice {
-		if i == obj {
-			r.interSlice = append(r.interSlice[:index], r.interSlice[index+1:]...)
+	interSlice := make([]interface{}, 0, len(r.interSlice))
+	for _, i := range r.interSlice {
+		if i != obj {
+			interSlice = append(interSlice, i)
 		}
 	}
+	r.interSlice = interSlice
 }
 
 // Class 获取负载均衡分类
@@ -79,6 +81,8 @@ func (r *round) Class() Class {
 
 // Acquire 执行负载均衡算法得到期望对象
 func (r *round) Acquire() (interface{}, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
 	lens := len(r.interSlice)
 	if lens == 0 {
 		return nil, errors.New("no instance")
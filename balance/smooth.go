@@ -15,6 +15,7 @@
 package balance
 
 import (
+	"errors"
 	"sort"
 	"sync"
 )
@@ -54,6 +55,8 @@ func (s *smooth) Add(obj interface{}) {
 
 // Weight 设置负载对象权重
 func (s *smooth) Weight(obj interface{}, weight int) {
+	defer s.lock.Unlock()
+	s.lock.Lock()
 	for _, p := range s.params {
 		if p.obj == obj {
 			differ := weight - p.staticWeight
@@ -87,6 +90,11 @@ func (s *smooth) Class() Class {
 
 // Acquire 执行负载均衡算法得到期望对象
 func (s *smooth) Acquire() (interface{}, error) {
+	defer s.lock.Unlock()
+	s.lock.Lock()
+	if len(s.params) == 0 {
+		return nil, errors.New("no instance")
+	}
 	param := s.params[0]
 	param.dynamicWeight = param.dynamicWeight - s.totalWeight + param.staticWeight
 	sort.Slice(s.params, func(i, j int) bool {
@@ -15,6 +15,7 @@
 package db
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/aberic/gnomon"
@@ -111,6 +112,14 @@ func (s *MySQL) Exec(f func(s *MySQL)) error {
 	return nil
 }
 
+// PingContext 检查数据库连接是否可用，可用于健康检查
+func (s *MySQL) PingContext(ctx context.Context) error {
+	if nil == s.DB {
+		return errors.New("db not connected")
+	}
+	return s.DB.DB().PingContext(ctx)
+}
+
 // ExecSQL 执行自定义 MySQL 语句，该方法是对 func Exec(f func(db *gorm.DB)) error 的实现
 //
 // dest 期望通过该过程赋值的对象
@@ -13,6 +13,7 @@ require (
 	github.com/robfig/cron v1.2.0
 	github.com/tjfoc/gmsm v1.3.1
 	github.com/vmihailenco/msgpack v4.0.4+incompatible
+	golang.org/x/net v0.0.0-20190404232315-eb5bcb51f2a3
 	golang.org/x/sys v0.0.0-20190922100055-0a153f010e69 // indirect
 	google.golang.org/grpc v1.28.0
 	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
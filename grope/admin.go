@@ -0,0 +1,298 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/aberic/gnomon/log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrAdminAuthRequired admin token or cert auth required
+	ErrAdminAuthRequired = errors.New("admin token or cert auth required")
+	// ErrAdminTokenInvalid admin token invalid
+	ErrAdminTokenInvalid = errors.New("admin token invalid")
+)
+
+// Admin 运行时管理策略
+//
+// 管理接口对代理目标及限流的修改仅作用于运行中的服务，使用 Gateway 时配置文件重新加载后以配置文件为准
+type Admin struct {
+	// 管理令牌，通过请求头“Authorization: Bearer <token>”提交
+	Token string
+	// 客户端证书授权策略，与 Token 满足其一即可
+	CertAuth *CertAuth
+	// 获取被管理的服务，如 Gateway.Serve，nil则管理注册管理接口的服务
+	Serve func() *GHttpServe
+	// 认证失败（401）处理方法
+	Unauthorized AuthHandler
+}
+
+// AdminRoute 管理接口中的路由标识
+type AdminRoute struct {
+	Host    string `json:"host"`    // 虚拟主机规则，同 GHttpServe.Host，为空表示服务本身
+	Method  string `json:"method"`  // 请求方法，如“GET”
+	Pattern string `json:"pattern"` // 完整路由，如“/api/users/:id”
+}
+
+// AdminTarget 管理接口中的代理目标，通过 Host 及 Port 识别
+type AdminTarget struct {
+	Host    string `json:"host"`    // 如“localhost”
+	Port    string `json:"port"`    // 如“8080”
+	Pattern string `json:"pattern"` // 目标路径，仅新增时有效
+	Weight  int    `json:"weight"`  // 负载权重，新增时默认1
+	Subset  string `json:"subset"`  // 所属目标子集，仅新增时有效
+}
+
+// AdminTargetRequest 代理目标管理请求
+type AdminTargetRequest struct {
+	Route  AdminRoute  `json:"route"`
+	Target AdminTarget `json:"target"`
+}
+
+// AdminLimit 管理接口中的限流策略，对应 Limit
+type AdminLimit struct {
+	Millisecond         int64 `json:"millisecond"`         // 请求限定的时间段（毫秒）
+	Count               int   `json:"count"`               // 请求限定的时间段内允许的请求次数
+	IntervalMillisecond int64 `json:"intervalMillisecond"` // 请求允许的最小间隔时间（毫秒），0表示不限
+}
+
+// AdminLimitRequest 限流管理请求，Limit 为nil表示移除限流
+type AdminLimitRequest struct {
+	Route AdminRoute  `json:"route"`
+	Limit *AdminLimit `json:"limit"`
+}
+
+// AdminRouter 在 ghs 的 pattern 分组下注册运行时管理接口，Token 及 CertAuth 均未设置时返回 ErrAdminAuthRequired
+//
+//	GET    {pattern}/routes         路由表，params同 GHttpServe.RoutesHandler，host指定虚拟主机
+//	POST   {pattern}/targets        新增代理目标，请求体为 AdminTargetRequest
+//	PUT    {pattern}/targets        设置代理目标权重，同时恢复已排空的目标
+//	DELETE {pattern}/targets        移除代理目标
+//	POST   {pattern}/targets/drain  排空代理目标，不再分配新的请求，进行中的请求数通过路由表查看
+//	PUT    {pattern}/limits         设置或移除限流策略，请求体为 AdminLimitRequest
+//
+// 修改成功返回修改后的路由信息，每次修改及认证失败均通过 log 记录审计日志
+func AdminRouter(ghs *GHttpServe, pattern string, admin *Admin) error {
+	if admin.Token == "" && nil == admin.CertAuth {
+		return ErrAdminAuthRequired
+	}
+	if nil == admin.Serve {
+		admin.Serve = func() *GHttpServe { return ghs }
+	}
+	router := ghs.Group(pattern, admin.filter)
+	router.repo(http.MethodGet, "/routes", nil, admin.routes, nil)
+	router.repo(http.MethodPost, "/targets", nil, admin.addTarget, nil)
+	router.repo(http.MethodPut, "/targets", nil, admin.weightTarget, nil)
+	router.repo(http.MethodDelete, "/targets", nil, admin.removeTarget, nil)
+	router.repo(http.MethodPost, "/targets/drain", nil, admin.drainTarget, nil)
+	router.repo(http.MethodPut, "/limits", nil, admin.setLimit, nil)
+	return nil
+}
+
+func (a *Admin) filter(ctx *Context) {
+	if a.tokenValid(ctx) {
+		return
+	}
+	if nil != a.CertAuth {
+		a.CertAuth.filter(ctx)
+		if ctx.responded {
+			log.Warn("grope admin unauthorized", log.Field("client", ctx.ClientIP()), log.Field("path", ctx.request.URL.Path))
+		}
+		return
+	}
+	log.Warn("grope admin unauthorized", log.Field("client", ctx.ClientIP()), log.Field("path", ctx.request.URL.Path))
+	if nil != a.Unauthorized {
+		a.Unauthorized(ctx, ErrAdminTokenInvalid)
+	}
+	if !ctx.responded {
+		ctx.responseMessage(http.StatusUnauthorized, ErrAdminTokenInvalid.Error())
+	}
+}
+
+// tokenValid 请求是否携带有效的管理令牌
+func (a *Admin) tokenValid(ctx *Context) bool {
+	if a.Token == "" {
+		return false
+	}
+	auth := ctx.HeaderGet("Authorization")
+	if len(auth) <= 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimSpace(auth[7:])), []byte(a.Token)) == 1
+}
+
+// operator 审计日志中的操作者，令牌认证为“token”，证书认证为证书的SPIFFE ID或CommonName
+func (a *Admin) operator(ctx *Context) string {
+	if a.tokenValid(ctx) {
+		return "token"
+	}
+	if identity := ctx.PeerIdentity(); nil != identity {
+		if identity.SPIFFEID != "" {
+			return identity.SPIFFEID
+		}
+		return identity.CommonName
+	}
+	return ""
+}
+
+func (a *Admin) routes(ctx *Context) {
+	serve := a.Serve().hostServe(ctx.Param("host"))
+	if nil == serve {
+		ctx.responseMessage(http.StatusNotFound, fmt.Sprintf("host %q not exist", ctx.Param("host")))
+		return
+	}
+	serve.RoutesHandler()(ctx)
+}
+
+func (a *Admin) addTarget(ctx *Context) {
+	a.updateTarget(ctx, "target.add", func(proxy *Proxy, target *AdminTarget) error {
+		if target.Weight < 1 {
+			target.Weight = 1
+		}
+		return proxy.addTarget(&Target{Host: target.Host, Port: target.Port, Pattern: target.Pattern, Weight: target.Weight, Subset: target.Subset})
+	})
+}
+
+func (a *Admin) weightTarget(ctx *Context) {
+	a.updateTarget(ctx, "target.weight", func(proxy *Proxy, target *AdminTarget) error {
+		if target.Weight < 1 {
+			return errors.New("weight must be greater than 0")
+		}
+		return proxy.weightTarget(target.Host, target.Port, target.Weight)
+	})
+}
+
+func (a *Admin) removeTarget(ctx *Context) {
+	a.updateTarget(ctx, "target.remove", func(proxy *Proxy, target *AdminTarget) error {
+		return proxy.removeTarget(target.Host, target.Port)
+	})
+}
+
+func (a *Admin) drainTarget(ctx *Context) {
+	a.updateTarget(ctx, "target.drain", func(proxy *Proxy, target *AdminTarget) error {
+		return proxy.drainTarget(target.Host, target.Port)
+	})
+}
+
+// updateTarget 解析代理目标管理请求，查找路由代理并执行修改
+func (a *Admin) updateTarget(ctx *Context, action string, update func(proxy *Proxy, target *AdminTarget) error) {
+	req := &AdminTargetRequest{}
+	if err := ctx.ReceiveJSON(req); nil != err {
+		a.fail(ctx, action, http.StatusBadRequest, err)
+		return
+	}
+	nd, status, err := a.route(&req.Route)
+	if nil == err && nil == nd.proxy {
+		status, err = http.StatusBadRequest, fmt.Errorf("route %s %s has no proxy", req.Route.Method, req.Route.Pattern)
+	}
+	if nil == err {
+		if _, e := strconv.Atoi(req.Target.Port); req.Target.Host == "" || nil != e {
+			status, err = http.StatusBadRequest, errors.New("target host and port required")
+		}
+	}
+	if nil == err {
+		if err = update(nd.proxy, &req.Target); nil != err {
+			switch err {
+			case ErrProxyTargetExist:
+				status = http.StatusConflict
+			case ErrProxyTargetNotExist:
+				status = http.StatusNotFound
+			default:
+				status = http.StatusBadRequest
+			}
+		}
+	}
+	if nil != err {
+		a.fail(ctx, action, status, err, log.Field("route", req.Route.String()), log.Field("target", req.Target.String()))
+		return
+	}
+	log.Info("grope admin", log.Field("action", action), log.Field("operator", a.operator(ctx)), log.Field("client", ctx.ClientIP()),
+		log.Field("route", req.Route.String()), log.Field("target", req.Target.String()), log.Field("weight", req.Target.Weight))
+	_ = ctx.ResponseJSON(http.StatusOK, newRoute(nd))
+}
+
+func (a *Admin) setLimit(ctx *Context) {
+	const action = "limit.set"
+	req := &AdminLimitRequest{}
+	if err := ctx.ReceiveJSON(req); nil != err {
+		a.fail(ctx, action, http.StatusBadRequest, err)
+		return
+	}
+	nd, status, err := a.route(&req.Route)
+	if nil != err {
+		a.fail(ctx, action, status, err, log.Field("route", req.Route.String()))
+		return
+	}
+	var limit *Limit
+	if nil != req.Limit {
+		if req.Limit.Millisecond <= 0 || req.Limit.Count <= 0 || req.Limit.IntervalMillisecond < 0 {
+			a.fail(ctx, action, http.StatusBadRequest, errors.New("limit millisecond and count must be greater than 0"),
+				log.Field("route", req.Route.String()))
+			return
+		}
+		limit = &Limit{
+			LimitMillisecond:         req.Limit.Millisecond,
+			LimitCount:               req.Limit.Count,
+			LimitIntervalMillisecond: req.Limit.IntervalMillisecond,
+		}
+	}
+	nd.setLimit(limit)
+	log.Info("grope admin", log.Field("action", action), log.Field("operator", a.operator(ctx)), log.Field("client", ctx.ClientIP()),
+		log.Field("route", req.Route.String()), log.Field("limit", req.Limit))
+	_ = ctx.ResponseJSON(http.StatusOK, newRoute(nd))
+}
+
+// route 查找被管理服务中的路由结点
+func (a *Admin) route(route *AdminRoute) (*node, int, error) {
+	serve := a.Serve().hostServe(route.Host)
+	if nil == serve {
+		return nil, http.StatusNotFound, fmt.Errorf("host %q not exist", route.Host)
+	}
+	method := strings.ToUpper(route.Method)
+	var nodal *node
+	serve.nodal.walk(func(nd *node) {
+		if nd.method == method && nd.pattern == route.Pattern {
+			nodal = nd
+		}
+	})
+	if nil == nodal {
+		return nil, http.StatusNotFound, fmt.Errorf("route %s %s not exist", method, route.Pattern)
+	}
+	return nodal, http.StatusOK, nil
+}
+
+// fail 记录失败的修改并返回错误信息
+func (a *Admin) fail(ctx *Context, action string, status int, err error, fields ...log.FieldInter) {
+	fields = append([]log.FieldInter{log.Field("action", action), log.Field("operator", a.operator(ctx)), log.Field("client", ctx.ClientIP())}, fields...)
+	log.Warn("grope admin failed", append(fields, log.Err(err))...)
+	ctx.responseMessage(status, err.Error())
+}
+
+func (ar *AdminRoute) String() string {
+	if ar.Host == "" {
+		return fmt.Sprintf("%s %s", strings.ToUpper(ar.Method), ar.Pattern)
+	}
+	return fmt.Sprintf("%s %s%s", strings.ToUpper(ar.Method), ar.Host, ar.Pattern)
+}
+
+func (at *AdminTarget) String() string {
+	return fmt.Sprintf("%s:%s", at.Host, at.Port)
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"github.com/aberic/gnomon/balance"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAdminRouter(t *testing.T) {
+	backendA, targetA := newProxyBackend("a")
+	defer backendA.Close()
+	backendB, targetB := newProxyBackend("b")
+	defer backendB.Close()
+
+	gs := NewHTTPServe()
+	gs.Group("/api").repo(http.MethodGet, "/users/:id", nil, nil, &Proxy{Balance: balance.Round, Target: []*Target{targetA}})
+	gs.Group("/local").repo(http.MethodGet, "/hello", nil, func(ctx *Context) { _ = ctx.ResponseText(http.StatusOK, "hello") }, nil)
+	if err := AdminRouter(gs, "/admin", &Admin{}); err != ErrAdminAuthRequired {
+		t.Errorf("expect ErrAdminAuthRequired, got %v", err)
+	}
+	if err := AdminRouter(gs, "/admin", &Admin{Token: "secret"}); nil != err {
+		t.Fatal(err)
+	}
+	route := AdminRoute{Method: "get", Pattern: "/api/users/:id"}
+
+	client := NewTestClient(gs)
+	client.Get("/admin/routes").MustDo(t).AssertStatus(t, http.StatusUnauthorized)
+	client.Get("/admin/routes").Header("Authorization", "Bearer wrong").MustDo(t).AssertStatus(t, http.StatusUnauthorized)
+	client.SetHeader("Authorization", "Bearer secret")
+	if text := client.Get("/admin/routes").MustDo(t).AssertStatus(t, http.StatusOK).Text(); !strings.Contains(text, "/api/users/:id") {
+		t.Errorf("expect routes table, got %s", text)
+	}
+
+	backends := func(n int) map[string]int {
+		counts := map[string]int{}
+		for i := 0; i < n; i++ {
+			counts[client.Get("/api/users/1").MustDo(t).AssertStatus(t, http.StatusOK).Text()[:1]]++
+		}
+		return counts
+	}
+	add := &AdminTargetRequest{Route: route, Target: AdminTarget{Host: targetB.Host, Port: targetB.Port, Weight: 3}}
+	resp := client.Post("/admin/targets").JSON(add).MustDo(t).AssertStatus(t, http.StatusOK)
+	updated := &Route{}
+	if err := resp.DecodeJSON(updated); nil != err || len(updated.Proxy.Targets) != 2 {
+		t.Errorf("expect 2 targets, got %v %v", updated.Proxy, err)
+	}
+	client.Post("/admin/targets").JSON(add).MustDo(t).AssertStatus(t, http.StatusConflict)
+	if counts := backends(8); counts["a"] != 2 || counts["b"] != 6 {
+		t.Errorf("expect a:2 b:6, got %v", counts)
+	}
+
+	weight := &AdminTargetRequest{Route: route, Target: AdminTarget{Host: targetA.Host, Port: targetA.Port, Weight: 3}}
+	client.Put("/admin/targets").JSON(weight).MustDo(t).AssertStatus(t, http.StatusOK)
+	if counts := backends(12); counts["a"] != 6 || counts["b"] != 6 {
+		t.Errorf("expect a:6 b:6, got %v", counts)
+	}
+
+	drain := &AdminTargetRequest{Route: route, Target: AdminTarget{Host: targetB.Host, Port: targetB.Port}}
+	resp = client.Post("/admin/targets/drain").JSON(drain).MustDo(t).AssertStatus(t, http.StatusOK)
+	if !strings.Contains(resp.Text(), "drained active=0") {
+		t.Errorf("expect drained target, got %s", resp.Text())
+	}
+	if counts := backends(4); counts["a"] != 4 {
+		t.Errorf("expect only a after drain, got %v", counts)
+	}
+	client.Delete("/admin/targets").JSON(drain).MustDo(t).AssertStatus(t, http.StatusOK)
+	client.Delete("/admin/targets").JSON(drain).MustDo(t).AssertStatus(t, http.StatusNotFound)
+
+	local := &AdminTargetRequest{Route: AdminRoute{Method: "GET", Pattern: "/local/hello"}, Target: drain.Target}
+	client.Post("/admin/targets").JSON(local).MustDo(t).AssertStatus(t, http.StatusBadRequest)
+	missing := &AdminTargetRequest{Route: AdminRoute{Method: "GET", Pattern: "/missing"}, Target: drain.Target}
+	client.Post("/admin/targets").JSON(missing).MustDo(t).AssertStatus(t, http.StatusNotFound)
+
+	limit := &AdminLimitRequest{Route: AdminRoute{Method: "GET", Pattern: "/local/hello"}, Limit: &AdminLimit{Millisecond: 60000, Count: 1}}
+	client.Put("/admin/limits").JSON(limit).MustDo(t).AssertStatus(t, http.StatusOK)
+	client.Get("/local/hello").MustDo(t).AssertText(t, "hello")
+	client.Get("/local/hello").MustDo(t).AssertText(t, `{"message":"request limit, please retry later"}`)
+	limit.Limit = nil
+	client.Put("/admin/limits").JSON(limit).MustDo(t).AssertStatus(t, http.StatusOK)
+	client.Get("/local/hello").MustDo(t).AssertText(t, "hello")
+	limit.Limit = &AdminLimit{Count: 1}
+	client.Put("/admin/limits").JSON(limit).MustDo(t).AssertStatus(t, http.StatusBadRequest)
+}
@@ -0,0 +1,225 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aberic/gnomon"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrTokenMissing jwt token missing
+	ErrTokenMissing = errors.New("jwt token missing")
+	// ErrTokenIssuer jwt token issuer invalid
+	ErrTokenIssuer = errors.New("jwt token issuer invalid")
+	// ErrTokenAudience jwt token audience invalid
+	ErrTokenAudience = errors.New("jwt token audience invalid")
+	// ErrPermissionDenied permission denied
+	ErrPermissionDenied = errors.New("permission denied")
+)
+
+// AuthHandler 认证或授权失败处理方法，未写入响应时使用默认响应
+//
+// ctx 请求处理上下文结构
+//
+// err 失败原因
+type AuthHandler func(ctx *Context, err error)
+
+// JWTAuth JWT认证策略
+type JWTAuth struct {
+	Key          interface{} // 验签密钥，如HMAC密钥“[]byte”或RSA公钥
+	Algs         []string    // 允许的签名算法，默认“HS256”、“HS384”、“HS512”
+	Header       string      // 携带token的请求头，默认“Authorization”
+	HeaderScheme string      // 请求头中token的前缀，请求头为“Authorization”时默认“Bearer”，其它请求头默认为空
+	Cookie       string      // 携带token的cookie名称，为空则不从cookie获取
+	Query        string      // 携带token的请求参数名称，为空则不从请求参数获取
+	Issuer       string      // 期望的签发者“iss”，为空则不校验
+	Audience     []string    // 期望的接收方“aud”，满足其一即可，为空则不校验
+	ScopeClaim   string      // 权限范围声明名称，默认“scope”，值可以是空格分隔的字符串或数组
+	RoleClaim    string      // 角色声明名称，默认“roles”，值可以是空格分隔的字符串或数组
+	Unauthorized AuthHandler // 认证失败（401）处理方法
+	Forbidden    AuthHandler // 授权失败（403）处理方法
+	once         sync.Once
+}
+
+func (ja *JWTAuth) init() {
+	ja.once.Do(func() {
+		if len(ja.Algs) == 0 {
+			ja.Algs = []string{"HS256", "HS384", "HS512"}
+		}
+		if ja.Header == "" {
+			ja.Header = "Authorization"
+		}
+		if ja.HeaderScheme == "" && strings.EqualFold(ja.Header, "Authorization") {
+			ja.HeaderScheme = "Bearer"
+		}
+		if ja.ScopeClaim == "" {
+			ja.ScopeClaim = "scope"
+		}
+		if ja.RoleClaim == "" {
+			ja.RoleClaim = "roles"
+		}
+	})
+}
+
+// JWTFilter JWT认证过滤器
+//
+// 依次从请求头、cookie及请求参数中获取token，校验签名、“exp”、“nbf”、“iss”及“aud”，
+// 校验通过后声明集合可通过 Context.Claims 获取，否则返回401
+func JWTFilter(auth *JWTAuth) Filter {
+	auth.init()
+	return func(ctx *Context) {
+		token := auth.token(ctx)
+		if token == "" {
+			auth.unauthorized(ctx, ErrTokenMissing)
+			return
+		}
+		claims, err := gnomon.JWTParse(auth.Key, token, auth.Algs...)
+		if nil != err {
+			auth.unauthorized(ctx, err)
+			return
+		}
+		if auth.Issuer != "" && claims["iss"] != auth.Issuer {
+			auth.unauthorized(ctx, ErrTokenIssuer)
+			return
+		}
+		if len(auth.Audience) > 0 && !containsAny(claimStrings(claims["aud"]), auth.Audience) {
+			auth.unauthorized(ctx, ErrTokenAudience)
+			return
+		}
+		ctx.claims = claims
+	}
+}
+
+// RequireScopes 权限范围授权过滤器，需在 JWTFilter 之后执行
+//
+// scopes 要求token同时具备的权限范围，不满足则返回403
+func (ja *JWTAuth) RequireScopes(scopes ...string) Filter {
+	ja.init()
+	return ja.require(ja.ScopeClaim, scopes, true)
+}
+
+// RequireRoles 角色授权过滤器，需在 JWTFilter 之后执行
+//
+// roles 要求token具备其中任一角色，不满足则返回403
+func (ja *JWTAuth) RequireRoles(roles ...string) Filter {
+	ja.init()
+	return ja.require(ja.RoleClaim, roles, false)
+}
+
+func (ja *JWTAuth) require(claim string, expects []string, all bool) Filter {
+	return func(ctx *Context) {
+		if nil == ctx.claims {
+			ja.unauthorized(ctx, ErrTokenMissing)
+			return
+		}
+		owns := claimStrings(ctx.claims[claim])
+		var pass bool
+		if all {
+			pass = containsAll(owns, expects)
+		} else {
+			pass = len(expects) == 0 || containsAny(owns, expects)
+		}
+		if !pass {
+			ja.forbidden(ctx, fmt.Errorf("%w, require %s %v", ErrPermissionDenied, claim, expects))
+		}
+	}
+}
+
+// token 依次从请求头、cookie及请求参数中获取token
+func (ja *JWTAuth) token(ctx *Context) string {
+	if value := ctx.requestHeader(ja.Header); value != "" {
+		if ja.HeaderScheme == "" {
+			return value
+		}
+		if len(value) > len(ja.HeaderScheme) && strings.EqualFold(value[:len(ja.HeaderScheme)], ja.HeaderScheme) &&
+			value[len(ja.HeaderScheme)] == ' ' {
+			return strings.TrimSpace(value[len(ja.HeaderScheme):])
+		}
+	}
+	if ja.Cookie != "" {
+		if value, err := ctx.Cookie(ja.Cookie); nil == err && value != "" {
+			return value
+		}
+	}
+	if ja.Query != "" {
+		if value := ctx.request.URL.Query().Get(ja.Query); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func (ja *JWTAuth) unauthorized(ctx *Context, err error) {
+	ctx.HeaderSet("WWW-Authenticate", `Bearer error="invalid_token"`)
+	if nil != ja.Unauthorized {
+		ja.Unauthorized(ctx, err)
+	}
+	if !ctx.responded {
+		ctx.responseMessage(http.StatusUnauthorized, err.Error())
+	}
+}
+
+func (ja *JWTAuth) forbidden(ctx *Context, err error) {
+	if nil != ja.Forbidden {
+		ja.Forbidden(ctx, err)
+	}
+	if !ctx.responded {
+		ctx.responseMessage(http.StatusForbidden, err.Error())
+	}
+}
+
+// claimStrings 将声明值转为字符串数组，支持空格分隔的字符串及数组
+func claimStrings(claim interface{}) []string {
+	switch value := claim.(type) {
+	case string:
+		return strings.Fields(value)
+	case []string:
+		return value
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func containsAny(owns, expects []string) bool {
+	for _, expect := range expects {
+		for _, own := range owns {
+			if own == expect {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsAll(owns, expects []string) bool {
+	for _, expect := range expects {
+		if !containsAny(owns, []string{expect}) {
+			return false
+		}
+	}
+	return true
+}
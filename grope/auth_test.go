@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"github.com/aberic/gnomon"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestJWTFilter(t *testing.T) {
+	key := []byte("Hello World！This is secret!")
+	auth := &JWTAuth{Key: key, Issuer: "gnomon", Audience: []string{"grope"}, Query: "token"}
+	gs := NewHTTPServe()
+	router := gs.Group("/auth", JWTFilter(auth))
+	router.Get("/read", func(ctx *Context) {
+		_ = ctx.ResponseText(http.StatusOK, ctx.Claim("sub").(string))
+	}, auth.RequireScopes("read"))
+	router.Get("/admin", func(ctx *Context) {
+		_ = ctx.ResponseText(http.StatusOK, "admin")
+	}, auth.RequireRoles("admin"))
+	gs.WaitRoutes()
+
+	build := func(claims map[string]interface{}) string {
+		token, err := gnomon.JWTBuildClaims(gnomon.JWTMethodHS256, key, claims)
+		if nil != err {
+			t.Fatal(err)
+		}
+		return token
+	}
+	valid := build(map[string]interface{}{
+		"sub": "aberic", "iss": "gnomon", "aud": []string{"grope"}, "scope": "read write",
+		"roles": []string{"user"}, "exp": time.Now().Unix() + 60,
+	})
+	cases := []struct {
+		path   string
+		token  string
+		status int
+	}{
+		{"/auth/read", "", http.StatusUnauthorized},
+		{"/auth/read", valid, http.StatusOK},
+		{"/auth/read?token=" + valid, "", http.StatusOK},
+		{"/auth/admin", valid, http.StatusForbidden},
+		{"/auth/read", build(map[string]interface{}{"iss": "other", "aud": "grope"}), http.StatusUnauthorized},
+		{"/auth/read", build(map[string]interface{}{"iss": "gnomon", "aud": "other"}), http.StatusUnauthorized},
+		{"/auth/read", build(map[string]interface{}{"iss": "gnomon", "aud": "grope", "exp": time.Now().Unix() - 60}), http.StatusUnauthorized},
+		{"/auth/read", build(map[string]interface{}{"iss": "gnomon", "aud": "grope", "nbf": time.Now().Unix() + 60}), http.StatusUnauthorized},
+	}
+	for index, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, c.path, nil)
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		rec := httptest.NewRecorder()
+		gs.ServeHTTP(rec, req)
+		if rec.Code != c.status {
+			t.Errorf("case %d expect %d, got %d %s", index, c.status, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestJWTAuth_header(t *testing.T) {
+	key := []byte("Hello World！This is secret!")
+	token, err := gnomon.JWTBuildClaims(gnomon.JWTMethodHS256, key, map[string]interface{}{"sub": "aberic"})
+	if nil != err {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		auth   *JWTAuth
+		header string
+		value  string
+	}{
+		{&JWTAuth{Key: key}, "Authorization", "Bearer " + token},
+		{&JWTAuth{Key: key, Header: "Authorization"}, "Authorization", "Bearer " + token},
+		{&JWTAuth{Key: key, Header: "authorization"}, "Authorization", "bearer " + token},
+		{&JWTAuth{Key: key, Header: "X-Token"}, "X-Token", token},
+		{&JWTAuth{Key: key, Header: "X-Token", HeaderScheme: "Token"}, "X-Token", "Token " + token},
+	}
+	for index, c := range cases {
+		gs := NewHTTPServe()
+		gs.Group("/auth", JWTFilter(c.auth)).Get("/me", func(ctx *Context) {
+			_ = ctx.ResponseText(http.StatusOK, ctx.Claim("sub").(string))
+		})
+		gs.WaitRoutes()
+		req := httptest.NewRequest(http.MethodGet, "/auth/me", nil)
+		req.Header.Set(c.header, c.value)
+		rec := httptest.NewRecorder()
+		gs.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || rec.Body.String() != "aberic" {
+			t.Errorf("case %d expect 200, got %d %s", index, rec.Code, rec.Body.String())
+		}
+	}
+}
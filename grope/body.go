@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+var (
+	// ErrBodyTooLarge request body too large
+	ErrBodyTooLarge = errors.New("request body too large")
+)
+
+// maxBodyReader 限制请求体读取长度，超出后返回 ErrBodyTooLarge 并标记请求
+type maxBodyReader struct {
+	ctx    *Context
+	reader io.ReadCloser
+	remain int64 // 剩余允许读取的长度
+	err    error
+}
+
+func (mr *maxBodyReader) Read(p []byte) (int, error) {
+	if nil != mr.err {
+		return 0, mr.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	// 多读一个字节用于判断是否超出限制
+	if int64(len(p)) > mr.remain+1 {
+		p = p[:mr.remain+1]
+	}
+	n, err := mr.reader.Read(p)
+	if int64(n) <= mr.remain {
+		mr.remain -= int64(n)
+		mr.err = err
+		return n, err
+	}
+	n = int(mr.remain)
+	mr.remain = 0
+	mr.err = ErrBodyTooLarge
+	mr.ctx.bodyTooLarge = true
+	return n, mr.err
+}
+
+func (mr *maxBodyReader) Close() error {
+	return mr.reader.Close()
+}
+
+// limitBody 根据路由或服务配置限制请求体长度
+//
+// 请求头中声明的长度已经超出限制时直接返回413，并返回false
+func (ghs *GHttpServe) limitBody(ctx *Context, nodal *node) bool {
+	size := ghs.maxBodySize
+	if size == 0 && nil != ghs.parent {
+		size = ghs.parent.maxBodySize
+	}
+	if extend := nodal.extension(); nil != extend && extend.MaxBodySize != 0 {
+		size = extend.MaxBodySize
+	}
+	ctx.maxBodySize = size
+	if size <= 0 || nil == ctx.request.Body || ctx.request.Body == http.NoBody {
+		return true
+	}
+	if ctx.request.ContentLength > size {
+		ctx.responseBodyTooLarge()
+		return false
+	}
+	ctx.request.Body = &maxBodyReader{ctx: ctx, reader: ctx.request.Body, remain: size}
+	return true
+}
+
+// responseBodyTooLarge 返回413，并在响应后关闭连接以丢弃未读取的请求体
+func (c *Context) responseBodyTooLarge() {
+	c.HeaderSet("Connection", "close")
+	c.responseMessage(http.StatusRequestEntityTooLarge, ErrBodyTooLarge.Error())
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bodyModel struct {
+	Text string `json:"text"`
+}
+
+func TestMaxBodySize(t *testing.T) {
+	gs := NewHTTPServe()
+	gs.SetMaxBodySize(32)
+	router := gs.Group("/body")
+	router.Post("/json", func(ctx *Context) {
+		model := &bodyModel{}
+		if err := ctx.ReceiveJSON(model); nil != err {
+			return
+		}
+		_ = ctx.ResponseJSON(http.StatusOK, model)
+	})
+	router.Posts("/raw", &Extend{MaxBodySize: 1024}, func(ctx *Context) {
+		data, _ := ctx.GetRawData()
+		_ = ctx.ResponseText(http.StatusOK, string(data))
+	})
+	gs.WaitRoutes()
+
+	body := `{"text":"` + strings.Repeat("a", 64) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/body/json", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	gs.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expect 413 by content length, got %d", rec.Code)
+	}
+
+	// 未声明长度的请求体在读取时触发限制
+	req = httptest.NewRequest(http.MethodPost, "/body/json", ioutil.NopCloser(strings.NewReader(body)))
+	req.Header.Set("Content-Type", "application/json")
+	req.ContentLength = -1
+	rec = httptest.NewRecorder()
+	gs.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expect 413 while reading, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/body/raw", strings.NewReader(body))
+	rec = httptest.NewRecorder()
+	gs.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != body {
+		t.Errorf("route limit should override serve limit, got %d", rec.Code)
+	}
+}
+
+func TestServeOption(t *testing.T) {
+	server, err := (*ServeOption)(nil).server(":8080", NewHTTPServe())
+	if nil != err {
+		t.Fatal(err)
+	}
+	if server.ReadHeaderTimeout != 10*time.Second || server.IdleTimeout != 120*time.Second {
+		t.Errorf("unexpected default timeouts %v %v", server.ReadHeaderTimeout, server.IdleTimeout)
+	}
+	server, _ = (&ServeOption{ReadTimeout: time.Second, WriteTimeout: 2 * time.Second}).server(":8080", NewHTTPServe())
+	if server.ReadTimeout != time.Second || server.WriteTimeout != 2*time.Second {
+		t.Errorf("unexpected timeouts %v %v", server.ReadTimeout, server.WriteTimeout)
+	}
+}
@@ -0,0 +1,409 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"github.com/aberic/gnomon/log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheRevalidateKey 后台重新验证请求的上下文标记，仅由缓存过滤器内部设置
+type cacheRevalidateKey struct{}
+
+// Cache 响应缓存策略
+//
+// 仅缓存GET请求的响应，HEAD请求使用GET请求的缓存；
+// 携带“Authorization”或“Cookie”的请求仅使用及保存响应头“Cache-Control”包含“public”或“s-maxage”的缓存，参见RFC 7234 3.2；
+// 与 CompressFilter 同时使用时应将 CacheFilter 放在其后，使缓存保存未压缩的响应并按每个请求协商压缩
+type Cache struct {
+	Store                CacheStore    // 缓存存储，默认使用64MB的 MemoryCacheStore
+	TTL                  time.Duration // 响应未通过“Cache-Control: max-age”指定有效期时的默认有效期，默认1分钟
+	StaleWhileRevalidate time.Duration // 过期后仍返回旧响应并在后台重新验证的时间，响应头中的“stale-while-revalidate”优先
+	VaryHeaders          []string      // 参与缓存键计算的请求头，如“Accept”、“Accept-Language”
+	StatusCodes          []int         // 允许缓存的响应状态码，默认200
+	MaxEntrySize         int           // 单个响应允许缓存的最大长度（字节），超出则不缓存，默认1MB
+	revalidating         map[string]bool
+	lock                 sync.Mutex
+}
+
+// CacheFilter 响应缓存过滤器
+//
+// 遵循请求及响应的“Cache-Control”，生成ETag并对“If-None-Match”返回304，
+// 缓存命中时响应头“X-Cache”为“HIT”，过期后重新验证期间为“STALE”，未命中为“MISS”
+//
+// cache 响应缓存策略，需要通过 Cache.Purge 清理缓存时应保留该指针
+func CacheFilter(cache *Cache) Filter {
+	if nil == cache.Store {
+		cache.Store = NewMemoryCacheStore(0)
+	}
+	if cache.TTL <= 0 {
+		cache.TTL = time.Minute
+	}
+	if len(cache.StatusCodes) == 0 {
+		cache.StatusCodes = []int{http.StatusOK}
+	}
+	if cache.MaxEntrySize <= 0 {
+		cache.MaxEntrySize = 1 << 20
+	}
+	cache.revalidating = map[string]bool{}
+	return cache.filter
+}
+
+func (ch *Cache) filter(ctx *Context) {
+	if ctx.request.Method != http.MethodGet && ctx.request.Method != http.MethodHead {
+		return
+	}
+	directives := parseCacheControl(ctx.requestHeader("Cache-Control"))
+	if _, noStore := directives["no-store"]; noStore {
+		return
+	}
+	key := ch.key(ctx.request)
+	_, noCache := directives["no-cache"]
+	revalidate := nil != ctx.request.Context().Value(cacheRevalidateKey{})
+	credentialed := ctx.requestHeader("Authorization") != "" || ctx.requestHeader("Cookie") != ""
+	if !noCache && !revalidate && directives["max-age"] != "0" {
+		if entry, err := ch.Store.Get(key); nil == err && (entry.Shared || !credentialed) {
+			if entry.fresh() {
+				ch.serve(ctx, entry, "HIT")
+				return
+			}
+			ch.serve(ctx, entry, "STALE")
+			ch.revalidate(ctx, key)
+			return
+		}
+	}
+	if ctx.request.Method == http.MethodHead {
+		return
+	}
+	cw := &cacheWriter{ResponseWriter: ctx.writer, cache: ch, ctx: ctx, key: key, credentialed: credentialed}
+	ctx.writer = cw
+	ctx.final(cw.close)
+}
+
+// Purge 删除路径匹配的缓存，返回删除的条目数量
+//
+// pattern 路径匹配规则，支持 path.Match 通配符，如“/users/*”，不包含请求params
+func (ch *Cache) Purge(pattern string) (int, error) {
+	keys, err := ch.Store.Keys()
+	if nil != err {
+		return 0, err
+	}
+	count := 0
+	for _, key := range keys {
+		if matched, err := path.Match(pattern, cacheKeyPath(key)); nil != err {
+			return count, err
+		} else if !matched {
+			continue
+		}
+		if err = ch.Store.Delete(key); nil != err {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// key 计算缓存键，格式为“GET example.com/path?a=1&b=2”，设置了 VaryHeaders 时追加“\n请求头:值”
+func (ch *Cache) key(r *http.Request) string {
+	var builder strings.Builder
+	builder.WriteString(http.MethodGet)
+	builder.WriteString(" ")
+	builder.WriteString(strings.ToLower(r.Host))
+	builder.WriteString(r.URL.Path)
+	if query := r.URL.Query(); len(query) > 0 {
+		builder.WriteString("?")
+		builder.WriteString(query.Encode()) // Encode按键排序
+	}
+	for _, header := range ch.VaryHeaders {
+		builder.WriteString("\n")
+		builder.WriteString(http.CanonicalHeaderKey(header))
+		builder.WriteString(":")
+		builder.WriteString(strings.Join(r.Header[http.CanonicalHeaderKey(header)], ","))
+	}
+	return builder.String()
+}
+
+// serve 使用缓存条目响应请求
+func (ch *Cache) serve(ctx *Context, entry *CacheEntry, status string) {
+	ctx.responded = true
+	header := ctx.writer.Header()
+	for key, values := range entry.Header {
+		header[key] = append([]string{}, values...)
+	}
+	header.Set("ETag", entry.ETag)
+	header.Set("Age", strconv.FormatInt((time.Now().UnixNano()-entry.Created)/int64(time.Second), 10))
+	header.Set("X-Cache", status)
+	if etagMatch(ctx.requestHeader("If-None-Match"), entry.ETag) {
+		header.Del("Content-Length")
+		ctx.writer.WriteHeader(http.StatusNotModified)
+		return
+	}
+	header.Set("Content-Length", strconv.Itoa(len(entry.Body)))
+	ctx.writer.WriteHeader(entry.Status)
+	if ctx.request.Method != http.MethodHead {
+		_, _ = ctx.writer.Write(entry.Body)
+	}
+}
+
+// revalidate 在后台重新执行请求以刷新缓存，同一缓存键同时只有一个重新验证请求
+func (ch *Cache) revalidate(ctx *Context, key string) {
+	if nil == ctx.serve {
+		return
+	}
+	ch.lock.Lock()
+	if ch.revalidating[key] {
+		ch.lock.Unlock()
+		return
+	}
+	ch.revalidating[key] = true
+	ch.lock.Unlock()
+	req := ctx.request.Clone(context.WithValue(context.Background(), cacheRevalidateKey{}, true))
+	req.Method = http.MethodGet
+	req.Body = http.NoBody
+	req.Header.Del("If-None-Match")
+	req.Header.Del("If-Modified-Since")
+	go func() {
+		defer func() {
+			if err := recover(); nil != err {
+				log.Error("Cache revalidate", log.Field("key", key), log.Field("error", err))
+			}
+			ch.lock.Lock()
+			delete(ch.revalidating, key)
+			ch.lock.Unlock()
+		}()
+		ctx.serve.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+}
+
+// store 根据响应头计算有效期并保存缓存条目
+//
+// credentialed 请求是否携带“Authorization”或“Cookie”，此时仅保存明确允许共享的响应
+func (ch *Cache) store(key string, status int, header http.Header, body []byte, credentialed bool) {
+	cacheable := false
+	for _, code := range ch.StatusCodes {
+		if code == status {
+			cacheable = true
+			break
+		}
+	}
+	if !cacheable || header.Get("Set-Cookie") != "" || header.Get("Vary") == "*" {
+		return
+	}
+	directives := parseCacheControl(header.Get("Cache-Control"))
+	for _, directive := range []string{"no-store", "no-cache", "private"} {
+		if _, exist := directives[directive]; exist {
+			return
+		}
+	}
+	_, public := directives["public"]
+	_, sharedMaxAge := directives["s-maxage"]
+	shared := public || sharedMaxAge
+	if credentialed && !shared {
+		return
+	}
+	ttl, swr := ch.TTL, ch.StaleWhileRevalidate
+	if age, exist := directives["s-maxage"]; exist {
+		ttl = parseSeconds(age, ttl)
+	} else if age, exist = directives["max-age"]; exist {
+		ttl = parseSeconds(age, ttl)
+	}
+	if value, exist := directives["stale-while-revalidate"]; exist {
+		swr = parseSeconds(value, swr)
+	}
+	if ttl <= 0 {
+		return
+	}
+	entryHeader := http.Header{}
+	for key, values := range header {
+		switch key {
+		case "Age", "X-Cache", "Content-Length", "Connection", "Date":
+			continue
+		}
+		entryHeader[key] = append([]string{}, values...)
+	}
+	now := time.Now()
+	entry := &CacheEntry{
+		Status:  status,
+		Header:  entryHeader,
+		Body:    body,
+		ETag:    header.Get("ETag"),
+		Created: now.UnixNano(),
+		Fresh:   now.Add(ttl).UnixNano(),
+		Stale:   now.Add(ttl + swr).UnixNano(),
+		Shared:  shared,
+	}
+	if err := ch.Store.Set(key, entry); nil != err {
+		log.Error("Cache store", log.Field("key", key), log.Err(err))
+	}
+}
+
+// cacheWriter 缓存响应写入器
+//
+// 缓存完整响应以计算ETag，请求结束时写出；响应超出 Cache.MaxEntrySize 或调用Flush时转为直接写出且不缓存
+type cacheWriter struct {
+	http.ResponseWriter
+	cache        *Cache
+	ctx          *Context
+	key          string
+	buf          bytes.Buffer
+	statusCode   int
+	bypass       bool // 是否已转为直接写出
+	credentialed bool // 请求是否携带“Authorization”或“Cookie”
+}
+
+func (cw *cacheWriter) WriteHeader(statusCode int) {
+	if cw.bypass {
+		cw.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	if cw.statusCode == 0 {
+		cw.statusCode = statusCode
+	}
+}
+
+func (cw *cacheWriter) Write(b []byte) (int, error) {
+	if cw.bypass {
+		return cw.ResponseWriter.Write(b)
+	}
+	if cw.statusCode == 0 {
+		cw.statusCode = http.StatusOK
+	}
+	if cw.buf.Len()+len(b) > cw.cache.MaxEntrySize {
+		if err := cw.pass(); nil != err {
+			return 0, err
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+	return cw.buf.Write(b)
+}
+
+// Flush 流式响应不缓存
+func (cw *cacheWriter) Flush() {
+	if !cw.bypass {
+		if cw.statusCode == 0 {
+			cw.statusCode = http.StatusOK
+		}
+		_ = cw.pass()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// pass 放弃缓存，写出已缓存的响应并转为直接写出
+func (cw *cacheWriter) pass() error {
+	cw.bypass = true
+	cw.ResponseWriter.WriteHeader(cw.statusCode)
+	if cw.buf.Len() == 0 {
+		return nil
+	}
+	_, err := cw.ResponseWriter.Write(cw.buf.Bytes())
+	cw.buf.Reset()
+	return err
+}
+
+// close 请求结束时保存缓存并写出响应
+func (cw *cacheWriter) close() {
+	if cw.bypass || cw.statusCode == 0 {
+		return
+	}
+	// 写入响应头之前需要执行的方法可能设置cookie，如保存会话，需在判断是否缓存之前执行
+	if nil != cw.ctx.resp {
+		cw.ctx.resp.prepare()
+	}
+	header := cw.Header()
+	body := cw.buf.Bytes()
+	if header.Get("ETag") == "" && bodyAllowed(cw.statusCode) {
+		sum := sha1.Sum(body)
+		header.Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	}
+	cw.cache.store(cw.key, cw.statusCode, header, append([]byte{}, body...), cw.credentialed)
+	if nil == cw.ctx.request.Context().Value(cacheRevalidateKey{}) {
+		header.Set("X-Cache", "MISS")
+	}
+	if cw.statusCode == http.StatusOK && etagMatch(cw.ctx.requestHeader("If-None-Match"), header.Get("ETag")) {
+		header.Del("Content-Length")
+		cw.ResponseWriter.WriteHeader(http.StatusNotModified)
+		return
+	}
+	cw.ResponseWriter.WriteHeader(cw.statusCode)
+	_, _ = cw.ResponseWriter.Write(body)
+}
+
+// parseCacheControl 解析“Cache-Control”指令，指令名称转为小写
+func parseCacheControl(cacheControl string) map[string]string {
+	directives := map[string]string{}
+	for _, part := range strings.Split(cacheControl, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value := part, ""
+		if index := strings.Index(part, "="); index >= 0 {
+			name, value = strings.TrimSpace(part[:index]), strings.Trim(strings.TrimSpace(part[index+1:]), `"`)
+		}
+		directives[strings.ToLower(name)] = value
+	}
+	return directives
+}
+
+// parseSeconds 解析秒数，格式非法则返回默认值
+func parseSeconds(value string, def time.Duration) time.Duration {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if nil != err || seconds < 0 {
+		return def
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// etagMatch “If-None-Match”是否包含指定ETag，支持弱校验及“*”
+func etagMatch(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheKeyPath 获取缓存键中的请求路径
+func cacheKeyPath(key string) string {
+	if index := strings.Index(key, "/"); index >= 0 {
+		key = key[index:]
+	}
+	if index := strings.IndexAny(key, "?\n"); index >= 0 {
+		key = key[:index]
+	}
+	if p, err := url.PathUnescape(key); nil == err {
+		return p
+	}
+	return key
+}
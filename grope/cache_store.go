@@ -0,0 +1,271 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrCacheNotExist cache entry not exist
+	ErrCacheNotExist = errors.New("cache entry not exist")
+)
+
+// CacheStore 响应缓存存储
+type CacheStore interface {
+	// Get 获取缓存条目，条目不存在或已超过可用期则返回 ErrCacheNotExist
+	Get(key string) (*CacheEntry, error)
+	// Set 保存缓存条目
+	Set(key string, entry *CacheEntry) error
+	// Delete 删除缓存条目
+	Delete(key string) error
+	// Keys 获取全部缓存条目的键
+	Keys() ([]string, error)
+}
+
+// CacheEntry 响应缓存条目
+type CacheEntry struct {
+	Key     string      `json:"key"`     // 缓存键
+	Status  int         `json:"status"`  // 响应状态码
+	Header  http.Header `json:"header"`  // 响应头
+	Body    []byte      `json:"body"`    // 响应体
+	ETag    string      `json:"etag"`    // 实体标签
+	Created int64       `json:"created"` // 缓存时间（纳秒）
+	Fresh   int64       `json:"fresh"`   // 新鲜期截止时间（纳秒）
+	Stale   int64       `json:"stale"`   // 过期后仍可使用并在后台重新验证的截止时间（纳秒）
+	Shared  bool        `json:"shared"`  // 响应包含“public”或“s-maxage”，可用于携带“Authorization”或“Cookie”的请求
+}
+
+// fresh 缓存条目是否仍在新鲜期
+func (ce *CacheEntry) fresh() bool {
+	return time.Now().UnixNano() <= ce.Fresh
+}
+
+// expired 缓存条目是否已超过可用期，包括过期后重新验证的时间
+func (ce *CacheEntry) expired() bool {
+	return time.Now().UnixNano() > ce.Stale
+}
+
+// size 缓存条目占用的近似字节数
+func (ce *CacheEntry) size() int64 {
+	size := int64(len(ce.Key) + len(ce.Body) + len(ce.ETag))
+	for key, values := range ce.Header {
+		size += int64(len(key))
+		for _, value := range values {
+			size += int64(len(value))
+		}
+	}
+	return size
+}
+
+// MemoryCacheStore 按占用字节数限制容量的内存LRU缓存存储
+type MemoryCacheStore struct {
+	maxSize int64
+	size    int64
+	entries map[string]*list.Element
+	lru     *list.List // 最近使用的条目在前
+	lock    sync.Mutex
+}
+
+// NewMemoryCacheStore 新建内存LRU缓存存储
+//
+// maxSize 缓存允许占用的最大字节数，超出时淘汰最久未使用的条目，0表示默认64MB
+func NewMemoryCacheStore(maxSize int64) *MemoryCacheStore {
+	if maxSize <= 0 {
+		maxSize = 64 << 20
+	}
+	return &MemoryCacheStore{maxSize: maxSize, entries: map[string]*list.Element{}, lru: list.New()}
+}
+
+// Get 获取缓存条目
+func (mcs *MemoryCacheStore) Get(key string) (*CacheEntry, error) {
+	mcs.lock.Lock()
+	defer mcs.lock.Unlock()
+	element, exist := mcs.entries[key]
+	if !exist {
+		return nil, ErrCacheNotExist
+	}
+	entry := element.Value.(*CacheEntry)
+	if entry.expired() {
+		mcs.remove(element)
+		return nil, ErrCacheNotExist
+	}
+	mcs.lru.MoveToFront(element)
+	return entry, nil
+}
+
+// Set 保存缓存条目，单个条目超出最大容量时不保存
+func (mcs *MemoryCacheStore) Set(key string, entry *CacheEntry) error {
+	entry.Key = key
+	size := entry.size()
+	if size > mcs.maxSize {
+		return nil
+	}
+	mcs.lock.Lock()
+	defer mcs.lock.Unlock()
+	if element, exist := mcs.entries[key]; exist {
+		mcs.remove(element)
+	}
+	mcs.entries[key] = mcs.lru.PushFront(entry)
+	mcs.size += size
+	for mcs.size > mcs.maxSize {
+		mcs.remove(mcs.lru.Back())
+	}
+	return nil
+}
+
+// Delete 删除缓存条目
+func (mcs *MemoryCacheStore) Delete(key string) error {
+	mcs.lock.Lock()
+	defer mcs.lock.Unlock()
+	if element, exist := mcs.entries[key]; exist {
+		mcs.remove(element)
+	}
+	return nil
+}
+
+// Keys 获取全部缓存条目的键
+func (mcs *MemoryCacheStore) Keys() ([]string, error) {
+	mcs.lock.Lock()
+	defer mcs.lock.Unlock()
+	keys := make([]string, 0, len(mcs.entries))
+	for key := range mcs.entries {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Size 获取缓存当前占用的近似字节数
+func (mcs *MemoryCacheStore) Size() int64 {
+	mcs.lock.Lock()
+	defer mcs.lock.Unlock()
+	return mcs.size
+}
+
+func (mcs *MemoryCacheStore) remove(element *list.Element) {
+	entry := mcs.lru.Remove(element).(*CacheEntry)
+	delete(mcs.entries, entry.Key)
+	mcs.size -= entry.size()
+}
+
+// FileCacheStore 文件缓存存储，每个缓存条目保存为一个文件，适用于多个进程共享缓存或重启后保留缓存
+type FileCacheStore struct {
+	dir  string
+	lock sync.RWMutex
+}
+
+// NewFileCacheStore 新建文件缓存存储
+//
+// dir 缓存文件存储目录
+func NewFileCacheStore(dir string) (*FileCacheStore, error) {
+	if err := os.MkdirAll(dir, 0700); nil != err {
+		return nil, err
+	}
+	return &FileCacheStore{dir: dir}, nil
+}
+
+// Get 获取缓存条目
+func (fcs *FileCacheStore) Get(key string) (*CacheEntry, error) {
+	fcs.lock.RLock()
+	entry, err := fcs.read(fcs.filePath(key))
+	fcs.lock.RUnlock()
+	if nil != err {
+		return nil, ErrCacheNotExist
+	}
+	if entry.expired() {
+		_ = fcs.Delete(key)
+		return nil, ErrCacheNotExist
+	}
+	return entry, nil
+}
+
+// Set 保存缓存条目
+func (fcs *FileCacheStore) Set(key string, entry *CacheEntry) error {
+	entry.Key = key
+	data, err := json.Marshal(entry)
+	if nil != err {
+		return err
+	}
+	fcs.lock.Lock()
+	defer fcs.lock.Unlock()
+	tmp := fcs.filePath(key) + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0600); nil != err {
+		return err
+	}
+	return os.Rename(tmp, fcs.filePath(key))
+}
+
+// Delete 删除缓存条目
+func (fcs *FileCacheStore) Delete(key string) error {
+	fcs.lock.Lock()
+	defer fcs.lock.Unlock()
+	if err := os.Remove(fcs.filePath(key)); nil != err && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Keys 获取全部缓存条目的键，同时清理已超过可用期的条目
+func (fcs *FileCacheStore) Keys() ([]string, error) {
+	fcs.lock.Lock()
+	defer fcs.lock.Unlock()
+	infos, err := ioutil.ReadDir(fcs.dir)
+	if nil != err {
+		return nil, err
+	}
+	var keys []string
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".cache") {
+			continue
+		}
+		filePath := filepath.Join(fcs.dir, info.Name())
+		entry, err := fcs.read(filePath)
+		if nil != err || entry.expired() {
+			_ = os.Remove(filePath)
+			continue
+		}
+		keys = append(keys, entry.Key)
+	}
+	return keys, nil
+}
+
+func (fcs *FileCacheStore) read(filePath string) (*CacheEntry, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if nil != err {
+		return nil, err
+	}
+	entry := &CacheEntry{}
+	if err = json.Unmarshal(data, entry); nil != err {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// filePath 缓存键的摘要作为文件名，避免键中的特殊字符
+func (fcs *FileCacheStore) filePath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(fcs.dir, hex.EncodeToString(sum[:])+".cache")
+}
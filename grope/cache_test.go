@@ -0,0 +1,175 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheFilter(t *testing.T) {
+	var calls int64
+	cache := &Cache{TTL: 50 * time.Millisecond, StaleWhileRevalidate: time.Minute, VaryHeaders: []string{"Accept-Language"}}
+	gs := NewHTTPServe(CacheFilter(cache))
+	router := gs.Group("/cache")
+	router.Get("/users/:id", func(ctx *Context) {
+		count := atomic.AddInt64(&calls, 1)
+		_ = ctx.ResponseText(http.StatusOK, fmt.Sprintf("%s-%s-%d", ctx.Value("id"), ctx.HeaderGet("Accept-Language"), count))
+	})
+	router.Get("/private", func(ctx *Context) {
+		atomic.AddInt64(&calls, 1)
+		ctx.HeaderSet("Cache-Control", "private")
+		_ = ctx.ResponseText(http.StatusOK, "private")
+	})
+
+	tc := NewTestClient(gs)
+	resp := tc.Get("/cache/users/1").MustDo(t).AssertText(t, "1--1").AssertHeader(t, "X-Cache", "MISS")
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("expect etag")
+	}
+	tc.Get("/cache/users/1").MustDo(t).AssertText(t, "1--1").AssertHeader(t, "X-Cache", "HIT")
+	tc.Get("/cache/users/1").Header("If-None-Match", etag).MustDo(t).AssertStatus(t, http.StatusNotModified)
+	tc.Get("/cache/users/1").Header("Accept-Language", "zh").MustDo(t).AssertText(t, "1-zh-2")
+	tc.Get("/cache/users/1").Header("Cache-Control", "no-cache").MustDo(t).AssertText(t, "1--3")
+	tc.Get("/cache/private").MustDo(t)
+	tc.Get("/cache/private").MustDo(t).AssertHeader(t, "X-Cache", "MISS")
+
+	time.Sleep(60 * time.Millisecond)
+	tc.Get("/cache/users/1").MustDo(t).AssertText(t, "1--3").AssertHeader(t, "X-Cache", "STALE")
+	for i := 0; i < 50 && atomic.LoadInt64(&calls) < 6; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	tc.Get("/cache/users/1").MustDo(t).AssertText(t, "1--6").AssertHeader(t, "X-Cache", "HIT")
+
+	tc.Get("/cache/users/2").MustDo(t)
+	if count, err := cache.Purge("/cache/users/*"); nil != err || count != 3 {
+		t.Errorf("expect purge 3 entries, got %d %v", count, err)
+	}
+	tc.Get("/cache/users/2").MustDo(t).AssertHeader(t, "X-Cache", "MISS")
+}
+
+func TestMemoryCacheStore(t *testing.T) {
+	store := NewMemoryCacheStore(100)
+	entry := func() *CacheEntry {
+		return &CacheEntry{Status: http.StatusOK, Body: []byte(strings.Repeat("a", 40)), Stale: time.Now().Add(time.Minute).UnixNano()}
+	}
+	_ = store.Set("a", entry())
+	_ = store.Set("b", entry())
+	if _, err := store.Get("a"); nil != err {
+		t.Fatal(err)
+	}
+	_ = store.Set("c", entry())
+	if _, err := store.Get("b"); err != ErrCacheNotExist {
+		t.Errorf("expect least recently used entry evicted")
+	}
+	if keys, _ := store.Keys(); len(keys) != 2 || store.Size() > 100 {
+		t.Errorf("unexpected keys %v size %d", keys, store.Size())
+	}
+}
+
+func TestCacheFilterCredentials(t *testing.T) {
+	var calls int64
+	gs := NewHTTPServe(CacheFilter(&Cache{}))
+	router := gs.Group("/cache")
+	router.Get("/me", func(ctx *Context) {
+		atomic.AddInt64(&calls, 1)
+		_ = ctx.ResponseText(http.StatusOK, ctx.HeaderGet("Authorization"))
+	})
+	router.Get("/public", func(ctx *Context) {
+		count := atomic.AddInt64(&calls, 1)
+		ctx.HeaderSet("Cache-Control", "public, max-age=60")
+		_ = ctx.ResponseText(http.StatusOK, fmt.Sprintf("public-%d", count))
+	})
+
+	tc := NewTestClient(gs)
+	// 不同令牌的响应互不可见
+	tc.Get("/cache/me").Header("Authorization", "Bearer alice").MustDo(t).AssertText(t, "Bearer alice").AssertHeader(t, "X-Cache", "MISS")
+	tc.Get("/cache/me").Header("Authorization", "Bearer bob").MustDo(t).AssertText(t, "Bearer bob").AssertHeader(t, "X-Cache", "MISS")
+	tc.Get("/cache/me").Header("Cookie", "GROPESESSID=bob").MustDo(t).AssertText(t, "").AssertHeader(t, "X-Cache", "MISS")
+	// 匿名请求的缓存不用于携带凭证的请求
+	tc.Get("/cache/me").MustDo(t).AssertHeader(t, "X-Cache", "MISS")
+	tc.Get("/cache/me").MustDo(t).AssertHeader(t, "X-Cache", "HIT")
+	tc.Get("/cache/me").Header("Authorization", "Bearer alice").MustDo(t).AssertText(t, "Bearer alice").AssertHeader(t, "X-Cache", "MISS")
+	if atomic.LoadInt64(&calls) != 5 {
+		t.Errorf("expect 5 calls, got %d", calls)
+	}
+
+	// 明确允许共享的响应可以在携带凭证的请求间共用
+	tc.Get("/cache/public").Header("Authorization", "Bearer alice").MustDo(t).AssertText(t, "public-6").AssertHeader(t, "X-Cache", "MISS")
+	tc.Get("/cache/public").Header("Authorization", "Bearer bob").MustDo(t).AssertText(t, "public-6").AssertHeader(t, "X-Cache", "HIT")
+}
+
+func TestCacheFilterSession(t *testing.T) {
+	gs := NewHTTPServe(SessionFilter(&SessionOption{SignKey: []byte("sign")}), CSRFFilter(&CSRF{UseSession: true}), CacheFilter(&Cache{}))
+	router := gs.Group("/cache")
+	router.Get("/hello", func(ctx *Context) {
+		ctx.Session().Set("uid", "alice")
+		_ = ctx.ResponseText(http.StatusOK, "hello alice")
+	})
+	router.Get("/form", func(ctx *Context) {
+		_ = ctx.ResponseText(http.StatusOK, ctx.CSRFToken())
+	})
+
+	tc := NewTestClient(gs)
+	// 创建或修改会话的响应携带会话cookie，不能缓存给其它请求
+	for _, path := range []string{"/cache/hello", "/cache/form"} {
+		tc.ClearCookies()
+		first := tc.Get(path).MustDo(t).AssertHeader(t, "X-Cache", "MISS")
+		if first.Header.Get("Set-Cookie") == "" {
+			t.Errorf("%s expect session cookie", path)
+		}
+		tc.ClearCookies()
+		second := tc.Get(path).MustDo(t).AssertHeader(t, "X-Cache", "MISS")
+		if second.Header.Get("Set-Cookie") == "" {
+			t.Errorf("%s expect new session cookie", path)
+		}
+	}
+}
+
+func TestFileCacheStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grope-cache")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	store, err := NewFileCacheStore(dir)
+	if nil != err {
+		t.Fatal(err)
+	}
+	cache := &Cache{Store: store}
+	gs := NewHTTPServe(CacheFilter(cache))
+	gs.Group("/file").Get("/data", func(ctx *Context) {
+		_ = ctx.ResponseJSON(http.StatusOK, &struct {
+			Time int64 `json:"time"`
+		}{Time: time.Now().UnixNano()})
+	})
+	tc := NewTestClient(gs)
+	body := tc.Get("/file/data").MustDo(t).Text()
+	tc.Get("/file/data").MustDo(t).AssertHeader(t, "X-Cache", "HIT").AssertText(t, body).
+		AssertHeader(t, "Content-Type", "application/json")
+	if keys, _ := store.Keys(); len(keys) != 1 || keys[0] != "GET example.com/file/data" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+	if count, _ := cache.Purge("/file/*"); count != 1 {
+		t.Errorf("expect purge 1 entry, got %d", count)
+	}
+}
@@ -0,0 +1,364 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// EncodingGzip gzip
+	EncodingGzip = "gzip"
+	// EncodingDeflate deflate
+	EncodingDeflate = "deflate"
+)
+
+// defaultMaxDecompressedSize 未限制请求体长度时，解压后请求体允许的最大长度（字节）
+const defaultMaxDecompressedSize = 32 << 20
+
+// defaultExcludedContentTypes 默认不压缩的内容类型前缀，这些类型本身已经经过压缩
+var defaultExcludedContentTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/x-rar-compressed",
+	"application/x-7z-compressed",
+	"application/x-bzip2",
+	"application/x-xz",
+	"application/pdf",
+	"font/woff",
+	"font/woff2",
+}
+
+// Compress 响应压缩策略
+type Compress struct {
+	Level                int      // 压缩级别，取值同 compress/flate，0表示默认级别
+	MinLength            int      // 触发压缩的最小响应长度（字节），0表示默认1024
+	ExcludedContentTypes []string // 不压缩的内容类型前缀，为空则使用默认集合，如图片、视频、压缩包等
+	DecompressRequest    bool     // 是否透明解压“Content-Encoding: gzip/deflate”的请求体
+	gzipPool             sync.Pool
+	flatePool            sync.Pool
+}
+
+// CompressFilter 响应压缩过滤器
+//
+// 根据请求头“Accept-Encoding”协商gzip或deflate，响应长度达到阈值后压缩输出，支持流式响应
+//
+// compress 响应压缩策略，nil则使用默认策略
+func CompressFilter(compress *Compress) Filter {
+	if nil == compress {
+		compress = &Compress{}
+	}
+	if compress.Level == 0 {
+		compress.Level = gzip.DefaultCompression
+	}
+	if compress.MinLength <= 0 {
+		compress.MinLength = 1024
+	}
+	if len(compress.ExcludedContentTypes) == 0 {
+		compress.ExcludedContentTypes = defaultExcludedContentTypes
+	}
+	if _, err := gzip.NewWriterLevel(nil, compress.Level); nil != err {
+		panic(err)
+	}
+	return compress.filter
+}
+
+func (cp *Compress) filter(ctx *Context) {
+	if cp.DecompressRequest {
+		if err := cp.decompressRequest(ctx); nil != err {
+			_ = ctx.ResponseText(http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	ctx.writer.Header().Add("Vary", "Accept-Encoding")
+	if ctx.request.Method == http.MethodHead || ctx.IsWebsocket() {
+		return
+	}
+	encoding := negotiateEncoding(ctx.requestHeader("Accept-Encoding"))
+	if encoding == "" {
+		return
+	}
+	cw := &compressWriter{ResponseWriter: ctx.writer, compress: cp, encoding: encoding}
+	ctx.writer = cw
+	ctx.final(cw.close)
+}
+
+// decompressRequest 透明解压请求体
+//
+// 解压后的请求体同样受 MaxBodySize 限制，未设置时限制为 defaultMaxDecompressedSize，避免高压缩比的请求体耗尽内存
+func (cp *Compress) decompressRequest(ctx *Context) error {
+	var (
+		reader io.ReadCloser
+		err    error
+	)
+	switch strings.ToLower(strings.TrimSpace(ctx.requestHeader("Content-Encoding"))) {
+	default:
+		return nil
+	case EncodingGzip, "x-gzip":
+		if reader, err = gzip.NewReader(ctx.request.Body); nil != err {
+			return err
+		}
+	case EncodingDeflate:
+		reader = flate.NewReader(ctx.request.Body)
+	}
+	body := ctx.request.Body
+	size := ctx.maxBodySize
+	if size <= 0 {
+		size = defaultMaxDecompressedSize
+	}
+	ctx.request.Body = &maxBodyReader{ctx: ctx, reader: reader, remain: size}
+	ctx.request.Header.Del("Content-Encoding")
+	ctx.request.Header.Del("Content-Length")
+	ctx.request.ContentLength = -1
+	ctx.final(func() {
+		_ = reader.Close()
+		_ = body.Close()
+	})
+	return nil
+}
+
+// excluded 内容类型是否不需要压缩
+func (cp *Compress) excluded(contentType string) bool {
+	contentType = strings.ToLower(filterFlags(contentType))
+	for _, excluded := range cp.ExcludedContentTypes {
+		if strings.HasPrefix(contentType, excluded) {
+			return true
+		}
+	}
+	return false
+}
+
+func (cp *Compress) acquire(encoding string, w io.Writer) io.WriteCloser {
+	if encoding == EncodingGzip {
+		if gw, ok := cp.gzipPool.Get().(*gzip.Writer); ok {
+			gw.Reset(w)
+			return gw
+		}
+		gw, _ := gzip.NewWriterLevel(w, cp.Level)
+		return gw
+	}
+	if fw, ok := cp.flatePool.Get().(*flate.Writer); ok {
+		fw.Reset(w)
+		return fw
+	}
+	fw, _ := flate.NewWriter(w, cp.Level)
+	return fw
+}
+
+func (cp *Compress) release(wc io.WriteCloser) {
+	switch w := wc.(type) {
+	case *gzip.Writer:
+		cp.gzipPool.Put(w)
+	case *flate.Writer:
+		cp.flatePool.Put(w)
+	}
+}
+
+// negotiateEncoding 根据“Accept-Encoding”选择压缩方式，优先gzip，无可用方式则返回空
+func negotiateEncoding(acceptEncoding string) string {
+	var (
+		qualities = map[string]float64{}
+		wildcard  = -1.0
+	)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, quality := part, 1.0
+		if index := strings.Index(part, ";"); index >= 0 {
+			name = strings.TrimSpace(part[:index])
+			param := strings.TrimSpace(part[index+1:])
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); nil == err {
+					quality = q
+				}
+			}
+		}
+		name = strings.ToLower(name)
+		if name == "*" {
+			wildcard = quality
+		} else {
+			qualities[name] = quality
+		}
+	}
+	var (
+		encoding string
+		best     float64
+	)
+	for _, name := range []string{EncodingGzip, EncodingDeflate} {
+		quality, exist := qualities[name]
+		if !exist {
+			quality = wildcard
+		}
+		if quality > best {
+			encoding, best = name, quality
+		}
+	}
+	return encoding
+}
+
+// compressWriter 压缩响应写入器
+//
+// 在响应长度达到阈值前缓存数据，达到阈值、调用Flush或请求结束时决定是否压缩
+type compressWriter struct {
+	http.ResponseWriter
+	compress   *Compress
+	encoding   string
+	writer     io.WriteCloser // 压缩流，nil表示未压缩
+	buf        bytes.Buffer   // 决定是否压缩前的缓存
+	statusCode int
+	decided    bool // 是否已经决定压缩与否并写入了响应头
+}
+
+// WriteHeader 缓存状态码，直到决定压缩与否时再写入
+func (cw *compressWriter) WriteHeader(statusCode int) {
+	if cw.decided || cw.statusCode != 0 {
+		return
+	}
+	cw.statusCode = statusCode
+	if !bodyAllowed(statusCode) {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.decided {
+		if cw.statusCode == 0 {
+			cw.statusCode = http.StatusOK
+		}
+		if !cw.compressible() {
+			if err := cw.flushBuffer(false); nil != err {
+				return 0, err
+			}
+		} else {
+			cw.buf.Write(b)
+			if cw.buf.Len() < cw.compress.MinLength {
+				return len(b), nil
+			}
+			if err := cw.flushBuffer(true); nil != err {
+				return 0, err
+			}
+			return len(b), nil
+		}
+	}
+	if nil != cw.writer {
+		return cw.writer.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush 流式响应时立即决定压缩与否并发送已写入的数据
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if cw.statusCode == 0 {
+			cw.statusCode = http.StatusOK
+		}
+		_ = cw.flushBuffer(cw.compressible() && cw.buf.Len() > 0)
+	}
+	if fw, ok := cw.writer.(interface{ Flush() error }); ok {
+		_ = fw.Flush()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// close 请求结束时输出剩余缓存并关闭压缩流
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		if cw.statusCode == 0 && cw.buf.Len() == 0 {
+			return
+		}
+		if cw.statusCode == 0 {
+			cw.statusCode = http.StatusOK
+		}
+		_ = cw.flushBuffer(cw.compressible() && cw.buf.Len() >= cw.compress.MinLength)
+	}
+	if nil != cw.writer {
+		_ = cw.writer.Close()
+		cw.compress.release(cw.writer)
+		cw.writer = nil
+	}
+}
+
+// compressible 根据已设置的响应头判断是否可以压缩
+func (cw *compressWriter) compressible() bool {
+	header := cw.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		return true
+	}
+	return !cw.compress.excluded(contentType)
+}
+
+func (cw *compressWriter) flushBuffer(compress bool) error {
+	if compress {
+		header := cw.Header()
+		if header.Get("Content-Type") == "" {
+			header.Set("Content-Type", http.DetectContentType(cw.buf.Bytes()))
+			if cw.compress.excluded(header.Get("Content-Type")) {
+				compress = false
+			}
+		}
+	}
+	cw.decide(compress)
+	if cw.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if nil != cw.writer {
+		_, err = cw.writer.Write(cw.buf.Bytes())
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf.Bytes())
+	}
+	cw.buf.Reset()
+	return err
+}
+
+// decide 决定压缩与否并写入响应头
+func (cw *compressWriter) decide(compress bool) {
+	cw.decided = true
+	if compress {
+		header := cw.Header()
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+		header.Del("Accept-Ranges")
+		cw.writer = cw.compress.acquire(cw.encoding, cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(cw.statusCode)
+}
+
+// bodyAllowed 状态码是否允许携带响应体
+func bodyAllowed(statusCode int) bool {
+	if statusCode >= 100 && statusCode <= 199 {
+		return false
+	}
+	return statusCode != http.StatusNoContent && statusCode != http.StatusNotModified
+}
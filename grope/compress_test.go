@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type compressModel struct {
+	Text string `json:"text"`
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	cases := map[string]string{
+		"":                           "",
+		"gzip":                       EncodingGzip,
+		"deflate":                    EncodingDeflate,
+		"gzip, deflate, br":          EncodingGzip,
+		"gzip;q=0.5, deflate":        EncodingDeflate,
+		"gzip;q=0, deflate;q=0":      "",
+		"*":                          EncodingGzip,
+		"identity, *;q=0":            "",
+		"br, DEFLATE;q=0.8, *;q=0.1": EncodingDeflate,
+	}
+	for acceptEncoding, expect := range cases {
+		if encoding := negotiateEncoding(acceptEncoding); encoding != expect {
+			t.Errorf("negotiateEncoding(%q) = %q, expect %q", acceptEncoding, encoding, expect)
+		}
+	}
+}
+
+func TestCompressFilter(t *testing.T) {
+	gs := NewHTTPServe(CompressFilter(&Compress{MinLength: 64, DecompressRequest: true}))
+	router := gs.Group("/compress")
+	router.Get("/large", func(ctx *Context) {
+		_ = ctx.ResponseJSON(http.StatusOK, &compressModel{Text: strings.Repeat("gnomon", 100)})
+	})
+	router.Get("/small", func(ctx *Context) {
+		_ = ctx.ResponseJSON(http.StatusOK, &compressModel{Text: "gnomon"})
+	})
+	router.Post("/echo", func(ctx *Context) {
+		model := &compressModel{}
+		if err := ctx.ReceiveJSON(model); nil != err {
+			_ = ctx.ResponseText(http.StatusBadRequest, err.Error())
+			return
+		}
+		_ = ctx.ResponseJSON(http.StatusOK, model)
+	})
+	gs.WaitRoutes()
+
+	req := httptest.NewRequest(http.MethodGet, "/compress/large", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	gs.ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Encoding") != EncodingGzip {
+		t.Fatalf("expect gzip encoding, got %q", rec.Header().Get("Content-Encoding"))
+	}
+	if rec.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("expect Vary header, got %q", rec.Header().Get("Vary"))
+	}
+	reader, err := gzip.NewReader(rec.Body)
+	if nil != err {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(reader)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), strings.Repeat("gnomon", 100)) {
+		t.Errorf("unexpected body %s", data)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/compress/small", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec = httptest.NewRecorder()
+	gs.ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Encoding") != "" {
+		t.Errorf("small response should not be compressed")
+	}
+	if rec.Body.String() != `{"text":"gnomon"}` {
+		t.Errorf("unexpected body %s", rec.Body.String())
+	}
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	_, _ = gw.Write([]byte(`{"text":"upload"}`))
+	_ = gw.Close()
+	req = httptest.NewRequest(http.MethodPost, "/compress/echo", &buf)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", EncodingGzip)
+	rec = httptest.NewRecorder()
+	gs.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"text":"upload"}` {
+		t.Errorf("unexpected echo %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCompressFilterStream(t *testing.T) {
+	gs := NewHTTPServe(CompressFilter(nil))
+	gs.Group("/compress").Get("/stream", func(ctx *Context) {
+		ctx.HeaderSet("Content-Type", "text/event-stream")
+		ctx.Status(http.StatusOK)
+		_ = ctx.response([]byte("data: 1\n\n"))
+		ctx.Flush()
+		_ = ctx.response([]byte("data: 2\n\n"))
+	})
+	gs.WaitRoutes()
+	req := httptest.NewRequest(http.MethodGet, "/compress/stream", nil)
+	req.Header.Set("Accept-Encoding", "deflate")
+	rec := httptest.NewRecorder()
+	gs.ServeHTTP(rec, req)
+	if !rec.Flushed {
+		t.Error("expect flushed response")
+	}
+	if rec.Header().Get("Content-Encoding") != EncodingDeflate {
+		t.Errorf("expect deflate encoding, got %q", rec.Header().Get("Content-Encoding"))
+	}
+}
+
+func TestCompressFilterDecompressLimit(t *testing.T) {
+	gs := NewHTTPServe(CompressFilter(&Compress{DecompressRequest: true}))
+	gs.SetMaxBodySize(64 << 10)
+	gs.Group("/compress").repo(http.MethodPost, "/raw", nil, func(ctx *Context) {
+		data, err := ctx.GetRawData()
+		if nil != err {
+			return
+		}
+		_ = ctx.ResponseText(http.StatusOK, strconv.Itoa(len(data)))
+	}, nil)
+	post := func(size int) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		_, _ = gw.Write(make([]byte, size))
+		_ = gw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/compress/raw", &buf)
+		req.Header.Set("Content-Encoding", EncodingGzip)
+		rec := httptest.NewRecorder()
+		gs.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := post(32 << 10); rec.Code != http.StatusOK || rec.Body.String() != "32768" {
+		t.Errorf("expect 32768 bytes, got %d %s", rec.Code, rec.Body.String())
+	}
+	// 压缩后仅约1KB，解压后超出请求体长度限制
+	if rec := post(1 << 20); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expect 413 for decompressed body, got %d %s", rec.Code, rec.Body.String())
+	}
+}
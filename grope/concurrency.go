@@ -0,0 +1,201 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrConcurrencyLimit concurrency limit, please retry later
+	ErrConcurrencyLimit = errors.New("concurrency limit, please retry later")
+)
+
+const (
+	// ConcurrencyFixed 固定并发限制
+	ConcurrencyFixed = ""
+	// ConcurrencyAIMD 加性增、乘性减，请求耗时超过 TargetLatency 时将并发限制乘以0.9，否则缓慢增加
+	ConcurrencyAIMD = "aimd"
+	// ConcurrencyVegas 参照 TCP Vegas，根据最小耗时与当前耗时估算排队的请求数，排队较少时增加并发限制，较多时减小
+	ConcurrencyVegas = "vegas"
+)
+
+// Concurrency 并发限制策略（舱壁隔离），限制同时处理的请求数，避免单个缓慢的路由占满服务资源
+//
+// 并发已满时请求进入等待队列，等待超时或队列已满时返回503；
+// 同一 Concurrency 可由多个路由的 Extend 共用，实现路由组级别的并发限制
+type Concurrency struct {
+	Max     int           // 最大并发请求数，自适应模式下为并发限制的上限
+	Queue   int           // 等待队列长度，0表示并发已满时直接拒绝
+	Timeout time.Duration // 排队等待超时时间，默认1s
+	// 自适应模式，ConcurrencyFixed、ConcurrencyAIMD 或 ConcurrencyVegas，自适应模式下并发限制从 Max 开始调整
+	Adaptive      string
+	MinLimit      int           // 自适应模式下并发限制的下限，默认1
+	TargetLatency time.Duration // ConcurrencyAIMD 模式下期望的请求耗时，默认100ms
+	lock          sync.Mutex
+	limit         float64         // 当前并发限制
+	inFlight      int             // 处理中的请求数
+	waiters       []chan struct{} // 等待队列，按先后顺序获得名额
+	minLatency    time.Duration   // ConcurrencyVegas 模式下观察到的最小耗时
+	samples       int             // ConcurrencyVegas 模式下最小耗时的采样次数，定期重置以适应后端变化
+	rejected      uint64
+}
+
+// ConcurrencyStats 并发限制统计
+type ConcurrencyStats struct {
+	Limit    int    `json:"limit"`    // 当前并发限制
+	InFlight int    `json:"inFlight"` // 处理中的请求数
+	Waiting  int    `json:"waiting"`  // 排队等待的请求数
+	Rejected uint64 `json:"rejected"` // 被拒绝的请求数，含等待超时
+}
+
+// Stats 并发限制统计
+func (c *Concurrency) Stats() *ConcurrencyStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.init()
+	return &ConcurrencyStats{Limit: int(c.limit), InFlight: c.inFlight, Waiting: len(c.waiters), Rejected: c.rejected}
+}
+
+// String 并发限制描述，如“limit=8/10 inFlight=3 waiting=0/20 rejected=5 aimd”
+func (c *Concurrency) String() string {
+	stats := c.Stats()
+	desc := fmt.Sprintf("limit=%d/%d inFlight=%d waiting=%d/%d rejected=%d", stats.Limit, c.Max, stats.InFlight, stats.Waiting, c.Queue, stats.Rejected)
+	if c.Adaptive != ConcurrencyFixed {
+		desc = fmt.Sprintf("%s %s", desc, c.Adaptive)
+	}
+	return desc
+}
+
+// init 初始化并发限制，调用方需持有锁
+func (c *Concurrency) init() {
+	if c.limit == 0 {
+		c.limit = math.Max(float64(c.Max), 1)
+	}
+}
+
+// acquire 占用一个并发名额，并发已满时排队等待，队列已满、等待超时或请求结束时返回false
+func (c *Concurrency) acquire(ctx context.Context) bool {
+	c.lock.Lock()
+	c.init()
+	if c.inFlight < int(c.limit) {
+		c.inFlight++
+		c.lock.Unlock()
+		return true
+	}
+	if len(c.waiters) >= c.Queue {
+		c.rejected++
+		c.lock.Unlock()
+		return false
+	}
+	waiter := make(chan struct{})
+	c.waiters = append(c.waiters, waiter)
+	c.lock.Unlock()
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-waiter:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for index, w := range c.waiters {
+		if w == waiter {
+			c.waiters = append(c.waiters[:index], c.waiters[index+1:]...)
+			c.rejected++
+			return false
+		}
+	}
+	// 超时的同时已获得名额，归还后唤醒其它等待的请求
+	c.inFlight--
+	c.wake()
+	return false
+}
+
+// release 归还并发名额，自适应模式下根据请求耗时调整并发限制
+func (c *Concurrency) release(latency time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.inFlight--
+	switch c.Adaptive {
+	case ConcurrencyAIMD:
+		c.aimd(latency)
+	case ConcurrencyVegas:
+		c.vegas(latency)
+	}
+	c.wake()
+}
+
+// wake 按先后顺序将空闲名额分配给等待的请求，调用方需持有锁
+func (c *Concurrency) wake() {
+	for c.inFlight < int(c.limit) && len(c.waiters) > 0 {
+		waiter := c.waiters[0]
+		c.waiters = c.waiters[1:]
+		c.inFlight++
+		close(waiter)
+	}
+}
+
+// aimd 请求耗时超过期望时乘性减小并发限制，否则每个并发限制周期增加1
+func (c *Concurrency) aimd(latency time.Duration) {
+	target := c.TargetLatency
+	if target <= 0 {
+		target = 100 * time.Millisecond
+	}
+	if latency > target {
+		c.setLimit(c.limit * 0.9)
+	} else {
+		c.setLimit(c.limit + 1/c.limit)
+	}
+}
+
+// vegas 以最小耗时作为无排队时的耗时，估算排队的请求数 queue = limit * (1 - minLatency/latency)，
+// 排队少于3时增加并发限制，多于6时减小
+func (c *Concurrency) vegas(latency time.Duration) {
+	if latency <= 0 {
+		return
+	}
+	if c.samples++; c.samples > 1000 || c.minLatency == 0 || latency < c.minLatency {
+		if c.samples > 1000 {
+			c.samples = 0
+		}
+		c.minLatency = latency
+	}
+	queue := c.limit * (1 - float64(c.minLatency)/float64(latency))
+	switch {
+	case queue < 3:
+		c.setLimit(c.limit + 1)
+	case queue > 6:
+		c.setLimit(c.limit - 1)
+	}
+}
+
+// setLimit 在[MinLimit, Max]范围内设置并发限制
+func (c *Concurrency) setLimit(limit float64) {
+	min := math.Max(float64(c.MinLimit), 1)
+	c.limit = math.Min(math.Max(limit, min), math.Max(float64(c.Max), min))
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConcurrency(t *testing.T) {
+	release := make(chan struct{})
+	concurrency := &Concurrency{Max: 2, Queue: 1, Timeout: 100 * time.Millisecond}
+	extend := &Extend{Concurrency: concurrency}
+	gs := NewHTTPServe()
+	router := gs.Group("/api")
+	blocking := func(ctx *Context) {
+		<-release
+		_ = ctx.ResponseText(http.StatusOK, "ok")
+	}
+	// 两个路由共用同一并发限制
+	router.repo(http.MethodGet, "/slow", extend, blocking, nil)
+	router.repo(http.MethodGet, "/other", extend, blocking, nil)
+
+	codes := make(chan int, 10)
+	serve := func(path string) {
+		rec := httptest.NewRecorder()
+		gs.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		codes <- rec.Code
+	}
+	waitStats := func(inFlight, waiting int) {
+		for i := 0; i < 100; i++ {
+			if stats := concurrency.Stats(); stats.InFlight == inFlight && stats.Waiting == waiting {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("expect inFlight=%d waiting=%d, got %+v", inFlight, waiting, concurrency.Stats())
+	}
+	go serve("/api/slow")
+	go serve("/api/other")
+	waitStats(2, 0)
+	go serve("/api/slow")
+	waitStats(2, 1)
+
+	// 队列已满时直接拒绝
+	rec := httptest.NewRecorder()
+	gs.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/other", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("expect fast 503, got %d", rec.Code)
+	}
+	// 排队的请求在超时前获得名额
+	release <- struct{}{}
+	if code := <-codes; code != http.StatusOK {
+		t.Errorf("expect 200, got %d", code)
+	}
+	waitStats(2, 0)
+
+	// 排队超时
+	go serve("/api/slow")
+	if code := <-codes; code != http.StatusServiceUnavailable {
+		t.Errorf("expect 503 after queue timeout, got %d", code)
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		<-codes
+	}
+	waitStats(0, 0)
+	if stats := concurrency.Stats(); stats.Rejected != 2 {
+		t.Errorf("expect 2 rejected, got %+v", stats)
+	}
+	if route := gs.Routes()[0]; !strings.HasPrefix(route.Concurrency, "limit=2/2 inFlight=0 waiting=0/1 rejected=2") {
+		t.Errorf("unexpected route concurrency %q", route.Concurrency)
+	}
+}
+
+func TestConcurrency_adaptive(t *testing.T) {
+	aimd := &Concurrency{Max: 10, MinLimit: 2, Adaptive: ConcurrencyAIMD, TargetLatency: 50 * time.Millisecond}
+	for i := 0; i < 30; i++ {
+		aimd.acquire(context.Background())
+		aimd.release(100 * time.Millisecond)
+	}
+	if limit := aimd.Stats().Limit; limit != 2 {
+		t.Errorf("expect aimd limit decreased to min 2, got %d", limit)
+	}
+	for i := 0; i < 100; i++ {
+		aimd.acquire(context.Background())
+		aimd.release(10 * time.Millisecond)
+	}
+	if limit := aimd.Stats().Limit; limit != 10 {
+		t.Errorf("expect aimd limit increased to max 10, got %d", limit)
+	}
+
+	vegas := &Concurrency{Max: 20, Adaptive: ConcurrencyVegas}
+	vegas.acquire(context.Background())
+	vegas.release(10 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		vegas.acquire(context.Background())
+		vegas.release(100 * time.Millisecond)
+	}
+	if limit := vegas.Stats().Limit; limit != 10 {
+		t.Errorf("expect vegas limit decreased to 10, got %d", limit)
+	}
+	for i := 0; i < 5; i++ {
+		vegas.acquire(context.Background())
+		vegas.release(10 * time.Millisecond)
+	}
+	if limit := vegas.Stats().Limit; limit != 15 {
+		t.Errorf("expect vegas limit increased to 15, got %d", limit)
+	}
+}
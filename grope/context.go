@@ -36,6 +36,8 @@ import (
 type Context struct {
 	// writer 原生 net/http 结构
 	writer http.ResponseWriter
+	// resp 记录响应状态的原始 writer，不受过滤器替换 writer 的影响
+	resp *responseWriter
 	// request 原生 net/http 结构
 	request *http.Request
 	// sameSite 原生 net/http 结构, SameSite允许服务器定义cookie属性，使得浏览器不可能将此cookie与跨站点请求一起发送。
@@ -46,6 +48,44 @@ type Context struct {
 	paramMap map[string]string
 	// responded 已经处理过
 	responded bool
+	// bodyTooLarge 请求体超出允许的最大长度
+	bodyTooLarge bool
+	// maxBodySize 请求体允许的最大长度（字节），不大于0表示不限
+	maxBodySize int64
+	// claims 通过 JWTFilter 校验的token声明集合
+	claims map[string]interface{}
+	// session 通过 SessionFilter 加载的请求会话，首次调用 Session 时加载或新建
+	session *Session
+	// sessionOption 请求使用的会话策略，未使用 SessionFilter 则为nil
+	sessionOption *SessionOption
+	// csrfToken 通过 CSRFFilter 生成或加载的原始令牌
+	csrfToken []byte
+	// csrfField 通过 CSRFFilter 提交令牌的表单项
+	csrfField string
+	// templates 页面渲染使用的模板
+	templates *Templates
+	// forwarded 经由可信代理转发的原始请求信息
+	forwarded *gnomon.Forwarded
+	// serve 接收请求的Http服务，用于在后台重新执行请求等
+	serve *GHttpServe
+	// finals 请求处理结束后需要执行的方法集合，按注册顺序逆序执行
+	finals []func()
+}
+
+// final 注册一个请求处理结束后需要执行的方法，如关闭压缩流等
+func (c *Context) final(f func()) {
+	c.finals = append(c.finals, f)
+}
+
+// finish 逆序执行请求处理结束后需要执行的方法
+func (c *Context) finish() {
+	for i := len(c.finals) - 1; i >= 0; i-- {
+		c.finals[i]()
+	}
+	c.finals = nil
+	if nil != c.resp && !c.resp.written() { // 未写入任何响应时由 net/http 补充响应头，在此之前执行
+		c.resp.prepare()
+	}
 }
 
 func (c *Context) requestHeader(key string) string {
@@ -108,9 +148,31 @@ func (c *Context) Cookie(name string) (string, error) {
 	return val, nil
 }
 
-// ClientIP 尝试获取客户端IP
+// ClientIP 获取客户端IP，仅当请求来自可信代理时才使用转发请求头，参见 GHttpServe.SetTrustedProxies
 func (c *Context) ClientIP() string {
-	return gnomon.IPGet(c.request)
+	return c.originalRequest().IP
+}
+
+// Scheme 获取原始请求协议，如“https”，仅当请求来自可信代理时才使用转发请求头
+func (c *Context) Scheme() string {
+	return c.originalRequest().Scheme
+}
+
+// Host 获取原始请求主机，如“example.com”，仅当请求来自可信代理时才使用转发请求头
+func (c *Context) Host() string {
+	return c.originalRequest().Host
+}
+
+// originalRequest 解析经由可信代理转发的原始请求信息
+func (c *Context) originalRequest() *gnomon.Forwarded {
+	if nil == c.forwarded {
+		if nil != c.serve && nil != c.serve.trusted {
+			c.forwarded = c.serve.trusted.Resolve(c.request)
+		} else {
+			c.forwarded = gnomon.IPForwarded(c.request)
+		}
+	}
+	return c.forwarded
 }
 
 func filterFlags(content string) string {
@@ -141,6 +203,22 @@ func (c *Context) Status(code int) {
 	c.writer.WriteHeader(code)
 }
 
+// Flush 将已写入的响应数据立即发送到客户端，用于流式响应
+func (c *Context) Flush() {
+	if flusher, ok := c.writer.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Push HTTP/2服务端推送，在写入响应之前调用，推送的请求将以当前请求的请求头重新执行路由
+//
+// 客户端或连接不支持推送时返回 http.ErrNotSupported，如HTTP/1.1连接或客户端禁用了推送
+//
+// target 推送资源的绝对路径，如“/static/app.js”
+func (c *Context) Push(target string, opts *http.PushOptions) error {
+	return c.resp.Push(target, opts)
+}
+
 // Values 获取URI中自定义的参数集合
 func (c *Context) Values() map[string]string {
 	return c.valueMap
@@ -161,6 +239,16 @@ func (c *Context) Param(key string) string {
 	return c.paramMap[key]
 }
 
+// Claims 获取通过 JWTFilter 校验的token声明集合，未校验则返回nil
+func (c *Context) Claims() map[string]interface{} {
+	return c.claims
+}
+
+// Claim 获取通过 JWTFilter 校验的token声明集合中指定Key的值
+func (c *Context) Claim(key string) interface{} {
+	return c.claims[key]
+}
+
 // ReceiveJSON 接收一个"application/json"请求
 func (c *Context) ReceiveJSON(model interface{}) error {
 	if err := tune.ParseJSON(c.request, model); nil != err {
@@ -211,7 +299,23 @@ func (c *Context) ReceiveMultipartForm() (*tune.MultipartForm, error) {
 	return tune.ParseMultipartForm(c.request)
 }
 
+// ReceiveMultipartFormStream 流式接收一个"multipart/form-data"请求
+//
+// 附件产生的临时文件会在请求处理结束后自动删除
+//
+// option 解析配置，如附件大小限制、落盘阈值及校验和计算方法
+func (c *Context) ReceiveMultipartFormStream(option *tune.MultipartOption) (*tune.MultipartForm, error) {
+	form, err := tune.ParseMultipartFormStream(c.request, option)
+	if nil != err {
+		return nil, err
+	}
+	c.final(func() { _ = form.RemoveAll() })
+	return form, nil
+}
+
 // GetRawData 返回Body中流数据.
+//
+// 请求体超出允许的最大长度时返回 ErrBodyTooLarge
 func (c *Context) GetRawData() ([]byte, error) {
 	return ioutil.ReadAll(c.request.Body)
 }
@@ -240,6 +344,13 @@ func (c *Context) ResponseJSON(statusCode int, model interface{}) error {
 	return c.response(bytes)
 }
 
+// responseMessage 返回一个包含提示信息的"application/json"，如“{"message":"permission denied"}”
+func (c *Context) responseMessage(statusCode int, message string) {
+	_ = c.ResponseJSON(statusCode, &struct {
+		Message string `json:"message"`
+	}{Message: message})
+}
+
 // ResponseXML 返回一个"application/xml"
 //
 // statusCode eg:http.StatusOK
@@ -0,0 +1,226 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"github.com/aberic/gnomon/grope/tune"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const csrfTokenLen = 32 // CSRF token 原始长度（字节）
+
+var (
+	// ErrCSRFToken csrf token invalid
+	ErrCSRFToken = errors.New("csrf token invalid")
+	// ErrCSRFOrigin csrf origin invalid
+	ErrCSRFOrigin = errors.New("csrf origin invalid")
+	// ErrCSRFSession csrf requires session filter
+	ErrCSRFSession = errors.New("csrf requires session filter")
+)
+
+// CSRF 跨站请求伪造防护策略
+//
+// 默认使用双重提交cookie模式，UseSession为true时使用同步令牌模式，令牌保存在请求会话中
+type CSRF struct {
+	UseSession     bool          // 是否将令牌保存在会话中（同步令牌模式），需要在 SessionFilter 之后执行
+	CookieName     string        // 保存令牌的cookie名称，默认“_csrf”，同步令牌模式下为会话中的Key
+	HeaderName     string        // 提交令牌的请求头，默认“X-CSRF-Token”
+	FormField      string        // 提交令牌的表单项，默认“_csrf”，仅支持"application/x-www-form-urlencoded"
+	SafeMethods    []string      // 无需校验的安全请求方法，默认GET、HEAD、OPTIONS、TRACE
+	TrustedOrigins []string      // 除请求本身Host外允许的来源，如“https://admin.example.com”
+	SameSite       http.SameSite // 令牌cookie的SameSite属性，默认 http.SameSiteLaxMode
+	MaxAge         int           // 令牌cookie有效时间（秒），默认43200
+	Path           string        // 令牌cookie路径，默认“/”
+	Domain         string        // 令牌cookie域名
+	Secure         bool          // 令牌cookie是否仅通过https传输
+	HTTPOnly       bool          // 令牌cookie是否禁止脚本读取
+	Forbidden      AuthHandler   // 校验失败（403）处理方法
+}
+
+// CSRFFilter 跨站请求伪造防护过滤器
+//
+// 非安全请求方法需要校验Origin/Referer来源，并通过请求头或表单项提交与cookie或会话中一致的令牌，
+// 令牌可通过 Context.CSRFToken 获取并渲染到页面模板中
+func CSRFFilter(csrf *CSRF) Filter {
+	if csrf.CookieName == "" {
+		csrf.CookieName = "_csrf"
+	}
+	if csrf.HeaderName == "" {
+		csrf.HeaderName = "X-CSRF-Token"
+	}
+	if csrf.FormField == "" {
+		csrf.FormField = "_csrf"
+	}
+	if len(csrf.SafeMethods) == 0 {
+		csrf.SafeMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace}
+	}
+	if csrf.SameSite == 0 {
+		csrf.SameSite = http.SameSiteLaxMode
+	}
+	if csrf.MaxAge == 0 {
+		csrf.MaxAge = 43200
+	}
+	return csrf.filter
+}
+
+func (csrf *CSRF) filter(ctx *Context) {
+	if csrf.UseSession && nil == ctx.sessionOption {
+		ctx.responseMessage(http.StatusInternalServerError, ErrCSRFSession.Error())
+		return
+	}
+	token := csrf.load(ctx)
+	if nil == token {
+		token = make([]byte, csrfTokenLen)
+		if _, err := rand.Read(token); nil != err {
+			panic(err)
+		}
+		csrf.store(ctx, token)
+	}
+	ctx.csrfToken, ctx.csrfField = token, csrf.FormField
+	for _, method := range csrf.SafeMethods {
+		if ctx.request.Method == method {
+			return
+		}
+	}
+	if !csrf.checkOrigin(ctx) {
+		csrf.forbidden(ctx, ErrCSRFOrigin)
+		return
+	}
+	submitted := parseCSRFToken(csrf.submitted(ctx))
+	if nil == submitted || subtle.ConstantTimeCompare(submitted, token) != 1 {
+		csrf.forbidden(ctx, ErrCSRFToken)
+	}
+}
+
+// load 从cookie或会话中获取令牌
+func (csrf *CSRF) load(ctx *Context) []byte {
+	var value string
+	if csrf.UseSession {
+		value, _ = ctx.Session().Get(csrf.CookieName).(string)
+	} else {
+		value, _ = ctx.Cookie(csrf.CookieName)
+	}
+	token, err := base64.RawURLEncoding.DecodeString(value)
+	if nil != err || len(token) != csrfTokenLen {
+		return nil
+	}
+	return token
+}
+
+// store 将令牌保存到cookie或会话中
+func (csrf *CSRF) store(ctx *Context, token []byte) {
+	value := base64.RawURLEncoding.EncodeToString(token)
+	if csrf.UseSession {
+		ctx.Session().Set(csrf.CookieName, value)
+		return
+	}
+	sameSite := ctx.sameSite
+	ctx.SetSameSite(csrf.SameSite)
+	ctx.SetCookie(csrf.CookieName, value, csrf.MaxAge, csrf.Path, csrf.Domain, csrf.Secure, csrf.HTTPOnly)
+	ctx.SetSameSite(sameSite)
+}
+
+// submitted 获取请求头或表单项中提交的令牌
+func (csrf *CSRF) submitted(ctx *Context) string {
+	if value := ctx.requestHeader(csrf.HeaderName); value != "" {
+		return value
+	}
+	if strings.Contains(ctx.requestHeader("Content-Type"), tune.ContentTypePostForm) {
+		return ctx.request.PostFormValue(csrf.FormField)
+	}
+	return ""
+}
+
+// checkOrigin 校验请求来源，优先使用Origin，其次使用Referer，https请求必须携带其一，来源的协议及主机均需与请求一致
+//
+// 请求来自可信代理时使用转发的原始协议及主机，参见 GHttpServe.SetTrustedProxies
+func (csrf *CSRF) checkOrigin(ctx *Context) bool {
+	origin := ctx.requestHeader("Origin")
+	if origin == "" || origin == "null" {
+		referer := ctx.requestHeader("Referer")
+		if referer == "" {
+			return ctx.Scheme() != "https"
+		}
+		origin = referer
+	}
+	u, err := url.Parse(origin)
+	if nil != err || u.Host == "" {
+		return false
+	}
+	source := strings.ToLower(u.Scheme + "://" + u.Host)
+	if source == strings.ToLower(ctx.Scheme()+"://"+ctx.Host()) {
+		return true
+	}
+	for _, trusted := range csrf.TrustedOrigins {
+		if strings.ToLower(strings.TrimSuffix(trusted, "/")) == source {
+			return true
+		}
+	}
+	return false
+}
+
+func (csrf *CSRF) forbidden(ctx *Context, err error) {
+	if nil != csrf.Forbidden {
+		csrf.Forbidden(ctx, err)
+	}
+	if !ctx.responded {
+		ctx.responseMessage(http.StatusForbidden, err.Error())
+	}
+}
+
+// maskCSRFToken 使用随机掩码混淆令牌，使每次渲染的令牌都不相同，防止BREACH攻击
+func maskCSRFToken(token []byte) string {
+	masked := make([]byte, 2*len(token))
+	if _, err := rand.Read(masked[:len(token)]); nil != err {
+		panic(err)
+	}
+	for i, b := range token {
+		masked[len(token)+i] = b ^ masked[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(masked)
+}
+
+// parseCSRFToken 解析提交的令牌，支持 Context.CSRFToken 混淆后的令牌及cookie中的原始令牌，格式非法则返回nil
+func parseCSRFToken(value string) []byte {
+	masked, err := base64.RawURLEncoding.DecodeString(value)
+	if nil != err {
+		return nil
+	}
+	if len(masked) == csrfTokenLen {
+		return masked
+	}
+	if len(masked) != 2*csrfTokenLen {
+		return nil
+	}
+	token := make([]byte, csrfTokenLen)
+	for i := range token {
+		token[i] = masked[csrfTokenLen+i] ^ masked[i]
+	}
+	return token
+}
+
+// CSRFToken 获取用于提交的CSRF令牌，每次调用返回不同的混淆结果，未使用 CSRFFilter 则返回空
+func (c *Context) CSRFToken() string {
+	if nil == c.csrfToken {
+		return ""
+	}
+	return maskCSRFToken(c.csrfToken)
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRFFilter(t *testing.T) {
+	gs := NewHTTPServe(CSRFFilter(&CSRF{TrustedOrigins: []string{"https://admin.example.com"}}))
+	router := gs.Group("/csrf")
+	router.Get("/form", func(ctx *Context) {
+		_ = ctx.ResponseText(http.StatusOK, ctx.CSRFToken())
+	})
+	router.Post("/submit", func(ctx *Context) {
+		_ = ctx.ResponseText(http.StatusOK, "ok")
+	})
+	gs.WaitRoutes()
+
+	rec := httptest.NewRecorder()
+	gs.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/csrf/form", nil))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].SameSite != http.SameSiteLaxMode {
+		t.Fatalf("expect csrf cookie, got %v", cookies)
+	}
+	cookie, token := cookies[0], rec.Body.String()
+
+	submit := func(header map[string]string, form url.Values) int {
+		var req *http.Request
+		if nil != form {
+			req = httptest.NewRequest(http.MethodPost, "/csrf/submit", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			req = httptest.NewRequest(http.MethodPost, "/csrf/submit", nil)
+		}
+		req.AddCookie(cookie)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		gs.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	cases := []struct {
+		header map[string]string
+		form   url.Values
+		status int
+	}{
+		{nil, nil, http.StatusForbidden},
+		{map[string]string{"X-CSRF-Token": token}, nil, http.StatusOK},
+		{map[string]string{"X-CSRF-Token": cookie.Value}, nil, http.StatusOK},
+		{map[string]string{"X-CSRF-Token": "invalid"}, nil, http.StatusForbidden},
+		{nil, url.Values{"_csrf": {token}}, http.StatusOK},
+		{map[string]string{"X-CSRF-Token": token, "Origin": "https://evil.com"}, nil, http.StatusForbidden},
+		{map[string]string{"X-CSRF-Token": token, "Origin": "https://admin.example.com"}, nil, http.StatusOK},
+		{map[string]string{"X-CSRF-Token": token, "Referer": "http://example.com/csrf/form"}, nil, http.StatusOK},
+		{map[string]string{"X-CSRF-Token": token, "Origin": "https://example.com"}, nil, http.StatusForbidden},
+	}
+	for index, c := range cases {
+		if status := submit(c.header, c.form); status != c.status {
+			t.Errorf("case %d expect %d, got %d", index, c.status, status)
+		}
+	}
+}
+
+func TestCSRFFilterSession(t *testing.T) {
+	gs := NewHTTPServe(SessionFilter(&SessionOption{SignKey: []byte("sign")}), CSRFFilter(&CSRF{UseSession: true}))
+	router := gs.Group("/csrf")
+	router.Get("/form", func(ctx *Context) {
+		_ = ctx.ResponseText(http.StatusOK, ctx.CSRFToken())
+	})
+	router.Post("/submit", func(ctx *Context) {
+		_ = ctx.ResponseText(http.StatusOK, "ok")
+	})
+	gs.WaitRoutes()
+
+	token, cookie := sessionDo(gs, "/csrf/form", nil)
+	req := httptest.NewRequest(http.MethodPost, "/csrf/submit", nil)
+	req.AddCookie(cookie)
+	req.Header.Set("X-CSRF-Token", token)
+	rec := httptest.NewRecorder()
+	gs.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expect 200, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCSRFFilterTrustedProxies(t *testing.T) {
+	gs := NewHTTPServe(CSRFFilter(&CSRF{}))
+	gs.Group("/csrf").repo(http.MethodPost, "/submit", nil, func(ctx *Context) {
+		_ = ctx.ResponseText(http.StatusOK, "ok")
+	}, nil)
+	token := strings.Repeat("a", 43)
+	submit := func(header map[string]string) int {
+		req := httptest.NewRequest(http.MethodPost, "/csrf/submit", nil)
+		req.Host = "backend:8080"
+		req.AddCookie(&http.Cookie{Name: "_csrf", Value: token})
+		req.Header.Set("X-CSRF-Token", token)
+		req.Header.Set("X-Forwarded-For", "203.0.113.1")
+		req.Header.Set("X-Forwarded-Proto", "https")
+		req.Header.Set("X-Forwarded-Host", "example.com")
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		gs.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	// 非可信代理的转发请求头不生效
+	if status := submit(map[string]string{"Origin": "https://example.com"}); status != http.StatusForbidden {
+		t.Errorf("expect 403 without trusted proxies, got %d", status)
+	}
+	if err := gs.SetTrustedProxies("192.0.2.1"); nil != err {
+		t.Fatal(err)
+	}
+	if status := submit(map[string]string{"Origin": "https://example.com"}); status != http.StatusOK {
+		t.Errorf("expect forwarded host accepted, got %d", status)
+	}
+	if status := submit(map[string]string{"Origin": "http://example.com"}); status != http.StatusForbidden {
+		t.Errorf("expect http origin rejected for https request, got %d", status)
+	}
+	if status := submit(map[string]string{"Origin": "https://backend:8080"}); status != http.StatusForbidden {
+		t.Errorf("expect backend host rejected, got %d", status)
+	}
+	if status := submit(nil); status != http.StatusForbidden {
+		t.Errorf("expect forwarded https request without origin rejected, got %d", status)
+	}
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"bytes"
+	"expvar"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/pprof"
+	runtimePprof "runtime/pprof"
+)
+
+// DebugRouter 在 ghs 的 pattern 分组下注册性能分析接口，需通过 admin 的令牌或客户端证书认证，
+// Token 及 CertAuth 均未设置时返回 ErrAdminAuthRequired
+//
+//	GET      {pattern}/pprof        性能分析项列表
+//	GET      {pattern}/pprof/:name  同 net/http/pprof，如“heap”、“goroutine?debug=2”、“profile?seconds=10”及“trace”
+//	POST     {pattern}/pprof/symbol 同 net/http/pprof
+//	GET      {pattern}/vars         同 expvar
+func DebugRouter(ghs *GHttpServe, pattern string, admin *Admin) error {
+	if admin.Token == "" && nil == admin.CertAuth {
+		return ErrAdminAuthRequired
+	}
+	router := ghs.Group(pattern, admin.filter)
+	router.repo(http.MethodGet, "/pprof", nil, debugIndex, nil)
+	router.repo(http.MethodGet, "/pprof/:name", nil, debugProfile, nil)
+	router.repo(http.MethodPost, "/pprof/:name", nil, debugProfile, nil)
+	router.repo(http.MethodGet, "/vars", nil, func(ctx *Context) {
+		expvar.Handler().ServeHTTP(ctx.writer, ctx.request)
+	}, nil)
+	return nil
+}
+
+// debugIndex 性能分析项列表，链接相对于“{pattern}/pprof”
+func debugIndex(ctx *Context) {
+	var buf bytes.Buffer
+	buf.WriteString("<html><head><title>pprof</title></head><body>\n<table>\n")
+	for _, profile := range runtimePprof.Profiles() {
+		name := html.EscapeString(profile.Name())
+		_, _ = fmt.Fprintf(&buf, "<tr><td>%d</td><td><a href=\"pprof/%s?debug=1\">%s</a></td></tr>\n", profile.Count(), name, name)
+	}
+	for _, name := range []string{"cmdline", "profile", "trace"} {
+		_, _ = fmt.Fprintf(&buf, "<tr><td></td><td><a href=\"pprof/%s\">%s</a></td></tr>\n", name, name)
+	}
+	buf.WriteString("</table>\n</body></html>")
+	ctx.responded = true
+	ctx.HeaderSet("Content-Type", "text/html; charset=utf-8")
+	_ = ctx.response(buf.Bytes())
+}
+
+// debugProfile 按名称执行 net/http/pprof 中的处理方法
+func debugProfile(ctx *Context) {
+	var handler http.Handler
+	switch name := ctx.Value("name"); name {
+	case "cmdline":
+		handler = http.HandlerFunc(pprof.Cmdline)
+	case "profile":
+		handler = http.HandlerFunc(pprof.Profile)
+	case "symbol":
+		handler = http.HandlerFunc(pprof.Symbol)
+	case "trace":
+		handler = http.HandlerFunc(pprof.Trace)
+	default:
+		if nil == runtimePprof.Lookup(name) {
+			ctx.responseMessage(http.StatusNotFound, fmt.Sprintf("unknown profile %q", name))
+			return
+		}
+		handler = pprof.Handler(name)
+	}
+	ctx.responded = true
+	handler.ServeHTTP(ctx.writer, ctx.request)
+}
@@ -0,0 +1,1166 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/aberic/gnomon"
+	"github.com/aberic/gnomon/balance"
+	"github.com/aberic/gnomon/log"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrGatewayConfigEmpty gateway config empty
+	ErrGatewayConfigEmpty = errors.New("gateway config empty")
+)
+
+// GatewayConfig 网关配置，通常由YAML文件加载，示例：
+//
+//	addr: ":8080"
+//	trustedProxies: ["10.0.0.0/8"]
+//	filters:
+//	  - compress: {minLength: 512}
+//	groups:
+//	  - pattern: /api
+//	    filters:
+//	      - ip: {allow: ["10.0.0.0/8"]}
+//	    routes:
+//	      - method: GET
+//	        pattern: /users/:id
+//	        limit: {millisecond: 1000, count: 100}
+//	        proxy:
+//	          balance: smooth
+//	          targets:
+//	            - {host: 10.0.0.1, port: "8081", pattern: /user/:id, weight: 2}
+//	            - {host: 10.0.0.2, port: "8081", pattern: /user/:id, weight: 1}
+type GatewayConfig struct {
+	Addr           string           `yaml:"addr"`           // 监听地址，默认“:8080”，修改后需要重启
+	ReloadInterval time.Duration    `yaml:"reloadInterval"` // 检查配置文件变化的间隔时间，默认10秒，负数表示不重新加载
+	MaxBodySize    int64            `yaml:"maxBodySize"`    // 请求体允许的最大长度（字节），0表示不限
+	TrustedProxies []string         `yaml:"trustedProxies"` // 可信代理的IP或CIDR网段
+	Server         *GatewayServer   `yaml:"server"`         // HTTP服务配置，修改后需要重启
+	TLS            *GatewayTLS      `yaml:"tls"`            // TLS配置，开启或关闭TLS需要重启
+	Filters        []*GatewayFilter `yaml:"filters"`        // 全局过滤器
+	Groups         []*GatewayGroup  `yaml:"groups"`         // 路由分组
+}
+
+// GatewayServer 网关HTTP服务配置，对应 ServeOption
+type GatewayServer struct {
+	ReadTimeout       time.Duration `yaml:"readTimeout"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout"`
+	WriteTimeout      time.Duration `yaml:"writeTimeout"`
+	IdleTimeout       time.Duration `yaml:"idleTimeout"`
+	MaxHeaderBytes    int           `yaml:"maxHeaderBytes"`
+	HTTP2             *GatewayHTTP2 `yaml:"http2"`
+}
+
+// GatewayHTTP2 网关HTTP/2配置，对应 HTTP2Option
+type GatewayHTTP2 struct {
+	Disable                      bool   `yaml:"disable"`
+	H2C                          bool   `yaml:"h2c"`
+	MaxConcurrentStreams         uint32 `yaml:"maxConcurrentStreams"`
+	MaxReadFrameSize             uint32 `yaml:"maxReadFrameSize"`
+	MaxUploadBufferPerConnection int32  `yaml:"maxUploadBufferPerConnection"`
+	MaxUploadBufferPerStream     int32  `yaml:"maxUploadBufferPerStream"`
+}
+
+// GatewayTLS 网关TLS配置，对应 TLSOption
+type GatewayTLS struct {
+	Certs          []*GatewayCert `yaml:"certs"`          // 服务端证书数组
+	CACerts        []string       `yaml:"caCerts"`        // 用于校验客户端证书的根证书文件数组
+	ClientAuth     string         `yaml:"clientAuth"`     // 客户端证书校验模式：none、request、require，默认none
+	MinVersion     string         `yaml:"minVersion"`     // 允许的最低TLS版本：1.0、1.1、1.2、1.3，默认1.2
+	ReloadInterval time.Duration  `yaml:"reloadInterval"` // 检查证书文件变化的间隔时间，默认10秒，负数表示不重新加载
+}
+
+// GatewayCert 网关服务端证书文件
+type GatewayCert struct {
+	Cert string `yaml:"cert"` // 证书文件
+	Key  string `yaml:"key"`  // 私钥文件
+}
+
+// GatewayGroup 网关路由分组
+type GatewayGroup struct {
+	Host    string           `yaml:"host"`    // 虚拟主机，规则同 GHttpServe.Host，为空表示所有主机
+	Pattern string           `yaml:"pattern"` // 路由根路径，如“/api”
+	Filters []*GatewayFilter `yaml:"filters"` // 分组过滤器
+	Routes  []*GatewayRoute  `yaml:"routes"`  // 路由数组
+	// 分组并发限制，未设置并发限制的路由共享该分组的并发名额
+	Concurrency *GatewayConcurrency `yaml:"concurrency"`
+}
+
+// GatewayRoute 网关路由，Handler 与 Proxy 必须且只能设置其一
+type GatewayRoute struct {
+	Method      string              `yaml:"method"`      // 请求方法，如“GET”
+	Pattern     string              `yaml:"pattern"`     // 路由路径，如“/users/:id”
+	Handler     string              `yaml:"handler"`     // GatewayOption.Handlers 中的处理方法名称
+	MaxBodySize int64               `yaml:"maxBodySize"` // 同 Extend.MaxBodySize
+	Limit       *GatewayLimit       `yaml:"limit"`       // 限流策略
+	Concurrency *GatewayConcurrency `yaml:"concurrency"` // 并发限制，优先于分组并发限制
+	Filters     []*GatewayFilter    `yaml:"filters"`     // 路由过滤器
+	Proxy       *GatewayProxy       `yaml:"proxy"`       // 请求代理
+}
+
+// GatewayLimit 网关限流策略，对应 Limit
+type GatewayLimit struct {
+	Millisecond         int64 `yaml:"millisecond"`         // 请求限定的时间段（毫秒）
+	Count               int   `yaml:"count"`               // 请求限定的时间段内允许的请求次数
+	IntervalMillisecond int64 `yaml:"intervalMillisecond"` // 请求允许的最小间隔时间（毫秒），0表示不限
+}
+
+// GatewayConcurrency 网关并发限制，对应 Concurrency
+type GatewayConcurrency struct {
+	Max           int           `yaml:"max"`           // 最大并发请求数
+	Queue         int           `yaml:"queue"`         // 等待队列长度，0表示并发已满时直接拒绝
+	Timeout       time.Duration `yaml:"timeout"`       // 排队等待超时时间，默认1s
+	Adaptive      string        `yaml:"adaptive"`      // 自适应模式：aimd、vegas，为空表示固定并发限制
+	MinLimit      int           `yaml:"minLimit"`      // 自适应模式下并发限制的下限，默认1
+	TargetLatency time.Duration `yaml:"targetLatency"` // aimd模式下期望的请求耗时，默认100ms
+}
+
+// concurrency 新建并发限制，未配置时返回nil
+func (gc *GatewayConcurrency) concurrency() *Concurrency {
+	if nil == gc {
+		return nil
+	}
+	return &Concurrency{Max: gc.Max, Queue: gc.Queue, Timeout: gc.Timeout, Adaptive: gc.Adaptive,
+		MinLimit: gc.MinLimit, TargetLatency: gc.TargetLatency}
+}
+
+// GatewayProxy 网关请求代理，对应 Proxy
+type GatewayProxy struct {
+	Balance string              `yaml:"balance"` // 负载模型：round、random、hash、smooth，默认round
+	Targets []*GatewayTarget    `yaml:"targets"` // 代理目标数组
+	Rules   []*GatewayProxyRule `yaml:"rules"`   // 分流规则数组，按顺序匹配，未命中时使用默认子集
+	Mirror  *GatewayMirror      `yaml:"mirror"`  // 流量镜像
+	Retry   *GatewayRetry       `yaml:"retry"`   // 重试策略
+	TLS     *GatewayProxyTLS    `yaml:"tls"`     // 代理目标使用HTTPS时的TLS配置
+}
+
+// GatewayTarget 网关代理目标，对应 Target
+type GatewayTarget struct {
+	Host    string `yaml:"host"`    // 如“localhost”
+	Port    string `yaml:"port"`    // 如“8080”
+	Pattern string `yaml:"pattern"` // 目标路径，可引用路由路径中的参数，如“/user/:id”，为空则使用请求路径
+	Weight  int    `yaml:"weight"`  // 负载权重，默认1
+	Subset  string `yaml:"subset"`  // 所属目标子集，为空表示默认子集
+}
+
+// GatewayProxyRule 网关代理分流规则，对应 ProxyRule
+type GatewayProxyRule struct {
+	Name    string   `yaml:"name"`    // 规则名称
+	Header  string   `yaml:"header"`  // 匹配的请求头名称
+	Cookie  string   `yaml:"cookie"`  // 匹配的cookie名称
+	Query   string   `yaml:"query"`   // 匹配的请求参数名称
+	Claim   string   `yaml:"claim"`   // 匹配的JWT声明名称
+	Values  []string `yaml:"values"`  // 期望的值，支持通配符，为空表示存在即匹配
+	Percent float64  `yaml:"percent"` // 按比例分流（0~100）
+	Sticky  string   `yaml:"sticky"`  // 比例分流的粘性依据，如“cookie:uid”
+	Subset  string   `yaml:"subset"`  // 命中后使用的代理目标子集
+}
+
+// GatewayMirror 网关代理流量镜像，对应 ProxyMirror
+type GatewayMirror struct {
+	Target      *GatewayTarget `yaml:"target"`      // 影子目标，weight及subset无效
+	Percent     float64        `yaml:"percent"`     // 采样比例（0~100），0表示镜像全部请求
+	Timeout     time.Duration  `yaml:"timeout"`     // 影子请求超时时间，默认10s
+	MaxBodySize int64          `yaml:"maxBodySize"` // 允许镜像的最大请求体长度（字节），默认1MB
+}
+
+// GatewayRetry 网关代理重试策略，对应 gnomon.HTTPRetry
+type GatewayRetry struct {
+	MaxAttempts       int           `yaml:"maxAttempts"`       // 最大尝试次数，含首次请求
+	Statuses          []int         `yaml:"statuses"`          // 可重试的响应状态码，默认502、503及504
+	Backoff           time.Duration `yaml:"backoff"`           // 首次重试前的退避时间，默认100ms
+	MaxBackoff        time.Duration `yaml:"maxBackoff"`        // 最大退避时间，默认10s
+	Jitter            float64       `yaml:"jitter"`            // 退避时间的随机抖动比例（0~1），默认0.2
+	PerTryTimeout     time.Duration `yaml:"perTryTimeout"`     // 单次尝试的超时时间
+	IdempotencyHeader string        `yaml:"idempotencyHeader"` // 幂等键请求头名称，默认“Idempotency-Key”
+	MaxBodySize       int64         `yaml:"maxBodySize"`       // 允许缓存以重放的最大请求体长度（字节），默认1MB
+}
+
+// GatewayProxyTLS 网关代理目标TLS配置，对应 TLSConfig
+type GatewayProxyTLS struct {
+	CACert             string `yaml:"caCert"`
+	Cert               string `yaml:"cert"`
+	Key                string `yaml:"key"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
+}
+
+// GatewayFilter 网关过滤器，必须且只能设置其中一项
+type GatewayFilter struct {
+	Compress *GatewayCompress `yaml:"compress"` // 响应压缩，对应 CompressFilter
+	Cache    *GatewayCache    `yaml:"cache"`    // 响应缓存，对应 CacheFilter
+	IP       *GatewayIP       `yaml:"ip"`       // IP访问控制，对应 IPFilter
+	JWT      *GatewayJWT      `yaml:"jwt"`      // JWT认证，对应 JWTFilter
+	Cert     *GatewayCertAuth `yaml:"cert"`     // 客户端证书授权，对应 CertFilter
+	Custom   string           `yaml:"custom"`   // GatewayOption.Filters 中的过滤器名称
+}
+
+// GatewayCompress 网关响应压缩策略，对应 Compress
+type GatewayCompress struct {
+	Level                int      `yaml:"level"`
+	MinLength            int      `yaml:"minLength"`
+	ExcludedContentTypes []string `yaml:"excludedContentTypes"`
+	DecompressRequest    bool     `yaml:"decompressRequest"`
+}
+
+// GatewayCache 网关响应缓存策略，对应 Cache
+type GatewayCache struct {
+	TTL                  time.Duration `yaml:"ttl"`
+	StaleWhileRevalidate time.Duration `yaml:"staleWhileRevalidate"`
+	VaryHeaders          []string      `yaml:"varyHeaders"`
+	StatusCodes          []int         `yaml:"statusCodes"`
+	MaxEntrySize         int           `yaml:"maxEntrySize"`
+	MaxSize              int64         `yaml:"maxSize"` // 内存缓存允许占用的最大字节数，默认64MB
+	Dir                  string        `yaml:"dir"`     // 缓存文件目录，不为空时使用 FileCacheStore
+}
+
+// GatewayIP 网关IP访问控制策略，对应 IPAccess
+type GatewayIP struct {
+	Allow          []string      `yaml:"allow"`
+	Deny           []string      `yaml:"deny"`
+	TrustedProxies []string      `yaml:"trustedProxies"`
+	File           string        `yaml:"file"`
+	ReloadInterval time.Duration `yaml:"reloadInterval"`
+}
+
+// GatewayJWT 网关JWT认证策略，对应 JWTAuth，仅支持HMAC签名算法
+type GatewayJWT struct {
+	Key          string   `yaml:"key"`     // HMAC密钥
+	KeyFile      string   `yaml:"keyFile"` // HMAC密钥文件，与 Key 只能设置其一
+	Algs         []string `yaml:"algs"`
+	Header       string   `yaml:"header"`
+	HeaderScheme string   `yaml:"headerScheme"`
+	Cookie       string   `yaml:"cookie"`
+	Query        string   `yaml:"query"`
+	Issuer       string   `yaml:"issuer"`
+	Audience     []string `yaml:"audience"`
+}
+
+// GatewayCertAuth 网关客户端证书授权策略，对应 CertAuth
+type GatewayCertAuth struct {
+	DNSNames        []string `yaml:"dnsNames"`
+	EmailAddresses  []string `yaml:"emailAddresses"`
+	URIs            []string `yaml:"uris"`
+	AllowUnverified bool     `yaml:"allowUnverified"`
+}
+
+// GatewayOption 网关配置中引用的Go实现
+type GatewayOption struct {
+	Handlers map[string]Handler // 路由通过“handler”引用的处理方法
+	Filters  map[string]Filter  // 通过“custom”引用的过滤器
+}
+
+// GatewayConfigError 网关配置校验错误，包含全部不合法的配置项
+type GatewayConfigError struct {
+	Problems []string // 不合法的配置项，如“groups[0].routes[1].method: unsupported method "GETS"”
+}
+
+func (gce *GatewayConfigError) Error() string {
+	return fmt.Sprintf("invalid gateway config: %s", strings.Join(gce.Problems, "; "))
+}
+
+// LoadGatewayConfig 读取并校验网关配置文件
+//
+// option 配置中引用的处理方法及过滤器，nil表示未提供
+func LoadGatewayConfig(filePath string, option *GatewayOption) (*GatewayConfig, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if nil != err {
+		return nil, err
+	}
+	config, err := ParseGatewayConfig(data)
+	if nil != err {
+		return nil, fmt.Errorf("%s: %v", filePath, err)
+	}
+	if err = config.Validate(option); nil != err {
+		return nil, fmt.Errorf("%s: %v", filePath, err)
+	}
+	return config, nil
+}
+
+// ParseGatewayConfig 解析YAML格式的网关配置，未知的配置项视为错误，错误信息包含行号
+func ParseGatewayConfig(data []byte) (*GatewayConfig, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	config := &GatewayConfig{}
+	if err := decoder.Decode(config); nil != err {
+		if err == io.EOF {
+			return nil, ErrGatewayConfigEmpty
+		}
+		return nil, err
+	}
+	return config, nil
+}
+
+// Validate 校验网关配置，返回 *GatewayConfigError 列出全部不合法的配置项
+func (gc *GatewayConfig) Validate(option *GatewayOption) error {
+	cv := &configValidator{option: option, routes: map[string]string{}}
+	if nil == cv.option {
+		cv.option = &GatewayOption{}
+	}
+	if _, err := gnomon.NewTrustedProxies(gc.TrustedProxies...); nil != err {
+		cv.addf("trustedProxies", "%v", err)
+	}
+	if nil != gc.Server && nil != gc.Server.HTTP2 {
+		cv.validateHTTP2("server.http2", gc.Server.HTTP2)
+	}
+	if nil != gc.TLS {
+		cv.validateTLS("tls", gc.TLS)
+	}
+	cv.validateFilters("filters", gc.Filters)
+	for i, group := range gc.Groups {
+		cv.validateGroup(fmt.Sprintf("groups[%d]", i), group)
+	}
+	if len(cv.problems) > 0 {
+		return &GatewayConfigError{Problems: cv.problems}
+	}
+	return nil
+}
+
+// Build 根据网关配置新建Http服务，配置应已通过 Validate 校验
+//
+// 路由同步注册，返回时即可处理请求；未使用 Gateway 时限流及文件监听随进程持续运行
+func (gc *GatewayConfig) Build(option *GatewayOption) (*GHttpServe, error) {
+	state, err := gc.build(option, false)
+	if nil != err {
+		return nil, err
+	}
+	return state.serve, nil
+}
+
+// serveOption 网关HTTP服务配置
+func (gc *GatewayConfig) serveOption() *ServeOption {
+	if nil == gc.Server {
+		return DefaultServeOption()
+	}
+	option := &ServeOption{
+		ReadTimeout:       gc.Server.ReadTimeout,
+		ReadHeaderTimeout: gc.Server.ReadHeaderTimeout,
+		WriteTimeout:      gc.Server.WriteTimeout,
+		IdleTimeout:       gc.Server.IdleTimeout,
+		MaxHeaderBytes:    gc.Server.MaxHeaderBytes,
+	}
+	if h2 := gc.Server.HTTP2; nil != h2 {
+		option.HTTP2 = &HTTP2Option{
+			Disable:                      h2.Disable,
+			H2C:                          h2.H2C,
+			MaxConcurrentStreams:         h2.MaxConcurrentStreams,
+			MaxReadFrameSize:             h2.MaxReadFrameSize,
+			MaxUploadBufferPerConnection: h2.MaxUploadBufferPerConnection,
+			MaxUploadBufferPerStream:     h2.MaxUploadBufferPerStream,
+		}
+	}
+	return option
+}
+
+// addr 网关监听地址
+func (gc *GatewayConfig) addr() string {
+	if gc.Addr == "" {
+		return ":8080"
+	}
+	return gc.Addr
+}
+
+// build 新建网关运行状态，withTLS 为 true 时同时加载TLS证书
+func (gc *GatewayConfig) build(option *GatewayOption, withTLS bool) (*gatewayState, error) {
+	if nil == option {
+		option = &GatewayOption{}
+	}
+	var (
+		state = &gatewayState{config: gc}
+		err   error
+	)
+	// 构建失败时释放已创建的资源，返回值为nil，因此使用局部变量 state
+	defer func() {
+		if nil != err {
+			state.close()
+		}
+	}()
+	filters, err := state.buildFilters(option, gc.Filters)
+	if nil != err {
+		return nil, err
+	}
+	state.serve = NewHTTPServe(filters...)
+	state.serve.SetMaxBodySize(gc.MaxBodySize)
+	if len(gc.TrustedProxies) > 0 {
+		if err = state.serve.SetTrustedProxies(gc.TrustedProxies...); nil != err {
+			return nil, err
+		}
+	}
+	hosts := map[string]*GHttpServe{"": state.serve}
+	for _, group := range gc.Groups {
+		serve, exist := hosts[group.Host]
+		if !exist {
+			serve = state.serve.Host(group.Host)
+			hosts[group.Host] = serve
+		}
+		if filters, err = state.buildFilters(option, group.Filters); nil != err {
+			return nil, err
+		}
+		router := serve.Group(group.Pattern, filters...)
+		concurrency := group.Concurrency.concurrency()
+		for _, route := range group.Routes {
+			if err = state.buildRoute(option, router, route, concurrency); nil != err {
+				return nil, err
+			}
+		}
+	}
+	if withTLS && nil != gc.TLS {
+		if state.tls, err = NewServerTLS(gc.TLS.option()); nil != err {
+			return nil, err
+		}
+	}
+	return state, nil
+}
+
+// option 转换为 TLSOption
+func (gt *GatewayTLS) option() *TLSOption {
+	option := &TLSOption{CACertFilePaths: gt.CACerts, ReloadInterval: gt.ReloadInterval}
+	for _, cert := range gt.Certs {
+		option.Certs = append(option.Certs, &TLSCert{CertFilePath: cert.Cert, KeyFilePath: cert.Key})
+	}
+	option.ClientAuth, _ = parseClientAuth(gt.ClientAuth)
+	option.MinVersion, _ = parseTLSVersion(gt.MinVersion)
+	return option
+}
+
+// gatewayState 网关某一版本配置的运行状态，配置重新加载后整体替换
+type gatewayState struct {
+	config  *GatewayConfig
+	serve   *GHttpServe
+	tls     *ServerTLS
+	closers []func() // 替换后需要释放的资源，如文件监听
+}
+
+// close 释放运行状态中的资源，包括通过管理接口设置的限流
+func (gs *gatewayState) close() {
+	if nil != gs.serve {
+		gs.serve.closeLimits()
+	}
+	for _, closer := range gs.closers {
+		closer()
+	}
+	if nil != gs.tls {
+		gs.tls.Close()
+	}
+}
+
+// buildRoute 同步注册路由，路由未配置并发限制时使用分组的并发限制 concurrency
+func (gs *gatewayState) buildRoute(option *GatewayOption, router *GHttpRouter, route *GatewayRoute, concurrency *Concurrency) error {
+	filters, err := gs.buildFilters(option, route.Filters)
+	if nil != err {
+		return err
+	}
+	extend := &Extend{MaxBodySize: route.MaxBodySize, Concurrency: concurrency}
+	if nil != route.Concurrency {
+		extend.Concurrency = route.Concurrency.concurrency()
+	}
+	if nil != route.Limit {
+		limit := &Limit{
+			LimitMillisecond:         route.Limit.Millisecond,
+			LimitCount:               route.Limit.Count,
+			LimitIntervalMillisecond: route.Limit.IntervalMillisecond,
+		}
+		extend.Limit = limit
+	}
+	var proxy *Proxy
+	if nil != route.Proxy {
+		class, _ := parseBalance(route.Proxy.Balance)
+		proxy = &Proxy{Balance: class}
+		if nil != route.Proxy.TLS {
+			proxy.Transport = &Transport{
+				Timeout:               30 * time.Second,
+				KeepAlive:             30 * time.Second,
+				MaxIdleConns:          100,
+				IdleConnTimeout:       90 * time.Second,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ExpectContinueTimeout: 1 * time.Second,
+				MaxIdleConnsPerHost:   100,
+				TLSConfig: &TLSConfig{
+					CACrtFilePath:      route.Proxy.TLS.CACert,
+					CertFilePath:       route.Proxy.TLS.Cert,
+					KeyFilePath:        route.Proxy.TLS.Key,
+					InsecureSkipVerify: route.Proxy.TLS.InsecureSkipVerify,
+				},
+			}
+		}
+		for _, target := range route.Proxy.Targets {
+			proxy.Target = append(proxy.Target, &Target{Host: target.Host, Port: target.Port, Pattern: target.Pattern, Weight: target.Weight, Subset: target.Subset})
+		}
+		for _, rule := range route.Proxy.Rules {
+			proxy.Rules = append(proxy.Rules, &ProxyRule{Name: rule.Name, Header: rule.Header, Cookie: rule.Cookie, Query: rule.Query,
+				Claim: rule.Claim, Values: rule.Values, Percent: rule.Percent, Sticky: rule.Sticky, Subset: rule.Subset})
+		}
+		if retry := route.Proxy.Retry; nil != retry {
+			proxy.Retry = &gnomon.HTTPRetry{MaxAttempts: retry.MaxAttempts, Statuses: retry.Statuses, Backoff: retry.Backoff,
+				MaxBackoff: retry.MaxBackoff, Jitter: retry.Jitter, PerTryTimeout: retry.PerTryTimeout,
+				IdempotencyHeader: retry.IdempotencyHeader, MaxBodySize: retry.MaxBodySize}
+		}
+		if mirror := route.Proxy.Mirror; nil != mirror {
+			proxy.Mirror = &ProxyMirror{Target: &Target{Host: mirror.Target.Host, Port: mirror.Target.Port, Pattern: mirror.Target.Pattern},
+				Percent: mirror.Percent, Timeout: mirror.Timeout, MaxBodySize: mirror.MaxBodySize}
+		}
+	}
+	router.repo(strings.ToUpper(route.Method), route.Pattern, extend, option.Handlers[route.Handler], proxy, filters...)
+	return nil
+}
+
+// buildFilters 按配置顺序新建过滤器
+func (gs *gatewayState) buildFilters(option *GatewayOption, configs []*GatewayFilter) ([]Filter, error) {
+	var filters []Filter
+	for _, config := range configs {
+		filter, err := gs.buildFilter(option, config)
+		if nil != err {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+func (gs *gatewayState) buildFilter(option *GatewayOption, config *GatewayFilter) (Filter, error) {
+	switch {
+	case nil != config.Compress:
+		return CompressFilter(&Compress{
+			Level:                config.Compress.Level,
+			MinLength:            config.Compress.MinLength,
+			ExcludedContentTypes: config.Compress.ExcludedContentTypes,
+			DecompressRequest:    config.Compress.DecompressRequest,
+		}), nil
+	case nil != config.Cache:
+		cache := &Cache{
+			TTL:                  config.Cache.TTL,
+			StaleWhileRevalidate: config.Cache.StaleWhileRevalidate,
+			VaryHeaders:          config.Cache.VaryHeaders,
+			StatusCodes:          config.Cache.StatusCodes,
+			MaxEntrySize:         config.Cache.MaxEntrySize,
+		}
+		if config.Cache.Dir != "" {
+			store, err := NewFileCacheStore(config.Cache.Dir)
+			if nil != err {
+				return nil, err
+			}
+			cache.Store = store
+		} else {
+			cache.Store = NewMemoryCacheStore(config.Cache.MaxSize)
+		}
+		return CacheFilter(cache), nil
+	case nil != config.IP:
+		access := &IPAccess{
+			Allow:          config.IP.Allow,
+			Deny:           config.IP.Deny,
+			TrustedProxies: config.IP.TrustedProxies,
+			File:           config.IP.File,
+			ReloadInterval: config.IP.ReloadInterval,
+		}
+		filter, err := IPFilter(access)
+		if nil != err {
+			return nil, err
+		}
+		gs.closers = append(gs.closers, access.Close)
+		return filter, nil
+	case nil != config.JWT:
+		key := []byte(config.JWT.Key)
+		if config.JWT.KeyFile != "" {
+			data, err := ioutil.ReadFile(config.JWT.KeyFile)
+			if nil != err {
+				return nil, err
+			}
+			key = bytes.TrimSpace(data)
+		}
+		return JWTFilter(&JWTAuth{
+			Key:          key,
+			Algs:         config.JWT.Algs,
+			Header:       config.JWT.Header,
+			HeaderScheme: config.JWT.HeaderScheme,
+			Cookie:       config.JWT.Cookie,
+			Query:        config.JWT.Query,
+			Issuer:       config.JWT.Issuer,
+			Audience:     config.JWT.Audience,
+		}), nil
+	case nil != config.Cert:
+		return CertFilter(&CertAuth{
+			DNSNames:        config.Cert.DNSNames,
+			EmailAddresses:  config.Cert.EmailAddresses,
+			URIs:            config.Cert.URIs,
+			AllowUnverified: config.Cert.AllowUnverified,
+		}), nil
+	default:
+		return option.Filters[config.Custom], nil
+	}
+}
+
+// configValidator 网关配置校验，记录全部不合法的配置项
+type configValidator struct {
+	option   *GatewayOption
+	routes   map[string]string // 已注册路由与其配置路径的映射，用于检查重复路由
+	problems []string
+}
+
+func (cv *configValidator) addf(path, format string, args ...interface{}) {
+	cv.problems = append(cv.problems, fmt.Sprintf("%s: %s", path, fmt.Sprintf(format, args...)))
+}
+
+// requireFile 文件必须存在
+func (cv *configValidator) requireFile(path, filePath string) {
+	if filePath == "" {
+		cv.addf(path, "required")
+	} else if _, err := os.Stat(filePath); nil != err {
+		cv.addf(path, "%v", err)
+	}
+}
+
+func (cv *configValidator) validateTLS(path string, gt *GatewayTLS) {
+	if len(gt.Certs) == 0 {
+		cv.addf(path+".certs", "at least one cert is required")
+	}
+	for i, cert := range gt.Certs {
+		cv.requireFile(fmt.Sprintf("%s.certs[%d].cert", path, i), cert.Cert)
+		cv.requireFile(fmt.Sprintf("%s.certs[%d].key", path, i), cert.Key)
+	}
+	for i, caCert := range gt.CACerts {
+		cv.requireFile(fmt.Sprintf("%s.caCerts[%d]", path, i), caCert)
+	}
+	if _, err := parseClientAuth(gt.ClientAuth); nil != err {
+		cv.addf(path+".clientAuth", "%v", err)
+	}
+	if _, err := parseTLSVersion(gt.MinVersion); nil != err {
+		cv.addf(path+".minVersion", "%v", err)
+	}
+}
+
+func (cv *configValidator) validateHTTP2(path string, gh *GatewayHTTP2) {
+	if gh.MaxReadFrameSize != 0 && (gh.MaxReadFrameSize < 1<<14 || gh.MaxReadFrameSize > 1<<24-1) {
+		cv.addf(path+".maxReadFrameSize", "must be between 16384 and 16777215")
+	}
+	if gh.MaxUploadBufferPerConnection < 0 {
+		cv.addf(path+".maxUploadBufferPerConnection", "must not be negative")
+	}
+	if gh.MaxUploadBufferPerStream < 0 {
+		cv.addf(path+".maxUploadBufferPerStream", "must not be negative")
+	}
+}
+
+func (cv *configValidator) validateGroup(path string, group *GatewayGroup) {
+	if err := validateGatewayPattern(group.Pattern); nil != err {
+		cv.addf(path+".pattern", "%v", err)
+	}
+	cv.validateFilters(path+".filters", group.Filters)
+	cv.validateConcurrency(path+".concurrency", group.Concurrency)
+	if len(group.Routes) == 0 {
+		cv.addf(path+".routes", "at least one route is required")
+	}
+	for i, route := range group.Routes {
+		cv.validateRoute(fmt.Sprintf("%s.routes[%d]", path, i), group, route)
+	}
+}
+
+func (cv *configValidator) validateRoute(path string, group *GatewayGroup, route *GatewayRoute) {
+	method := strings.ToUpper(route.Method)
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+	case "":
+		cv.addf(path+".method", "required")
+	default:
+		cv.addf(path+".method", "unsupported method %q", route.Method)
+	}
+	if err := validateGatewayPattern(route.Pattern); nil != err {
+		cv.addf(path+".pattern", "%v", err)
+	} else {
+		key := fmt.Sprintf("%s %s %s%s", strings.ToLower(group.Host), method, group.Pattern, route.Pattern)
+		if exist, ok := cv.routes[key]; ok {
+			cv.addf(path, "duplicate route %s %s%s, already defined at %s", method, group.Pattern, route.Pattern, exist)
+		} else {
+			cv.routes[key] = path
+		}
+	}
+	switch {
+	case route.Handler != "" && nil != route.Proxy:
+		cv.addf(path, "handler and proxy are mutually exclusive")
+	case route.Handler != "":
+		if _, exist := cv.option.Handlers[route.Handler]; !exist {
+			cv.addf(path+".handler", "handler %q is not registered", route.Handler)
+		}
+	case nil != route.Proxy:
+		cv.validateProxy(path+".proxy", group.Pattern+route.Pattern, route.Proxy)
+	default:
+		cv.addf(path, "either handler or proxy is required")
+	}
+	if nil != route.Limit {
+		if route.Limit.Millisecond <= 0 {
+			cv.addf(path+".limit.millisecond", "must be greater than 0")
+		}
+		if route.Limit.Count <= 0 {
+			cv.addf(path+".limit.count", "must be greater than 0")
+		}
+		if route.Limit.IntervalMillisecond < 0 {
+			cv.addf(path+".limit.intervalMillisecond", "must not be negative")
+		}
+	}
+	cv.validateConcurrency(path+".concurrency", route.Concurrency)
+	cv.validateFilters(path+".filters", route.Filters)
+}
+
+func (cv *configValidator) validateConcurrency(path string, concurrency *GatewayConcurrency) {
+	if nil == concurrency {
+		return
+	}
+	if concurrency.Max <= 0 {
+		cv.addf(path+".max", "must be greater than 0")
+	}
+	if concurrency.Queue < 0 {
+		cv.addf(path+".queue", "must not be negative")
+	}
+	if concurrency.Timeout < 0 {
+		cv.addf(path+".timeout", "must not be negative")
+	}
+	switch concurrency.Adaptive {
+	case ConcurrencyFixed, ConcurrencyAIMD, ConcurrencyVegas:
+	default:
+		cv.addf(path+".adaptive", "unsupported adaptive %q", concurrency.Adaptive)
+	}
+	if concurrency.MinLimit < 0 || concurrency.MinLimit > concurrency.Max {
+		cv.addf(path+".minLimit", "must be between 0 and max")
+	}
+	if concurrency.TargetLatency < 0 {
+		cv.addf(path+".targetLatency", "must not be negative")
+	}
+}
+
+func (cv *configValidator) validateProxy(path, pattern string, proxy *GatewayProxy) {
+	if _, err := parseBalance(proxy.Balance); nil != err {
+		cv.addf(path+".balance", "%v", err)
+	}
+	if len(proxy.Targets) == 0 {
+		cv.addf(path+".targets", "at least one target is required")
+	}
+	subsets := map[string]bool{}
+	for _, target := range proxy.Targets {
+		subsets[target.Subset] = true
+	}
+	if len(proxy.Targets) > 0 && !subsets[""] {
+		cv.addf(path+".targets", "at least one target of default subset is required")
+	}
+	for i, rule := range proxy.Rules {
+		cv.validateProxyRule(fmt.Sprintf("%s.rules[%d]", path, i), rule, subsets)
+	}
+	params := map[string]bool{}
+	for _, piece := range strings.Split(pattern, "/") {
+		if strings.HasPrefix(piece, ":") {
+			params[piece[1:]] = true
+		}
+	}
+	for i, target := range proxy.Targets {
+		cv.validateTarget(fmt.Sprintf("%s.targets[%d]", path, i), pattern, params, target)
+	}
+	if mirror := proxy.Mirror; nil != mirror {
+		if nil == mirror.Target {
+			cv.addf(path+".mirror.target", "required")
+		} else {
+			cv.validateTarget(path+".mirror.target", pattern, params, mirror.Target)
+		}
+		if mirror.Percent < 0 || mirror.Percent > 100 {
+			cv.addf(path+".mirror.percent", "must be between 0 and 100")
+		}
+		if mirror.Timeout < 0 {
+			cv.addf(path+".mirror.timeout", "must not be negative")
+		}
+		if mirror.MaxBodySize < 0 {
+			cv.addf(path+".mirror.maxBodySize", "must not be negative")
+		}
+	}
+	if retry := proxy.Retry; nil != retry {
+		if retry.MaxAttempts < 1 {
+			cv.addf(path+".retry.maxAttempts", "must be greater than 0")
+		}
+		for i, status := range retry.Statuses {
+			if status < 100 || status > 599 {
+				cv.addf(fmt.Sprintf("%s.retry.statuses[%d]", path, i), "invalid status %d", status)
+			}
+		}
+		if retry.Backoff < 0 {
+			cv.addf(path+".retry.backoff", "must not be negative")
+		}
+		if retry.MaxBackoff < 0 {
+			cv.addf(path+".retry.maxBackoff", "must not be negative")
+		}
+		if retry.PerTryTimeout < 0 {
+			cv.addf(path+".retry.perTryTimeout", "must not be negative")
+		}
+		if retry.Jitter > 1 {
+			cv.addf(path+".retry.jitter", "must not be greater than 1")
+		}
+		if retry.MaxBodySize < 0 {
+			cv.addf(path+".retry.maxBodySize", "must not be negative")
+		}
+	}
+	if nil != proxy.TLS {
+		if proxy.TLS.CACert != "" {
+			cv.requireFile(path+".tls.caCert", proxy.TLS.CACert)
+		}
+		if proxy.TLS.Cert != "" || proxy.TLS.Key != "" {
+			cv.requireFile(path+".tls.cert", proxy.TLS.Cert)
+			cv.requireFile(path+".tls.key", proxy.TLS.Key)
+		}
+	}
+}
+
+func (cv *configValidator) validateTarget(path, pattern string, params map[string]bool, target *GatewayTarget) {
+	if target.Host == "" {
+		cv.addf(path+".host", "required")
+	}
+	if port, err := strconv.Atoi(target.Port); nil != err || port <= 0 || port > 65535 {
+		cv.addf(path+".port", "invalid port %q", target.Port)
+	}
+	if target.Weight < 0 {
+		cv.addf(path+".weight", "must not be negative")
+	}
+	if target.Pattern == "" {
+		return
+	}
+	if !strings.HasPrefix(target.Pattern, "/") {
+		cv.addf(path+".pattern", "must begin with '/'")
+	}
+	for _, piece := range strings.Split(target.Pattern, "/") {
+		if strings.HasPrefix(piece, ":") && !params[piece[1:]] {
+			cv.addf(path+".pattern", "param %q is not defined in route pattern %q", piece, pattern)
+		}
+	}
+}
+
+func (cv *configValidator) validateProxyRule(path string, rule *GatewayProxyRule, subsets map[string]bool) {
+	if rule.Name == "" {
+		cv.addf(path+".name", "required")
+	}
+	var sources []string
+	for _, source := range []struct{ name, key string }{{"header", rule.Header}, {"cookie", rule.Cookie}, {"query", rule.Query}, {"claim", rule.Claim}} {
+		if source.key != "" {
+			sources = append(sources, source.name)
+		}
+	}
+	if len(sources) > 1 {
+		cv.addf(path, "only one of %s is allowed", strings.Join(sources, ", "))
+	}
+	if len(sources) == 0 && len(rule.Values) > 0 {
+		cv.addf(path+".values", "one of header, cookie, query and claim is required")
+	}
+	if rule.Percent < 0 || rule.Percent > 100 {
+		cv.addf(path+".percent", "must be between 0 and 100")
+	}
+	if rule.Sticky != "" {
+		pieces := strings.SplitN(rule.Sticky, ":", 2)
+		if len(pieces) != 2 || pieces[1] == "" || (pieces[0] != "header" && pieces[0] != "cookie" && pieces[0] != "query" && pieces[0] != "claim") {
+			cv.addf(path+".sticky", "invalid sticky %q, expect header|cookie|query|claim:name", rule.Sticky)
+		}
+	}
+	if !subsets[rule.Subset] {
+		cv.addf(path+".subset", "no target of subset %q", rule.Subset)
+	}
+}
+
+func (cv *configValidator) validateFilters(path string, filters []*GatewayFilter) {
+	for i, filter := range filters {
+		cv.validateFilter(fmt.Sprintf("%s[%d]", path, i), filter)
+	}
+}
+
+func (cv *configValidator) validateFilter(path string, filter *GatewayFilter) {
+	var kinds []string
+	if nil != filter.Compress {
+		kinds = append(kinds, "compress")
+		if filter.Compress.Level < -2 || filter.Compress.Level > 9 {
+			cv.addf(path+".compress.level", "must be between -2 and 9")
+		}
+	}
+	if nil != filter.Cache {
+		kinds = append(kinds, "cache")
+	}
+	if nil != filter.IP {
+		kinds = append(kinds, "ip")
+		for field, cidrs := range map[string][]string{"allow": filter.IP.Allow, "deny": filter.IP.Deny, "trustedProxies": filter.IP.TrustedProxies} {
+			for i, cidr := range cidrs {
+				if _, err := gnomon.IPNetParse(cidr); nil != err {
+					cv.addf(fmt.Sprintf("%s.ip.%s[%d]", path, field, i), "%v", err)
+				}
+			}
+		}
+		if filter.IP.File != "" {
+			cv.requireFile(path+".ip.file", filter.IP.File)
+		}
+	}
+	if nil != filter.JWT {
+		kinds = append(kinds, "jwt")
+		if (filter.JWT.Key == "") == (filter.JWT.KeyFile == "") {
+			cv.addf(path+".jwt", "exactly one of key and keyFile is required")
+		} else if filter.JWT.KeyFile != "" {
+			cv.requireFile(path+".jwt.keyFile", filter.JWT.KeyFile)
+		}
+		for i, alg := range filter.JWT.Algs {
+			if alg != "HS256" && alg != "HS384" && alg != "HS512" {
+				cv.addf(fmt.Sprintf("%s.jwt.algs[%d]", path, i), "unsupported alg %q, only HS256, HS384 and HS512 are supported", alg)
+			}
+		}
+	}
+	if nil != filter.Cert {
+		kinds = append(kinds, "cert")
+	}
+	if filter.Custom != "" {
+		kinds = append(kinds, "custom")
+		if _, exist := cv.option.Filters[filter.Custom]; !exist {
+			cv.addf(path+".custom", "filter %q is not registered", filter.Custom)
+		}
+	}
+	switch len(kinds) {
+	case 0:
+		cv.addf(path, "one of compress, cache, ip, jwt, cert and custom is required")
+	case 1:
+	default:
+		cv.addf(path, "only one of %s is allowed", strings.Join(kinds, ", "))
+	}
+}
+
+// validateGatewayPattern 路径必须以“/”开头，且不能包含空的路径片段或空参数
+func validateGatewayPattern(pattern string) error {
+	if pattern == "" {
+		return errors.New("required")
+	}
+	if pattern[0] != '/' {
+		return errors.New("must begin with '/'")
+	}
+	for _, piece := range strings.Split(pattern, "/")[1:] {
+		if piece == "" {
+			return fmt.Errorf("empty path segment in %q", pattern)
+		}
+		if piece == ":" {
+			return fmt.Errorf("empty param name in %q", pattern)
+		}
+	}
+	return nil
+}
+
+// parseBalance 解析负载模型名称，为空表示 balance.Round
+func parseBalance(name string) (balance.Class, error) {
+	if name == "" {
+		return balance.Round, nil
+	}
+	for _, class := range []balance.Class{balance.Round, balance.Random, balance.Hash, balance.Smooth} {
+		if strings.EqualFold(name, class.String()) {
+			return class, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported balance %q, expect round, random, hash or smooth", name)
+}
+
+// parseClientAuth 解析客户端证书校验模式名称，为空表示 ClientAuthNone
+func parseClientAuth(name string) (ClientAuth, error) {
+	switch strings.ToLower(name) {
+	case "", "none":
+		return ClientAuthNone, nil
+	case "request":
+		return ClientAuthRequest, nil
+	case "require":
+		return ClientAuthRequire, nil
+	}
+	return ClientAuthNone, fmt.Errorf("unsupported client auth %q, expect none, request or require", name)
+}
+
+// parseTLSVersion 解析TLS版本，为空表示默认版本
+func parseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "":
+		return 0, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported tls version %q, expect 1.0, 1.1, 1.2 or 1.3", version)
+}
+
+// Gateway 由YAML配置文件驱动的网关
+//
+// 配置文件变化后重新校验并新建Http服务，校验通过才原子替换，替换前接收的请求继续由原服务处理，
+// 监听及已建立的连接不受影响；校验失败则保持原配置并记录错误日志
+type Gateway struct {
+	filePath string
+	option   *GatewayOption
+	state    atomic.Value // *gatewayState
+	modTime  time.Time
+	lock     sync.Mutex
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewGateway 加载网关配置文件并在 GatewayConfig.ReloadInterval 不小于0时监听文件变化
+//
+// option 配置中引用的处理方法及过滤器，nil表示未提供
+func NewGateway(filePath string, option *GatewayOption) (*Gateway, error) {
+	g := &Gateway{filePath: filePath, option: option, stop: make(chan struct{})}
+	if err := g.Reload(); nil != err {
+		return nil, err
+	}
+	interval := g.current().config.ReloadInterval
+	if interval == 0 {
+		interval = 10 * time.Second
+	}
+	if interval > 0 {
+		go g.watch(interval)
+	}
+	return g, nil
+}
+
+func (g *Gateway) current() *gatewayState {
+	state, _ := g.state.Load().(*gatewayState)
+	return state
+}
+
+// Config 获取当前生效的网关配置
+func (g *Gateway) Config() *GatewayConfig {
+	return g.current().config
+}
+
+// Serve 获取当前生效的Http服务
+func (g *Gateway) Serve() *GHttpServe {
+	return g.current().serve
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.current().serve.ServeHTTP(w, r)
+}
+
+// Reload 重新加载配置文件，校验失败或修改了需要重启的配置项时保持原配置不变
+func (g *Gateway) Reload() error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.modTime = fileModTime(g.filePath)
+	config, err := LoadGatewayConfig(g.filePath, g.option)
+	if nil != err {
+		return err
+	}
+	old := g.current()
+	if nil != old {
+		if config.addr() != old.config.addr() {
+			return fmt.Errorf("%s: addr change from %q to %q requires restart", g.filePath, old.config.addr(), config.addr())
+		}
+		if (nil == config.TLS) != (nil == old.config.TLS) {
+			return fmt.Errorf("%s: enabling or disabling tls requires restart", g.filePath)
+		}
+	}
+	state, err := config.build(g.option, true)
+	if nil != err {
+		return fmt.Errorf("%s: %v", g.filePath, err)
+	}
+	g.state.Store(state)
+	if nil != old {
+		old.close()
+	}
+	return nil
+}
+
+// TLSConfig 获取网关 tls.Config，证书随配置重新加载即时生效，未配置TLS时返回nil
+func (g *Gateway) TLSConfig() *tls.Config {
+	state := g.current()
+	if nil == state.tls {
+		return nil
+	}
+	config := state.tls.Config()
+	config.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return g.current().tls.getCertificate(hello)
+	}
+	config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		return g.current().tls.getConfigForClient(hello)
+	}
+	return config
+}
+
+// ListenAndServe 按配置中的监听地址、HTTP服务配置及TLS配置启动监听
+func (g *Gateway) ListenAndServe() error {
+	config := g.Config()
+	option := config.serveOption()
+	server, err := option.server(config.addr(), g)
+	if nil != err {
+		return err
+	}
+	if tlsConfig := g.TLSConfig(); nil != tlsConfig {
+		nextProtos, getConfigForClient := option.nextProtos(), tlsConfig.GetConfigForClient
+		tlsConfig.NextProtos = nextProtos
+		tlsConfig.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			config, err := getConfigForClient(hello)
+			if nil != config {
+				config.NextProtos = nextProtos
+			}
+			return config, err
+		}
+		listener, err := tls.Listen("tcp", server.Addr, tlsConfig)
+		if nil != err {
+			return err
+		}
+		return server.Serve(listener)
+	}
+	return server.ListenAndServe()
+}
+
+// Close 停止监听配置文件变化并释放当前配置的资源
+func (g *Gateway) Close() {
+	g.stopOnce.Do(func() {
+		close(g.stop)
+		g.lock.Lock()
+		defer g.lock.Unlock()
+		g.current().close()
+	})
+}
+
+// watch 定时检查配置文件修改时间，发生变化则重新加载
+func (g *Gateway) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-ticker.C:
+			g.lock.Lock()
+			changed := !fileModTime(g.filePath).Equal(g.modTime)
+			g.lock.Unlock()
+			if !changed {
+				continue
+			}
+			if err := g.Reload(); nil != err {
+				log.Error("Gateway Reload", log.Field("file", g.filePath), log.Err(err))
+			} else {
+				log.Info("Gateway Reload", log.Field("file", g.filePath))
+			}
+		}
+	}
+}
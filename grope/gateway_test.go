@@ -0,0 +1,269 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const gatewayTestConfig = `
+reloadInterval: 20ms
+filters:
+  - custom: tag
+groups:
+  - pattern: /api
+    routes:
+      - method: get
+        pattern: /users/:id
+        limit: {millisecond: 1000, count: 100}
+        proxy:
+          balance: smooth
+          targets:
+            - {host: %s, port: "%s", pattern: /user/:id, weight: 2}
+      - method: GET
+        pattern: /hello
+        handler: %s
+`
+
+func TestGateway(t *testing.T) {
+	backend, target := newProxyBackend("backend")
+	defer backend.Close()
+	dir, err := ioutil.TempDir("", "grope-gateway")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	file := filepath.Join(dir, "gateway.yaml")
+	write := func(handler string) {
+		data := fmt.Sprintf(gatewayTestConfig, target.Host, target.Port, handler)
+		if err := ioutil.WriteFile(file, []byte(data), 0600); nil != err {
+			t.Fatal(err)
+		}
+	}
+	option := &GatewayOption{
+		Handlers: map[string]Handler{
+			"hello": func(ctx *Context) { _ = ctx.ResponseText(http.StatusOK, "hello") },
+			"world": func(ctx *Context) { _ = ctx.ResponseText(http.StatusOK, "world") },
+		},
+		Filters: map[string]Filter{
+			"tag": func(ctx *Context) { ctx.HeaderSet("X-Gateway", "grope") },
+		},
+	}
+	write("hello")
+	gateway, err := NewGateway(file, option)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer gateway.Close()
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+
+	get := func(path string) (string, string) {
+		resp, err := server.Client().Get(server.URL + path)
+		if nil != err {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return string(body), resp.Header.Get("X-Gateway")
+	}
+	if body, tag := get("/api/users/7"); !strings.HasPrefix(body, "backend /user/7 ") || tag != "grope" {
+		t.Errorf("unexpected proxy response %q %q", body, tag)
+	}
+	if body, _ := get("/api/hello"); body != "hello" {
+		t.Errorf("expect hello, got %q", body)
+	}
+
+	// 配置非法时保持原配置
+	if err = ioutil.WriteFile(file, []byte("groups:\n  - pattern: api\n"), 0600); nil != err {
+		t.Fatal(err)
+	}
+	if err = gateway.Reload(); nil == err {
+		t.Errorf("expect invalid config error")
+	}
+	if body, _ := get("/api/hello"); body != "hello" {
+		t.Errorf("expect hello after invalid reload, got %q", body)
+	}
+
+	// 文件变化后自动重新加载，连接保持可用
+	write("world")
+	for i := 0; i < 100; i++ {
+		if body, _ := get("/api/hello"); body == "world" {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Errorf("expect gateway reload on file change")
+}
+
+const gatewayTLSTestConfig = `
+reloadInterval: -1s
+tls:
+  reloadInterval: -1s
+  certs:
+    - {cert: %s, key: %s}
+groups:
+  - pattern: /api
+    routes:
+      - method: GET
+        pattern: /hello
+        handler: hello
+`
+
+func TestGatewayBuildError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grope-gateway")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	cert := writeTestCert(t, dir, "a", 1, "a.example.com")
+	invalid := filepath.Join(dir, "invalid.crt")
+	if err = ioutil.WriteFile(invalid, []byte("not a pem"), 0600); nil != err {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "gateway.yaml")
+	write := func(certFile string) {
+		data := fmt.Sprintf(gatewayTLSTestConfig, certFile, cert.KeyFilePath)
+		if err := ioutil.WriteFile(file, []byte(data), 0600); nil != err {
+			t.Fatal(err)
+		}
+	}
+	option := &GatewayOption{Handlers: map[string]Handler{
+		"hello": func(ctx *Context) { _ = ctx.ResponseText(http.StatusOK, "hello") },
+	}}
+
+	// 配置校验通过但证书加载失败
+	write(invalid)
+	if _, err = NewGateway(file, option); nil == err {
+		t.Fatal("expect invalid cert error")
+	}
+
+	write(cert.CertFilePath)
+	gateway, err := NewGateway(file, option)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer gateway.Close()
+	write(invalid)
+	if err = gateway.Reload(); nil == err {
+		t.Error("expect invalid cert error on reload")
+	}
+	rec := httptest.NewRecorder()
+	gateway.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/hello", nil))
+	if rec.Body.String() != "hello" || nil == gateway.TLSConfig() {
+		t.Errorf("expect previous config kept, got %q", rec.Body.String())
+	}
+}
+
+func TestGatewayConfig_Validate(t *testing.T) {
+	data := `
+trustedProxies: ["10.0.0.0/99"]
+server:
+  http2: {h2c: true, maxReadFrameSize: 1024, maxUploadBufferPerStream: -1}
+filters:
+  - {}
+  - compress: {}
+    custom: tag
+groups:
+  - pattern: /api
+    routes:
+      - method: GETS
+        pattern: /users/:id
+        handler: missing
+      - method: GET
+        pattern: /users/:id
+        limit: {millisecond: 0, count: 1}
+        proxy:
+          balance: weight
+          targets:
+            - {host: "", port: "http", pattern: /user/:uid, subset: canary}
+          rules:
+            - {name: beta, header: X-Canary, cookie: canary, percent: 120, sticky: "uid", subset: blue}
+          mirror: {target: {host: localhost, port: "9090", pattern: /v2/:uid}, percent: -1}
+          retry: {maxAttempts: 0, statuses: [503, 700], perTryTimeout: -1s}
+      - method: GET
+        pattern: /users/:id
+        handler: hello
+        concurrency: {max: 2, queue: -1, adaptive: cubic}
+  - pattern: api/
+    routes: []
+`
+	config, err := ParseGatewayConfig([]byte(data))
+	if nil != err {
+		t.Fatal(err)
+	}
+	err = config.Validate(&GatewayOption{Handlers: map[string]Handler{"hello": func(ctx *Context) {}}})
+	configErr, ok := err.(*GatewayConfigError)
+	if !ok {
+		t.Fatalf("expect *GatewayConfigError, got %v", err)
+	}
+	expects := []string{
+		"trustedProxies: ",
+		"server.http2.maxReadFrameSize: must be between 16384 and 16777215",
+		"server.http2.maxUploadBufferPerStream: must not be negative",
+		"filters[0]: one of compress, cache, ip, jwt, cert and custom is required",
+		"filters[1]: only one of compress, custom is allowed",
+		"filters[1].custom: filter \"tag\" is not registered",
+		"groups[0].routes[0].method: unsupported method \"GETS\"",
+		"groups[0].routes[0].handler: handler \"missing\" is not registered",
+		"groups[0].routes[1].limit.millisecond: must be greater than 0",
+		"groups[0].routes[1].proxy.balance: unsupported balance \"weight\"",
+		"groups[0].routes[1].proxy.targets: at least one target of default subset is required",
+		"groups[0].routes[1].proxy.rules[0]: only one of header, cookie is allowed",
+		"groups[0].routes[1].proxy.rules[0].percent: must be between 0 and 100",
+		"groups[0].routes[1].proxy.rules[0].sticky: invalid sticky \"uid\"",
+		"groups[0].routes[1].proxy.rules[0].subset: no target of subset \"blue\"",
+		"groups[0].routes[1].proxy.mirror.target.pattern: param \":uid\" is not defined",
+		"groups[0].routes[1].proxy.mirror.percent: must be between 0 and 100",
+		"groups[0].routes[1].proxy.retry.maxAttempts: must be greater than 0",
+		"groups[0].routes[1].proxy.retry.statuses[1]: invalid status 700",
+		"groups[0].routes[1].proxy.retry.perTryTimeout: must not be negative",
+		"groups[0].routes[1].proxy.targets[0].host: required",
+		"groups[0].routes[1].proxy.targets[0].port: invalid port \"http\"",
+		"groups[0].routes[1].proxy.targets[0].pattern: param \":uid\" is not defined",
+		"groups[0].routes[2]: duplicate route GET /api/users/:id, already defined at groups[0].routes[1]",
+		"groups[0].routes[2].concurrency.queue: must not be negative",
+		"groups[0].routes[2].concurrency.adaptive: unsupported adaptive \"cubic\"",
+		"groups[1].pattern: must begin with '/'",
+		"groups[1].routes: at least one route is required",
+	}
+	for _, expect := range expects {
+		found := false
+		for _, problem := range configErr.Problems {
+			if strings.HasPrefix(problem, expect) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("expect problem %q in %v", expect, configErr.Problems)
+		}
+	}
+
+	if _, err = ParseGatewayConfig([]byte("groups:\n  - pattern: /api\n    route: []\n")); nil == err || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("expect unknown field error with line number, got %v", err)
+	}
+	if _, err = ParseGatewayConfig(nil); err != ErrGatewayConfigEmpty {
+		t.Errorf("expect ErrGatewayConfigEmpty, got %v", err)
+	}
+}
@@ -15,11 +15,10 @@
 package grope
 
 import (
-	"crypto/rand"
 	"crypto/tls"
-	"crypto/x509"
 	"github.com/aberic/gnomon/log"
-	"io/ioutil"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"net/http"
 	"time"
 )
@@ -29,11 +28,115 @@ func NewHTTPServe(filters ...Filter) *GHttpServe {
 	return newGHttpServe(filters...)
 }
 
+// ServeOption HTTP服务配置
+type ServeOption struct {
+	// 读取整个请求（包括请求体）的超时时间，0表示不限
+	ReadTimeout time.Duration
+	// 读取请求头的超时时间，0表示使用 ReadTimeout
+	ReadHeaderTimeout time.Duration
+	// 写入响应的超时时间，0表示不限
+	WriteTimeout time.Duration
+	// 保持连接时等待下一个请求的超时时间，0表示使用 ReadTimeout
+	IdleTimeout time.Duration
+	// 请求头允许的最大长度（字节），0表示使用 http.DefaultMaxHeaderBytes
+	MaxHeaderBytes int
+	// HTTP/2配置，nil表示TLS连接通过ALPN协商使用默认配置的HTTP/2，明文连接仅支持HTTP/1.1
+	HTTP2 *HTTP2Option
+}
+
+// HTTP2Option HTTP/2服务配置
+type HTTP2Option struct {
+	// 是否禁用TLS连接上的HTTP/2
+	Disable bool
+	// 明文连接是否支持h2c，包括先验知识（prior knowledge）及“Upgrade: h2c”升级，
+	// 用于内网负载均衡后的gRPC风格客户端及多路复用，不应在公网暴露
+	H2C bool
+	// 每个连接允许客户端同时打开的最大流数，0表示默认250
+	MaxConcurrentStreams uint32
+	// 允许读取的最大帧长度（字节），范围16KB~16MB，0表示默认1MB
+	MaxReadFrameSize uint32
+	// 每个连接的上传流控窗口（字节），0表示默认1MB
+	MaxUploadBufferPerConnection int32
+	// 每个流的上传流控窗口（字节），0表示默认1MB
+	MaxUploadBufferPerStream int32
+}
+
+// server 根据配置新建 http2.Server
+func (ho *HTTP2Option) server(idleTimeout time.Duration) *http2.Server {
+	return &http2.Server{
+		MaxConcurrentStreams:         ho.MaxConcurrentStreams,
+		MaxReadFrameSize:             ho.MaxReadFrameSize,
+		MaxUploadBufferPerConnection: ho.MaxUploadBufferPerConnection,
+		MaxUploadBufferPerStream:     ho.MaxUploadBufferPerStream,
+		IdleTimeout:                  idleTimeout,
+	}
+}
+
+// DefaultServeOption 默认HTTP服务配置，仅限制请求头读取及空闲连接时间，不影响流式请求及响应
+func DefaultServeOption() *ServeOption {
+	return &ServeOption{
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       120 * time.Second,
+	}
+}
+
+// server 根据配置新建 http.Server，并按 HTTP2 配置启用HTTP/2及h2c
+func (so *ServeOption) server(Addr string, handler http.Handler) (*http.Server, error) {
+	if nil == so {
+		so = DefaultServeOption()
+	}
+	server := &http.Server{
+		Addr:              Addr,
+		Handler:           handler,
+		ReadTimeout:       so.ReadTimeout,
+		ReadHeaderTimeout: so.ReadHeaderTimeout,
+		WriteTimeout:      so.WriteTimeout,
+		IdleTimeout:       so.IdleTimeout,
+		MaxHeaderBytes:    so.MaxHeaderBytes,
+	}
+	option := so.HTTP2
+	if nil == option {
+		option = &HTTP2Option{}
+	}
+	h2s := option.server(so.IdleTimeout)
+	if option.Disable {
+		// 非nil的空集合使 net/http 不再自动启用HTTP/2
+		server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	} else if err := http2.ConfigureServer(server, h2s); nil != err {
+		return nil, err
+	}
+	if option.H2C {
+		server.Handler = h2c.NewHandler(handler, h2s)
+	}
+	return server, nil
+}
+
+// nextProtos TLS连接通过ALPN协商的协议列表
+func (so *ServeOption) nextProtos() []string {
+	if nil != so && nil != so.HTTP2 && so.HTTP2.Disable {
+		return []string{"http/1.1"}
+	}
+	return []string{http2.NextProtoTLS, "http/1.1"}
+}
+
 // ListenAndServe 启动监听
 //
 // Addr 期望监听的端口号，如“:8080”
 func ListenAndServe(Addr string, gs *GHttpServe) {
-	err := http.ListenAndServe(Addr, gs) //设置监听的端口
+	ListenAndServeWithOption(Addr, gs, DefaultServeOption())
+}
+
+// ListenAndServeWithOption 启动监听
+//
+// Addr 期望监听的端口号，如“:8080”
+//
+// option HTTP服务配置，如读写超时等
+func ListenAndServeWithOption(Addr string, gs *GHttpServe, option *ServeOption) {
+	server, err := option.server(Addr, gs)
+	if nil != err {
+		log.Panic("ListenAndServe", log.Err(err))
+	}
+	err = server.ListenAndServe() //设置监听的端口
 	if err != nil {
 		log.Panic("ListenAndServe", log.Err(err))
 	}
@@ -44,34 +147,53 @@ func ListenAndServe(Addr string, gs *GHttpServe) {
 // Addr 期望监听的端口号，如“:8080”
 //
 // 必须提供包含证书和与服务器匹配的私钥的文件。如果证书是由证书颁发机构签署的，则certFile应该是服务器证书、任何中间体和CA证书的连接。
+//
+// 提供caCertFilePaths时要求并校验客户端证书，否则不请求客户端证书
 func ListenAndServeTLS(gs *GHttpServe, Addr, certFilePath, keyFilePath string, caCertFilePaths ...string) {
-	//加载服务端证书，用于对方验证我方合法性
-	if cert, err := tls.LoadX509KeyPair(certFilePath, keyFilePath); err != nil {
-		log.Panic("ListenAndServeTLS LoadX509KeyPair", log.Err(err))
+	ListenAndServeTLSWithOption(gs, Addr, DefaultServeOption(), certFilePath, keyFilePath, caCertFilePaths...)
+}
+
+// ListenAndServeTLSWithOption 启动监听
+//
+// Addr 期望监听的端口号，如“:8080”
+//
+// option HTTP服务配置，如读写超时等
+//
+// 必须提供包含证书和与服务器匹配的私钥的文件。如果证书是由证书颁发机构签署的，则certFile应该是服务器证书、任何中间体和CA证书的连接。
+//
+// 提供caCertFilePaths时要求并校验客户端证书，否则不请求客户端证书
+func ListenAndServeTLSWithOption(gs *GHttpServe, Addr string, option *ServeOption, certFilePath, keyFilePath string, caCertFilePaths ...string) {
+	tlsOption := &TLSOption{
+		Certs:           []*TLSCert{{CertFilePath: certFilePath, KeyFilePath: keyFilePath}},
+		CACertFilePaths: caCertFilePaths,
+	}
+	if len(caCertFilePaths) > 0 {
+		tlsOption.ClientAuth = ClientAuthRequire
+	}
+	ListenAndServeTLSConfig(gs, Addr, option, tlsOption)
+}
+
+// ListenAndServeTLSConfig 启动监听
+//
+// Addr 期望监听的端口号，如“:8080”
+//
+// option HTTP服务配置，如读写超时等
+//
+// tlsOption TLS配置，支持SNI多证书、证书文件热加载及客户端证书校验模式
+func ListenAndServeTLSConfig(gs *GHttpServe, Addr string, option *ServeOption, tlsOption *TLSOption) {
+	serverTLS, err := NewServerTLS(tlsOption)
+	if nil != err {
+		log.Panic("ListenAndServeTLS NewServerTLS", log.Err(err))
+	}
+	defer serverTLS.Close()
+	serverTLS.nextProtos = option.nextProtos()
+	server, err := option.server(Addr, gs)
+	if nil != err {
+		log.Panic("ListenAndServeTLS", log.Err(err))
+	}
+	if listener, err := tls.Listen("tcp", Addr, serverTLS.Config()); nil != err {
+		log.Panic("Serve", log.Err(err))
 	} else {
-		tlsConfig := &tls.Config{
-			Certificates: []tls.Certificate{cert},
-			ClientAuth:   tls.RequireAndVerifyClientCert,
-		}
-		if nil != caCertFilePaths && len(caCertFilePaths) > 0 {
-			clientCertPool := x509.NewCertPool()
-			//加载根证书，用于验证对方合法性
-			for _, caCertFilePath := range caCertFilePaths {
-				//这里读取的是根证书
-				if buf, err := ioutil.ReadFile(caCertFilePath); err != nil {
-					log.Panic("ListenAndServeTLS ReadFile", log.Err(err))
-				} else {
-					clientCertPool.AppendCertsFromPEM(buf)
-				}
-			}
-			tlsConfig.ClientCAs = clientCertPool
-		}
-		tlsConfig.Time = time.Now
-		tlsConfig.Rand = rand.Reader
-		if listener, err := tls.Listen("tcp", Addr, tlsConfig); nil != err {
-			log.Panic("Serve", log.Err(err))
-		} else {
-			log.Panic("Serve", log.Err(http.Serve(listener, gs)))
-		}
+		log.Panic("Serve", log.Err(server.Serve(listener)))
 	}
 }
@@ -0,0 +1,169 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"bufio"
+	"crypto/tls"
+	"golang.org/x/net/http2"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// protoServe 返回请求协议版本的Http服务
+func protoServe() *GHttpServe {
+	gs := NewHTTPServe()
+	gs.Group("/proto").repo(http.MethodGet, "/version", nil, func(ctx *Context) {
+		_ = ctx.ResponseText(http.StatusOK, ctx.request.Proto)
+	}, nil)
+	return gs
+}
+
+// serveTest 按配置在随机端口启动服务，listen 为nil时使用明文监听
+func serveTest(t *testing.T, option *ServeOption, listen func(net.Listener) net.Listener) (string, func()) {
+	server, err := option.server("", protoServe())
+	if nil != err {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	if nil != listen {
+		listener = listen(listener)
+	}
+	go func() { _ = server.Serve(listener) }()
+	return addr, func() { _ = server.Close() }
+}
+
+func getProto(client *http.Client, url string) (string, error) {
+	resp, err := client.Get(url)
+	if nil != err {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := ioutil.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestServeOption_h2c(t *testing.T) {
+	priorKnowledge := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+
+	addr, stop := serveTest(t, &ServeOption{HTTP2: &HTTP2Option{H2C: true, MaxConcurrentStreams: 10}}, nil)
+	defer stop()
+	if proto, err := getProto(priorKnowledge, "http://"+addr+"/proto/version"); nil != err || proto != "HTTP/2.0" {
+		t.Errorf("expect h2c prior knowledge, got %q %v", proto, err)
+	}
+	if proto, err := getProto(http.DefaultClient, "http://"+addr+"/proto/version"); nil != err || proto != "HTTP/1.1" {
+		t.Errorf("expect http/1.1 still served, got %q %v", proto, err)
+	}
+	// Upgrade: h2c
+	conn, err := net.Dial("tcp", addr)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	_, _ = conn.Write([]byte("GET /proto/version HTTP/1.1\r\nHost: " + addr + "\r\nConnection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\nHTTP2-Settings: \r\n\r\n"))
+	if line, err := bufio.NewReader(conn).ReadString('\n'); nil != err || !strings.HasPrefix(line, "HTTP/1.1 101") {
+		t.Errorf("expect switching protocols, got %q %v", line, err)
+	}
+
+	plainAddr, plainStop := serveTest(t, nil, nil)
+	defer plainStop()
+	if _, err := getProto(priorKnowledge, "http://"+plainAddr+"/proto/version"); nil == err {
+		t.Error("expect h2c disabled by default")
+	}
+}
+
+func TestServeOption_http2TLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grope-http2")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	cert := writeTestCert(t, dir, "localhost", 1, "localhost")
+	serverTLS, err := NewServerTLS(&TLSOption{Certs: []*TLSCert{cert}, ReloadInterval: -1})
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer serverTLS.Close()
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+
+	for _, c := range []struct {
+		option *ServeOption
+		proto  string
+	}{
+		{option: nil, proto: "HTTP/2.0"},
+		{option: &ServeOption{HTTP2: &HTTP2Option{MaxConcurrentStreams: 10, MaxReadFrameSize: 1 << 16}}, proto: "HTTP/2.0"},
+		{option: &ServeOption{HTTP2: &HTTP2Option{Disable: true}}, proto: "HTTP/1.1"},
+	} {
+		serverTLS.nextProtos = c.option.nextProtos()
+		addr, stop := serveTest(t, c.option, func(listener net.Listener) net.Listener {
+			return tls.NewListener(listener, serverTLS.Config())
+		})
+		if proto, err := getProto(client, "https://"+addr+"/proto/version"); nil != err || proto != c.proto {
+			t.Errorf("expect %s, got %q %v", c.proto, proto, err)
+		}
+		stop()
+		client.CloseIdleConnections()
+	}
+}
+
+// pushRecorder 记录服务端推送的 http.ResponseWriter
+type pushRecorder struct {
+	*httptest.ResponseRecorder
+	targets []string
+}
+
+func (pr *pushRecorder) Push(target string, opts *http.PushOptions) error {
+	pr.targets = append(pr.targets, target)
+	return nil
+}
+
+func TestContext_Push(t *testing.T) {
+	gs := NewHTTPServe()
+	gs.Group("/page").repo(http.MethodGet, "/index", nil, func(ctx *Context) {
+		if err := ctx.Push("/static/app.js", nil); nil != err {
+			_ = ctx.ResponseText(http.StatusOK, err.Error())
+			return
+		}
+		_ = ctx.ResponseText(http.StatusOK, "pushed")
+	}, nil)
+
+	rec := httptest.NewRecorder()
+	gs.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/page/index", nil))
+	if rec.Body.String() != http.ErrNotSupported.Error() {
+		t.Errorf("expect push not supported, got %q", rec.Body.String())
+	}
+	pusher := &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	gs.ServeHTTP(pusher, httptest.NewRequest(http.MethodGet, "/page/index", nil))
+	if pusher.Body.String() != "pushed" || len(pusher.targets) != 1 || pusher.targets[0] != "/static/app.js" {
+		t.Errorf("expect pushed /static/app.js, got %q %v", pusher.Body.String(), pusher.targets)
+	}
+}
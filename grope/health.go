@@ -0,0 +1,273 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aberic/gnomon"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// HealthUp 健康
+	HealthUp = "up"
+	// HealthDown 不健康
+	HealthDown = "down"
+)
+
+// HealthCheck 健康检查方法，返回nil表示健康，ctx 在检查超时后结束
+type HealthCheck func(ctx context.Context) error
+
+// HealthPinger 支持 PingContext 的组件，如 *sql.DB 及 *db.MySQL
+type HealthPinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// Health 健康检查注册表，各组件通过名称注册检查项
+//
+// 存活检查（liveness）仅包含进程自身是否可以继续运行的检查，失败时通常需要重启；
+// 就绪检查（readiness）包含全部存活检查及依赖组件的检查，失败时不再接收新的流量
+type Health struct {
+	Timeout time.Duration // 单项检查的超时时间，默认3s
+	lock    sync.RWMutex
+	checks  []*healthCheck
+}
+
+type healthCheck struct {
+	name     string
+	liveness bool
+	check    HealthCheck
+}
+
+// HealthReport 健康检查报告
+type HealthReport struct {
+	Status string               `json:"status"` // HealthUp 或 HealthDown
+	Checks []*HealthCheckResult `json:"checks"` // 按注册顺序排列的检查结果
+}
+
+// HealthCheckResult 单项健康检查结果
+type HealthCheckResult struct {
+	Name     string `json:"name"`            // 检查项名称
+	Status   string `json:"status"`          // HealthUp 或 HealthDown
+	Duration string `json:"duration"`        // 检查耗时，如“1.2ms”
+	Error    string `json:"error,omitempty"` // 检查失败原因
+}
+
+// NewHealth 新建健康检查注册表
+func NewHealth() *Health {
+	return &Health{}
+}
+
+// AddLiveness 注册存活检查，同名检查项将被替换
+func (h *Health) AddLiveness(name string, check HealthCheck) {
+	h.add(name, true, check)
+}
+
+// AddReadiness 注册就绪检查，同名检查项将被替换
+func (h *Health) AddReadiness(name string, check HealthCheck) {
+	h.add(name, false, check)
+}
+
+func (h *Health) add(name string, liveness bool, check HealthCheck) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	hc := &healthCheck{name: name, liveness: liveness, check: check}
+	for index, exist := range h.checks {
+		if exist.name == name {
+			h.checks[index] = hc
+			return
+		}
+	}
+	h.checks = append(h.checks, hc)
+}
+
+// Remove 移除检查项
+func (h *Health) Remove(name string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for index, exist := range h.checks {
+		if exist.name == name {
+			h.checks = append(h.checks[:index:index], h.checks[index+1:]...)
+			return
+		}
+	}
+}
+
+// Liveness 并发执行存活检查
+func (h *Health) Liveness(ctx context.Context) *HealthReport {
+	return h.check(ctx, true)
+}
+
+// Readiness 并发执行全部检查
+func (h *Health) Readiness(ctx context.Context) *HealthReport {
+	return h.check(ctx, false)
+}
+
+func (h *Health) check(ctx context.Context, liveness bool) *HealthReport {
+	h.lock.RLock()
+	var checks []*healthCheck
+	for _, hc := range h.checks {
+		if hc.liveness || !liveness {
+			checks = append(checks, hc)
+		}
+	}
+	h.lock.RUnlock()
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	report := &HealthReport{Status: HealthUp, Checks: make([]*HealthCheckResult, len(checks))}
+	var wg sync.WaitGroup
+	for index, hc := range checks {
+		wg.Add(1)
+		go func(index int, hc *healthCheck) {
+			defer wg.Done()
+			report.Checks[index] = hc.run(ctx, timeout)
+		}(index, hc)
+	}
+	wg.Wait()
+	for _, result := range report.Checks {
+		if result.Status != HealthUp {
+			report.Status = HealthDown
+		}
+	}
+	return report
+}
+
+// run 执行检查，检查超时后不再等待其返回
+func (hc *healthCheck) run(ctx context.Context, timeout time.Duration) *HealthCheckResult {
+	c, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); nil != r {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- hc.check(c)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-c.Done():
+		err = c.Err()
+	}
+	result := &HealthCheckResult{Name: hc.name, Status: HealthUp, Duration: time.Since(start).String()}
+	if nil != err {
+		result.Status, result.Error = HealthDown, err.Error()
+	}
+	return result
+}
+
+// LivenessHandler 存活检查处理方法，健康时返回200，否则返回503，响应体为 HealthReport
+func (h *Health) LivenessHandler() Handler {
+	return func(ctx *Context) {
+		h.response(ctx, h.Liveness(ctx.request.Context()))
+	}
+}
+
+// ReadinessHandler 就绪检查处理方法，健康时返回200，否则返回503，响应体为 HealthReport
+func (h *Health) ReadinessHandler() Handler {
+	return func(ctx *Context) {
+		h.response(ctx, h.Readiness(ctx.request.Context()))
+	}
+}
+
+func (h *Health) response(ctx *Context, report *HealthReport) {
+	status := http.StatusOK
+	if report.Status != HealthUp {
+		status = http.StatusServiceUnavailable
+	}
+	ctx.HeaderSet("Cache-Control", "no-store")
+	_ = ctx.ResponseJSON(status, report)
+}
+
+// HealthRouter 在 ghs 中注册“GET /healthz”存活检查及“GET /readyz”就绪检查
+//
+// filters 待实现拦截器/过滤器方法数组，如 IPFilter
+func HealthRouter(ghs *GHttpServe, health *Health, filters ...Filter) {
+	ghs.nodal.add("/healthz", http.MethodGet, nil, health.LivenessHandler(), nil, filters...)
+	ghs.nodal.add("/readyz", http.MethodGet, nil, health.ReadinessHandler(), nil, filters...)
+}
+
+// PingCheck 通过 PingContext 检查组件连接，如 *sql.DB 及 *db.MySQL
+func PingCheck(pinger HealthPinger) HealthCheck {
+	return pinger.PingContext
+}
+
+// GRPCPoolCheck 从gRPC连接池中获取连接并检查连接状态，连接处于 Shutdown 或 TransientFailure 状态时不健康
+func GRPCPoolCheck(pool *gnomon.Pond) HealthCheck {
+	return func(ctx context.Context) error {
+		c, err := pool.Acquire()
+		if nil != err {
+			return err
+		}
+		conn, ok := c.(*grpc.ClientConn)
+		if !ok {
+			_ = pool.Release(c)
+			return nil
+		}
+		state := conn.GetState()
+		if state == connectivity.Shutdown || state == connectivity.TransientFailure {
+			pool.Close(c)
+			return fmt.Errorf("grpc connection %s %s", conn.Target(), state)
+		}
+		return pool.Release(c)
+	}
+}
+
+// TargetCheck 检查代理目标是否可以建立TCP连接，任一目标无法连接时不健康
+func TargetCheck(targets ...*Target) HealthCheck {
+	return func(ctx context.Context) error {
+		var (
+			dialer net.Dialer
+			wg     sync.WaitGroup
+			errs   = make([]error, len(targets))
+		)
+		for index, target := range targets {
+			wg.Add(1)
+			go func(index int, addr string) {
+				defer wg.Done()
+				conn, err := dialer.DialContext(ctx, "tcp", addr)
+				if nil != err {
+					errs[index] = err
+					return
+				}
+				_ = conn.Close()
+			}(index, net.JoinHostPort(target.Host, target.Port))
+		}
+		wg.Wait()
+		var failed []string
+		for index, err := range errs {
+			if nil != err {
+				failed = append(failed, net.JoinHostPort(targets[index].Host, targets[index].Port))
+			}
+		}
+		if len(failed) > 0 {
+			return errors.New("unreachable targets: " + strings.Join(failed, ", "))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	health := NewHealth()
+	health.Timeout = 50 * time.Millisecond
+	var dbErr error
+	health.AddLiveness("self", func(ctx context.Context) error { return nil })
+	health.AddReadiness("db", func(ctx context.Context) error { return dbErr })
+	gs := NewHTTPServe()
+	HealthRouter(gs, health)
+	client := NewTestClient(gs)
+
+	client.Get("/healthz").MustDo(t).AssertStatus(t, http.StatusOK)
+	resp := client.Get("/readyz").MustDo(t).AssertStatus(t, http.StatusOK)
+	if resp.Header.Get("Cache-Control") != "no-store" {
+		t.Errorf("expect no-store, got %q", resp.Header.Get("Cache-Control"))
+	}
+
+	// 就绪检查失败不影响存活检查
+	dbErr = errors.New("connection refused")
+	client.Get("/healthz").MustDo(t).AssertStatus(t, http.StatusOK)
+	report := &HealthReport{}
+	if err := client.Get("/readyz").MustDo(t).AssertStatus(t, http.StatusServiceUnavailable).DecodeJSON(report); nil != err {
+		t.Fatal(err)
+	}
+	if report.Status != HealthDown || len(report.Checks) != 2 || report.Checks[0].Status != HealthUp ||
+		report.Checks[1].Name != "db" || report.Checks[1].Error != "connection refused" {
+		t.Errorf("unexpected report %+v %+v", report, report.Checks)
+	}
+
+	// 超时及 panic
+	health.AddLiveness("self", func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(time.Second)
+		return nil
+	})
+	health.AddReadiness("panic", func(ctx context.Context) error { panic("boom") })
+	start := time.Now()
+	report = health.Readiness(context.Background())
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expect check timeout, elapsed %s", elapsed)
+	}
+	if len(report.Checks) != 3 || report.Checks[0].Error != context.DeadlineExceeded.Error() || report.Checks[2].Error != "panic: boom" {
+		t.Errorf("unexpected report %+v %+v", report, report.Checks)
+	}
+
+	health.Remove("self")
+	if report = health.Liveness(context.Background()); report.Status != HealthUp || len(report.Checks) != 0 {
+		t.Errorf("expect empty liveness, got %+v", report)
+	}
+}
+
+func TestTargetCheck(t *testing.T) {
+	backend, target := newProxyBackend("a")
+	defer backend.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	_ = listener.Close()
+
+	if err := TargetCheck(target)(context.Background()); nil != err {
+		t.Errorf("expect reachable, got %v", err)
+	}
+	err = TargetCheck(target, &Target{Host: host, Port: port})(context.Background())
+	if nil == err || !strings.Contains(err.Error(), listener.Addr().String()) || strings.Contains(err.Error(), target.Port) {
+		t.Errorf("expect closed port unreachable, got %v", err)
+	}
+}
+
+func TestDebugRouter(t *testing.T) {
+	gs := NewHTTPServe()
+	if err := DebugRouter(gs, "/debug", &Admin{}); err != ErrAdminAuthRequired {
+		t.Errorf("expect ErrAdminAuthRequired, got %v", err)
+	}
+	if err := DebugRouter(gs, "/debug", &Admin{Token: "secret"}); nil != err {
+		t.Fatal(err)
+	}
+	client := NewTestClient(gs)
+	client.Get("/debug/vars").MustDo(t).AssertStatus(t, http.StatusUnauthorized)
+
+	client.SetHeader("Authorization", "Bearer secret")
+	if text := client.Get("/debug/vars").MustDo(t).AssertStatus(t, http.StatusOK).Text(); !strings.Contains(text, "memstats") {
+		t.Errorf("expect expvar memstats, got %s", text)
+	}
+	if text := client.Get("/debug/pprof").MustDo(t).AssertStatus(t, http.StatusOK).Text(); !strings.Contains(text, "pprof/heap?debug=1") {
+		t.Errorf("expect pprof index, got %s", text)
+	}
+	if text := client.Get("/debug/pprof/goroutine?debug=1").MustDo(t).AssertStatus(t, http.StatusOK).Text(); !strings.Contains(text, "goroutine profile") {
+		t.Errorf("expect goroutine profile, got %s", text)
+	}
+	client.Get("/debug/pprof/cmdline").MustDo(t).AssertStatus(t, http.StatusOK)
+	client.Get("/debug/pprof/unknown").MustDo(t).AssertStatus(t, http.StatusNotFound)
+}
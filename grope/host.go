@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"net"
+	"sort"
+	"strings"
+)
+
+// virtualHost 虚拟主机
+type virtualHost struct {
+	pattern string      // 主机匹配规则，如“api.example.com”、“*.example.com”或“:tenant.example.com”
+	labels  []string    // 按“.”拆分后的主机标签，如[*, example, com]
+	statics int         // 静态标签数量，匹配时静态标签越多优先级越高
+	serve   *GHttpServe // 虚拟主机独立的Http服务
+}
+
+// match 匹配请求主机，返回主机中自定义的参数集合
+func (vh *virtualHost) match(labels []string) (map[string]string, bool) {
+	if len(labels) != len(vh.labels) {
+		return nil, false
+	}
+	values := map[string]string{}
+	for index, label := range vh.labels {
+		switch {
+		case label == "*":
+		case label[0] == ':':
+			values[label[1:]] = labels[index]
+		case label != labels[index]:
+			return nil, false
+		}
+	}
+	return values, true
+}
+
+// Host 设置虚拟主机，根据请求头中的Host选择独立的路由树及过滤器，未匹配任何虚拟主机的请求由当前服务处理
+//
+// host 主机匹配规则，不包含端口，支持以下格式：
+//
+// 精确匹配，如“api.example.com”；
+//
+// 通配符匹配一级子域名，如“*.example.com”匹配“a.example.com”，但不匹配“example.com”及“a.b.example.com”；
+//
+// 参数匹配一级子域名，如“:tenant.example.com”，匹配到的值通过 Context.Value("tenant") 获取
+//
+// 匹配优先级为精确匹配优先，其次静态标签数量多的规则优先，相同数量时按设置顺序
+//
+// filters 虚拟主机根过滤器/拦截器方法数组，当前服务的过滤器不会作用于虚拟主机
+func (ghs *GHttpServe) Host(host string, filters ...Filter) *GHttpServe {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" {
+		panic("host can not be empty")
+	}
+	ghs.hostLock.Lock()
+	defer ghs.hostLock.Unlock()
+	if nil != ghs.exactHosts[host] {
+		return ghs.exactHosts[host]
+	}
+	for _, vh := range ghs.patternHosts {
+		if vh.pattern == host {
+			return vh.serve
+		}
+	}
+	serve := newGHttpServe(filters...)
+	serve.parent = ghs
+	serve.host = host
+	labels := strings.Split(host, ".")
+	statics := 0
+	for _, label := range labels {
+		if label == "" {
+			panic("host label can not be empty")
+		}
+		if label != "*" && label[0] != ':' {
+			statics++
+		}
+	}
+	if statics == len(labels) {
+		if nil == ghs.exactHosts {
+			ghs.exactHosts = map[string]*GHttpServe{}
+		}
+		ghs.exactHosts[host] = serve
+		return serve
+	}
+	ghs.patternHosts = append(ghs.patternHosts, &virtualHost{pattern: host, labels: labels, statics: statics, serve: serve})
+	sort.SliceStable(ghs.patternHosts, func(i, j int) bool {
+		return ghs.patternHosts[i].statics > ghs.patternHosts[j].statics
+	})
+	return serve
+}
+
+// virtualHost 根据请求主机选择处理请求的服务，未匹配任何虚拟主机时返回当前服务
+func (ghs *GHttpServe) virtualHost(host string) (*GHttpServe, map[string]string) {
+	ghs.hostLock.RLock()
+	defer ghs.hostLock.RUnlock()
+	if nil == ghs.exactHosts && nil == ghs.patternHosts {
+		return ghs, nil
+	}
+	if h, _, err := net.SplitHostPort(host); nil == err {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if serve, ok := ghs.exactHosts[host]; ok {
+		return serve, nil
+	}
+	labels := strings.Split(host, ".")
+	for _, vh := range ghs.patternHosts {
+		if values, ok := vh.match(labels); ok {
+			return vh.serve, values
+		}
+	}
+	return ghs, nil
+}
+
+// hostServe 根据主机匹配规则获取已设置的虚拟主机，规则为空时返回当前服务，不存在则返回nil
+func (ghs *GHttpServe) hostServe(host string) *GHttpServe {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" {
+		return ghs
+	}
+	ghs.hostLock.RLock()
+	defer ghs.hostLock.RUnlock()
+	if serve, ok := ghs.exactHosts[host]; ok {
+		return serve
+	}
+	for _, vh := range ghs.patternHosts {
+		if vh.pattern == host {
+			return vh.serve
+		}
+	}
+	return nil
+}
+
+// serves 获取当前服务及其全部虚拟主机服务，虚拟主机按匹配规则排序
+func (ghs *GHttpServe) serves() []*GHttpServe {
+	ghs.hostLock.RLock()
+	defer ghs.hostLock.RUnlock()
+	serves := []*GHttpServe{ghs}
+	for _, serve := range ghs.exactHosts {
+		serves = append(serves, serve)
+	}
+	for _, vh := range ghs.patternHosts {
+		serves = append(serves, vh.serve)
+	}
+	sort.Slice(serves[1:], func(i, j int) bool {
+		return serves[i+1].host < serves[j+1].host
+	})
+	return serves
+}
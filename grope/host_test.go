@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHost(t *testing.T) {
+	gs := NewHTTPServe()
+	gs.Group("/site").Get("/name", func(ctx *Context) {
+		_ = ctx.ResponseText(http.StatusOK, "default")
+	})
+	api := gs.Host("api.example.com", func(ctx *Context) {
+		ctx.HeaderSet("X-Host", "api")
+	})
+	api.Group("/site").Get("/name", func(ctx *Context) {
+		_ = ctx.ResponseText(http.StatusOK, "api")
+	})
+	tenant := gs.Host(":tenant.example.com")
+	tenant.Group("/site").Get("/name", func(ctx *Context) {
+		_ = ctx.ResponseText(http.StatusOK, "tenant "+ctx.Value("tenant"))
+	})
+	wildcard := gs.Host("*.cdn.example.com")
+	wildcard.Group("/site").Get("/name", func(ctx *Context) {
+		_ = ctx.ResponseText(http.StatusOK, "cdn")
+	})
+	if gs.Host("API.example.com") != api {
+		t.Errorf("expect same host serve")
+	}
+	gs.WaitRoutes()
+
+	cases := []struct {
+		host string
+		body string
+	}{
+		{"api.example.com:8080", "api"},
+		{"shop.example.com", "tenant shop"},
+		{"img.cdn.example.com", "cdn"},
+		{"example.com", "default"},
+		{"a.b.cdn.example.com", "default"},
+		{"localhost", "default"},
+	}
+	for _, c := range cases {
+		resp := NewTestClient(gs).SetHost("http://" + c.host).Get("/site/name").MustDo(t)
+		resp.AssertStatus(t, http.StatusOK).AssertText(t, c.body)
+		if c.body == "api" {
+			resp.AssertHeader(t, "X-Host", "api")
+		}
+	}
+}
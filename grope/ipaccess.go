@@ -0,0 +1,237 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/aberic/gnomon"
+	"github.com/aberic/gnomon/log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrIPDenied ip address denied
+	ErrIPDenied = errors.New("ip address denied")
+)
+
+// IPAccess IP访问控制策略
+//
+// 拒绝列表优先，其次在允许列表不为空时要求客户端IP匹配允许列表，列表项可以是IP或CIDR网段，支持IPv4及IPv6
+type IPAccess struct {
+	// 允许访问的IP或网段，如“10.0.0.0/8”、“2001:db8::/32”、“192.168.1.1”
+	Allow []string
+	// 拒绝访问的IP或网段
+	Deny []string
+	// 可信代理的IP或网段，仅当请求来自可信代理时才自右向左解析转发请求头中的客户端IP，
+	// 为空则使用 Context.ClientIP，即 GHttpServe.SetTrustedProxies 的设置
+	TrustedProxies []string
+	// 访问控制列表文件，每行一项，格式为“allow 10.0.0.0/8”或“deny 192.168.1.1”，“#”开头为注释，
+	// 文件中的列表与 Allow 及 Deny 合并使用
+	File string
+	// 检查列表文件变化的间隔时间，文件变化后自动重新加载，默认10秒，负数表示不重新加载
+	ReloadInterval time.Duration
+	// 拒绝访问（403）处理方法
+	Forbidden AuthHandler
+	allow     []*net.IPNet
+	deny      []*net.IPNet
+	trusted   *gnomon.TrustedProxies
+	modTime   time.Time
+	lock      sync.RWMutex
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+// IPFilter IP访问控制过滤器
+//
+// 列表项或列表文件格式非法时返回错误
+func IPFilter(access *IPAccess) (Filter, error) {
+	if access.ReloadInterval == 0 {
+		access.ReloadInterval = 10 * time.Second
+	}
+	access.stop = make(chan struct{})
+	if err := access.Reload(); nil != err {
+		return nil, err
+	}
+	if access.File != "" && access.ReloadInterval > 0 {
+		go access.watch()
+	}
+	return access.filter, nil
+}
+
+func (ia *IPAccess) filter(ctx *Context) {
+	ia.lock.RLock()
+	var ip net.IP
+	if nil != ia.trusted {
+		ip = net.ParseIP(ia.trusted.Resolve(ctx.request).IP)
+	} else {
+		ip = net.ParseIP(ctx.ClientIP())
+	}
+	allowed := ia.allowed(ip)
+	ia.lock.RUnlock()
+	if allowed {
+		return
+	}
+	if nil != ia.Forbidden {
+		ia.Forbidden(ctx, ErrIPDenied)
+	}
+	if !ctx.responded {
+		ctx.responseMessage(http.StatusForbidden, ErrIPDenied.Error())
+	}
+}
+
+// Allowed IP是否允许访问
+func (ia *IPAccess) Allowed(ip string) bool {
+	ia.lock.RLock()
+	defer ia.lock.RUnlock()
+	return ia.allowed(net.ParseIP(ip))
+}
+
+func (ia *IPAccess) allowed(ip net.IP) bool {
+	if nil == ip {
+		return false
+	}
+	if containsIP(ia.deny, ip) {
+		return false
+	}
+	return len(ia.allow) == 0 || containsIP(ia.allow, ip)
+}
+
+// Reload 重新加载 Allow、Deny、TrustedProxies 及列表文件，任一项格式非法则保持原有列表不变
+func (ia *IPAccess) Reload() error {
+	allow, err := parseIPNets(ia.Allow)
+	if nil != err {
+		return err
+	}
+	deny, err := parseIPNets(ia.Deny)
+	if nil != err {
+		return err
+	}
+	var trusted *gnomon.TrustedProxies
+	if len(ia.TrustedProxies) > 0 {
+		if trusted, err = gnomon.NewTrustedProxies(ia.TrustedProxies...); nil != err {
+			return err
+		}
+	}
+	var modTime time.Time
+	if ia.File != "" {
+		fileAllow, fileDeny, err := readIPAccessFile(ia.File)
+		if nil != err {
+			return err
+		}
+		allow, deny = append(allow, fileAllow...), append(deny, fileDeny...)
+		modTime = fileModTime(ia.File)
+	}
+	ia.lock.Lock()
+	defer ia.lock.Unlock()
+	ia.allow, ia.deny, ia.trusted, ia.modTime = allow, deny, trusted, modTime
+	return nil
+}
+
+// Close 停止监听列表文件变化
+func (ia *IPAccess) Close() {
+	ia.stopOnce.Do(func() {
+		close(ia.stop)
+	})
+}
+
+// watch 定时检查列表文件修改时间，发生变化则重新加载
+func (ia *IPAccess) watch() {
+	ticker := time.NewTicker(ia.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ia.stop:
+			return
+		case <-ticker.C:
+			ia.lock.RLock()
+			changed := !fileModTime(ia.File).Equal(ia.modTime)
+			ia.lock.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := ia.Reload(); nil != err {
+				log.Error("IPAccess Reload", log.Field("file", ia.File), log.Err(err))
+			} else {
+				log.Info("IPAccess Reload", log.Field("file", ia.File))
+			}
+		}
+	}
+}
+
+// readIPAccessFile 读取访问控制列表文件
+func readIPAccessFile(filePath string) (allow, deny []*net.IPNet, err error) {
+	file, err := os.Open(filePath)
+	if nil != err {
+		return nil, nil, err
+	}
+	defer func() { _ = file.Close() }()
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if index := strings.Index(text, "#"); index >= 0 {
+			text = strings.TrimSpace(text[:index])
+		}
+		if text == "" {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, nil, fmt.Errorf("%s:%d: expect \"allow|deny <ip or cidr>\"", filePath, line)
+		}
+		ipNet, err := gnomon.IPNetParse(fields[1])
+		if nil != err {
+			return nil, nil, fmt.Errorf("%s:%d: %v", filePath, line, err)
+		}
+		switch strings.ToLower(fields[0]) {
+		case "allow":
+			allow = append(allow, ipNet)
+		case "deny":
+			deny = append(deny, ipNet)
+		default:
+			return nil, nil, fmt.Errorf("%s:%d: unknown action %q", filePath, line, fields[0])
+		}
+	}
+	return allow, deny, scanner.Err()
+}
+
+// parseIPNets 解析IP或CIDR网段数组
+func parseIPNets(cidrs []string) ([]*net.IPNet, error) {
+	var ipNets []*net.IPNet
+	for _, cidr := range cidrs {
+		ipNet, err := gnomon.IPNetParse(cidr)
+		if nil != err {
+			return nil, err
+		}
+		ipNets = append(ipNets, ipNet)
+	}
+	return ipNets, nil
+}
+
+// containsIP 网段数组是否包含IP
+func containsIP(ipNets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range ipNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
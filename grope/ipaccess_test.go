@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIPFilter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grope-ip")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	file := filepath.Join(dir, "ip.list")
+	if err = ioutil.WriteFile(file, []byte("# office\nallow 192.168.0.0/16\ndeny 192.168.1.1\n"), 0600); nil != err {
+		t.Fatal(err)
+	}
+	access := &IPAccess{
+		Allow:          []string{"10.0.0.0/8", "2001:db8::/32"},
+		TrustedProxies: []string{"172.16.0.1", "172.16.0.2"},
+		File:           file,
+		ReloadInterval: 20 * time.Millisecond,
+	}
+	filter, err := IPFilter(access)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer access.Close()
+	gs := NewHTTPServe(filter)
+	gs.Group("/ip").Get("/check", func(ctx *Context) {
+		_ = ctx.ResponseText(http.StatusOK, "ok")
+	})
+	gs.WaitRoutes()
+
+	do := func(remoteAddr, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/ip/check", nil)
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		rec := httptest.NewRecorder()
+		gs.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	cases := []struct {
+		remoteAddr   string
+		forwardedFor string
+		status       int
+	}{
+		{"10.1.2.3:1234", "", http.StatusOK},
+		{"[2001:db8::1]:1234", "", http.StatusOK},
+		{"[2001:db9::1]:1234", "", http.StatusForbidden},
+		{"192.168.2.1:1234", "", http.StatusOK},
+		{"192.168.1.1:1234", "", http.StatusForbidden},
+		{"8.8.8.8:1234", "10.0.0.1", http.StatusForbidden},             // 非可信代理，忽略X-Forwarded-For
+		{"172.16.0.1:1234", "10.0.0.1", http.StatusOK},                 // 可信代理转发
+		{"172.16.0.1:1234", "10.0.0.1, 8.8.8.8", http.StatusForbidden}, // 最右侧非可信地址为客户端
+		{"172.16.0.1:1234", "8.8.8.8, 10.0.0.1, 172.16.0.2", http.StatusOK},
+		{"172.16.0.1:1234", "garbage", http.StatusForbidden},
+	}
+	for index, c := range cases {
+		if status := do(c.remoteAddr, c.forwardedFor); status != c.status {
+			t.Errorf("case %d expect %d, got %d", index, c.status, status)
+		}
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if err = ioutil.WriteFile(file, []byte("deny 10.0.0.0/8\n"), 0600); nil != err {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50 && access.Allowed("10.1.2.3"); i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if do("10.1.2.3:1234", "") != http.StatusForbidden || do("192.168.2.1:1234", "") != http.StatusForbidden {
+		t.Errorf("expect reloaded list")
+	}
+
+	if _, err = IPFilter(&IPAccess{Allow: []string{"10.0.0.0/33"}}); nil == err {
+		t.Errorf("expect invalid cidr error")
+	}
+}
+
+func TestGHttpServe_SetTrustedProxies(t *testing.T) {
+	gs := NewHTTPServe()
+	if err := gs.SetTrustedProxies("10.0.0.0/8"); nil != err {
+		t.Fatal(err)
+	}
+	if err := gs.SetTrustedProxies("10.0.0.0/99"); nil == err {
+		t.Errorf("expect invalid cidr error")
+	}
+	gs.Group("/forwarded").Get("/check", func(ctx *Context) {
+		_ = ctx.ResponseText(http.StatusOK, ctx.ClientIP()+" "+ctx.Scheme()+" "+ctx.Host())
+	})
+	gs.WaitRoutes()
+
+	cases := []struct {
+		remoteAddr string
+		header     map[string]string
+		expect     string
+	}{
+		{"8.8.8.8:1234", map[string]string{"X-Forwarded-For": "1.1.1.1", "X-Forwarded-Proto": "https"}, "8.8.8.8 http example.com"},
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "1.1.1.1", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "api.example.com"}, "1.1.1.1 https api.example.com"},
+		{"10.0.0.1:1234", map[string]string{"Forwarded": `for="[2001:db8::1]:4711";proto=https;host=shop.example.com`}, "2001:db8::1 https shop.example.com"},
+	}
+	for index, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/forwarded/check", nil)
+		req.RemoteAddr = c.remoteAddr
+		for k, v := range c.header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		gs.ServeHTTP(rec, req)
+		if rec.Body.String() != c.expect {
+			t.Errorf("case %d expect %q, got %q", index, c.expect, rec.Body.String())
+		}
+	}
+}
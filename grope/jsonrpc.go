@@ -0,0 +1,347 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aberic/gnomon/grope/tune"
+	"github.com/aberic/gnomon/log"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// JSON-RPC 2.0 标准错误码
+const (
+	// JSONRPCParseError 请求不是合法的JSON
+	JSONRPCParseError = -32700
+	// JSONRPCInvalidRequest 请求不是合法的请求对象
+	JSONRPCInvalidRequest = -32600
+	// JSONRPCMethodNotFound 方法不存在
+	JSONRPCMethodNotFound = -32601
+	// JSONRPCInvalidParams 参数无效
+	JSONRPCInvalidParams = -32602
+	// JSONRPCInternalError 内部错误，如方法执行时发生panic
+	JSONRPCInternalError = -32603
+	// JSONRPCServerError 方法返回的非 *JSONRPCError 错误
+	JSONRPCServerError = -32000
+)
+
+var (
+	// ErrJSONRPCMethod invalid json-rpc method
+	ErrJSONRPCMethod = errors.New("invalid json-rpc method")
+
+	jsonrpcContextType = reflect.TypeOf((*Context)(nil))
+	jsonrpcErrorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// JSONRPCError JSON-RPC 错误对象，方法可以返回该错误以指定错误码及附加数据
+type JSONRPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *JSONRPCError) Error() string {
+	return fmt.Sprintf("json-rpc error %d: %s", e.Code, e.Message)
+}
+
+// JSONRPC JSON-RPC 2.0 方法注册表，通过 JSONRPCRouter 或 Handler 挂载到路由
+//
+// 支持批量请求及通知（不含id的请求，执行后不返回结果），仅支持按名称传递的参数（params为对象）；
+// 请求的Content-Type须为"application/json"，参数与 Context.ReceiveJSON 一样须为结构体并通过 tune.ValidateStruct 校验
+type JSONRPC struct {
+	MaxBatch int // 批量请求允许的最大请求数，0表示不限
+	lock     sync.RWMutex
+	methods  map[string]*jsonrpcMethod
+}
+
+// jsonrpcMethod 通过反射注册的方法
+type jsonrpcMethod struct {
+	fn      reflect.Value
+	context bool         // 第一个参数是否为 *Context
+	params  reflect.Type // 参数类型，nil表示无参数
+	result  bool         // 是否有返回值（除error外）
+}
+
+// jsonrpcRequest JSON-RPC 请求对象，ID 为nil表示通知
+type jsonrpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// jsonrpcResponse JSON-RPC 响应对象
+type jsonrpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *JSONRPCError   `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// NewJSONRPC 新建 JSON-RPC 方法注册表
+func NewJSONRPC() *JSONRPC {
+	return &JSONRPC{methods: map[string]*jsonrpcMethod{}}
+}
+
+// Register 注册方法，同名方法将被替换
+//
+// name 方法名称，如“user.get”，“rpc.”开头的名称为保留名称
+//
+// method 函数，形如“func([ctx *Context,] [params *T]) ([result R,] error)”，T 须为结构体，
+// 参数为指针时缺省的params以零值传入
+func (jr *JSONRPC) Register(name string, method interface{}) error {
+	if name == "" || strings.HasPrefix(name, "rpc.") {
+		return fmt.Errorf("%w: invalid name %q", ErrJSONRPCMethod, name)
+	}
+	fn := reflect.ValueOf(method)
+	if fn.Kind() != reflect.Func {
+		return fmt.Errorf("%w: %s is not a func", ErrJSONRPCMethod, name)
+	}
+	t, m, in := fn.Type(), &jsonrpcMethod{fn: fn}, 0
+	if t.NumIn() > in && t.In(in) == jsonrpcContextType {
+		m.context = true
+		in++
+	}
+	if t.NumIn() > in {
+		m.params = t.In(in)
+		if params := m.params; params.Kind() != reflect.Struct && (params.Kind() != reflect.Ptr || params.Elem().Kind() != reflect.Struct) {
+			return fmt.Errorf("%w: %s params must be a struct or a pointer to struct", ErrJSONRPCMethod, name)
+		}
+		in++
+	}
+	if t.NumIn() != in || t.IsVariadic() {
+		return fmt.Errorf("%w: %s accepts at most *Context and params", ErrJSONRPCMethod, name)
+	}
+	if (t.NumOut() != 1 && t.NumOut() != 2) || t.Out(t.NumOut()-1) != jsonrpcErrorType {
+		return fmt.Errorf("%w: %s must return ([result,] error)", ErrJSONRPCMethod, name)
+	}
+	m.result = t.NumOut() == 2
+	jr.lock.Lock()
+	defer jr.lock.Unlock()
+	if nil == jr.methods {
+		jr.methods = map[string]*jsonrpcMethod{}
+	}
+	jr.methods[name] = m
+	return nil
+}
+
+// Methods 已注册的方法名称，按名称排序
+func (jr *JSONRPC) Methods() []string {
+	jr.lock.RLock()
+	defer jr.lock.RUnlock()
+	var names []string
+	for name := range jr.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// JSONRPCRouter 在 router 的 pattern 路由注册“POST” JSON-RPC 端点
+//
+// filters 待实现拦截器/过滤器方法数组，如 JWTFilter
+func JSONRPCRouter(router *GHttpRouter, pattern string, rpc *JSONRPC, filters ...Filter) {
+	router.repo(http.MethodPost, pattern, nil, rpc.Handler(), nil, filters...)
+}
+
+// Handler JSON-RPC 端点处理方法
+//
+// 请求体解析失败及非法请求均以 JSON-RPC 错误对象返回200，仅包含通知的请求返回204，
+// Content-Type不是"application/json"时返回415
+func (jr *JSONRPC) Handler() Handler {
+	return func(ctx *Context) {
+		if !strings.Contains(ctx.request.Header.Get("Content-Type"), tune.ContentTypeJSON) {
+			ctx.responseMessage(http.StatusUnsupportedMediaType, tune.ErrContentType.Error())
+			return
+		}
+		body, err := ioutil.ReadAll(ctx.request.Body)
+		if nil != err {
+			if !ctx.bodyTooLarge {
+				ctx.responseMessage(http.StatusBadRequest, err.Error())
+			}
+			return
+		}
+		body = bytes.TrimSpace(body)
+		var resp interface{}
+		if len(body) > 0 && body[0] == '[' {
+			resp = jr.batch(ctx, body)
+		} else if r := jr.call(ctx, body); nil != r {
+			resp = r
+		}
+		if nil == resp {
+			ctx.responded = true
+			ctx.Status(http.StatusNoContent)
+			return
+		}
+		data, err := json.Marshal(resp)
+		if nil != err {
+			ctx.responseMessage(http.StatusInternalServerError, err.Error())
+			return
+		}
+		ctx.responded = true
+		ctx.HeaderSet("Content-Type", tune.ContentTypeJSON)
+		ctx.Status(http.StatusOK)
+		_ = ctx.response(data)
+	}
+}
+
+// batch 依次执行批量请求，返回nil表示全部为通知
+func (jr *JSONRPC) batch(ctx *Context, body []byte) interface{} {
+	var raws []json.RawMessage
+	if err := json.Unmarshal(body, &raws); nil != err {
+		return jsonrpcFailure(nil, JSONRPCParseError, err.Error())
+	}
+	if len(raws) == 0 {
+		return jsonrpcFailure(nil, JSONRPCInvalidRequest, "empty batch")
+	}
+	if jr.MaxBatch > 0 && len(raws) > jr.MaxBatch {
+		return jsonrpcFailure(nil, JSONRPCInvalidRequest, fmt.Sprintf("batch exceeds %d requests", jr.MaxBatch))
+	}
+	var resps []*jsonrpcResponse
+	for _, raw := range raws {
+		if resp := jr.call(ctx, raw); nil != resp {
+			resps = append(resps, resp)
+		}
+	}
+	if len(resps) == 0 {
+		return nil
+	}
+	return resps
+}
+
+// call 执行单个请求，通知返回nil
+func (jr *JSONRPC) call(ctx *Context, raw []byte) *jsonrpcResponse {
+	if !json.Valid(raw) {
+		return jsonrpcFailure(nil, JSONRPCParseError, "invalid json")
+	}
+	if raw = bytes.TrimSpace(raw); raw[0] != '{' {
+		return jsonrpcFailure(nil, JSONRPCInvalidRequest, "request must be an object")
+	}
+	req := &jsonrpcRequest{}
+	if err := json.Unmarshal(raw, req); nil != err {
+		return jsonrpcFailure(nil, JSONRPCInvalidRequest, "jsonrpc and method must be strings")
+	}
+	if !validJSONRPCID(req.ID) {
+		return jsonrpcFailure(nil, JSONRPCInvalidRequest, "id must be a string, number or null")
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return jsonrpcFailure(req.ID, JSONRPCInvalidRequest, `jsonrpc must be "2.0" and method is required`)
+	}
+	result, rpcErr := jr.invoke(ctx, req)
+	if nil == req.ID { // 通知不返回结果及错误
+		return nil
+	}
+	if nil != rpcErr {
+		return &jsonrpcResponse{JSONRPC: "2.0", Error: rpcErr, ID: req.ID}
+	}
+	return &jsonrpcResponse{JSONRPC: "2.0", Result: result, ID: req.ID}
+}
+
+// invoke 解析并校验参数后执行方法
+func (jr *JSONRPC) invoke(ctx *Context, req *jsonrpcRequest) (result json.RawMessage, rpcErr *JSONRPCError) {
+	jr.lock.RLock()
+	m, ok := jr.methods[req.Method]
+	jr.lock.RUnlock()
+	if !ok {
+		return nil, &JSONRPCError{Code: JSONRPCMethodNotFound, Message: fmt.Sprintf("method %q not found", req.Method)}
+	}
+	var args []reflect.Value
+	if m.context {
+		args = append(args, reflect.ValueOf(ctx))
+	}
+	if nil != m.params {
+		params, err := m.parse(req.Params)
+		if nil != err {
+			return nil, &JSONRPCError{Code: JSONRPCInvalidParams, Message: err.Error()}
+		}
+		args = append(args, params)
+	}
+	defer func() {
+		if r := recover(); nil != r {
+			log.Error("json-rpc method panic", log.Field("method", req.Method), log.Field("panic", fmt.Sprint(r)))
+			result, rpcErr = nil, &JSONRPCError{Code: JSONRPCInternalError, Message: "internal error"}
+		}
+	}()
+	outs := m.fn.Call(args)
+	if err, _ := outs[len(outs)-1].Interface().(error); nil != err {
+		var target *JSONRPCError
+		if errors.As(err, &target) {
+			return nil, target
+		}
+		return nil, &JSONRPCError{Code: JSONRPCServerError, Message: err.Error()}
+	}
+	result = json.RawMessage("null")
+	if m.result {
+		data, err := json.Marshal(outs[0].Interface())
+		if nil != err {
+			return nil, &JSONRPCError{Code: JSONRPCInternalError, Message: err.Error()}
+		}
+		result = data
+	}
+	return result, nil
+}
+
+// parse 将按名称传递的参数解析为方法参数类型，并执行与 Context.ReceiveJSON 相同的结构体校验
+func (m *jsonrpcMethod) parse(raw json.RawMessage) (reflect.Value, error) {
+	ptr := m.params.Kind() == reflect.Ptr
+	t := m.params
+	if ptr {
+		t = t.Elem()
+	}
+	params := reflect.New(t)
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && !bytes.Equal(trimmed, []byte("null")) {
+		if trimmed[0] != '{' {
+			return reflect.Value{}, errors.New("params must be an object")
+		}
+		if err := json.Unmarshal(trimmed, params.Interface()); nil != err {
+			return reflect.Value{}, err
+		}
+	}
+	if err := tune.ValidateStruct(params.Interface()); nil != err {
+		return reflect.Value{}, err
+	}
+	if ptr {
+		return params, nil
+	}
+	return params.Elem(), nil
+}
+
+// validJSONRPCID id是否为字符串、数字或null，nil表示通知
+func validJSONRPCID(id json.RawMessage) bool {
+	if nil == id {
+		return true
+	}
+	switch id[0] {
+	case '"', 'n', '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return true
+	}
+	return false
+}
+
+// jsonrpcFailure 新建错误响应，id为nil时返回null
+func jsonrpcFailure(id json.RawMessage, code int, message string) *jsonrpcResponse {
+	if nil == id {
+		id = json.RawMessage("null")
+	}
+	return &jsonrpcResponse{JSONRPC: "2.0", Error: &JSONRPCError{Code: code, Message: message}, ID: id}
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+type rpcAddParams struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+func TestJSONRPC_Register(t *testing.T) {
+	rpc := NewJSONRPC()
+	for name, method := range map[string]interface{}{
+		"":          func() error { return nil },
+		"rpc.ping":  func() error { return nil },
+		"notFunc":   "ping",
+		"intParams": func(a int) error { return nil },
+		"tooMany":   func(ctx *Context, a, b *rpcAddParams) error { return nil },
+		"noError":   func() int { return 0 },
+		"twoResult": func() (int, int, error) { return 0, 0, nil },
+	} {
+		if err := rpc.Register(name, method); !errors.Is(err, ErrJSONRPCMethod) {
+			t.Errorf("%q: expect ErrJSONRPCMethod, got %v", name, err)
+		}
+	}
+	for name, method := range map[string]interface{}{
+		"ping":      func() error { return nil },
+		"ctx":       func(ctx *Context) (string, error) { return "", nil },
+		"value":     func(p rpcAddParams) (int, error) { return 0, nil },
+		"ctxParams": func(ctx *Context, p *rpcAddParams) error { return nil },
+	} {
+		if err := rpc.Register(name, method); nil != err {
+			t.Errorf("%q: %v", name, err)
+		}
+	}
+	if methods := rpc.Methods(); !reflect.DeepEqual(methods, []string{"ctx", "ctxParams", "ping", "value"}) {
+		t.Errorf("unexpected methods %v", methods)
+	}
+}
+
+func TestJSONRPCRouter(t *testing.T) {
+	rpc := &JSONRPC{MaxBatch: 3}
+	notified := 0
+	_ = rpc.Register("math.add", func(p *rpcAddParams) (int, error) { return p.A + p.B, nil })
+	_ = rpc.Register("math.div", func(p rpcAddParams) (int, error) {
+		if p.B == 0 {
+			return 0, &JSONRPCError{Code: 1001, Message: "division by zero", Data: p.A}
+		}
+		return p.A / p.B, nil
+	})
+	_ = rpc.Register("notify", func() error { notified++; return nil })
+	_ = rpc.Register("fail", func() error { return errors.New("boom") })
+	_ = rpc.Register("panic", func() error { panic("boom") })
+	_ = rpc.Register("client", func(ctx *Context) (string, error) { return ctx.HeaderGet("X-Client"), nil })
+	gs := NewHTTPServe()
+	JSONRPCRouter(gs.Group("/rpc"), "/v1", rpc)
+	client := NewTestClient(gs)
+	call := func(body string, expect string) {
+		t.Helper()
+		client.Post("/rpc/v1").Text(body).Header("Content-Type", "application/json").Header("X-Client", "c1").
+			MustDo(t).AssertStatus(t, http.StatusOK).AssertText(t, expect)
+	}
+
+	call(`{"jsonrpc":"2.0","method":"math.add","params":{"a":1,"b":2},"id":1}`,
+		`{"jsonrpc":"2.0","result":3,"id":1}`)
+	call(`{"jsonrpc":"2.0","method":"math.add","id":"a"}`, `{"jsonrpc":"2.0","result":0,"id":"a"}`)
+	call(`{"jsonrpc":"2.0","method":"client","id":null}`, `{"jsonrpc":"2.0","result":"c1","id":null}`)
+	call(`{"jsonrpc":"2.0","method":"notify","id":2}`, `{"jsonrpc":"2.0","result":null,"id":2}`)
+	call(`{"jsonrpc":"2.0","method":"math.div","params":{"a":1,"b":0},"id":3}`,
+		`{"jsonrpc":"2.0","error":{"code":1001,"message":"division by zero","data":1},"id":3}`)
+	call(`{"jsonrpc":"2.0","method":"fail","id":4}`, `{"jsonrpc":"2.0","error":{"code":-32000,"message":"boom"},"id":4}`)
+	call(`{"jsonrpc":"2.0","method":"panic","id":5}`, `{"jsonrpc":"2.0","error":{"code":-32603,"message":"internal error"},"id":5}`)
+	call(`{"jsonrpc":"2.0","method":"missing","id":6}`, `{"jsonrpc":"2.0","error":{"code":-32601,"message":"method \"missing\" not found"},"id":6}`)
+	call(`{"jsonrpc":"2.0","method":"math.add","params":[1,2],"id":7}`,
+		`{"jsonrpc":"2.0","error":{"code":-32602,"message":"params must be an object"},"id":7}`)
+	call(`{"jsonrpc":"2.0","method":"math.add","params":{"a":"1"},"id":8}`,
+		`{"jsonrpc":"2.0","error":{"code":-32602,"message":"json: cannot unmarshal string into Go struct field rpcAddParams.a of type int"},"id":8}`)
+	call(`{"jsonrpc":"1.0","method":"math.add","id":9}`,
+		`{"jsonrpc":"2.0","error":{"code":-32600,"message":"jsonrpc must be \"2.0\" and method is required"},"id":9}`)
+	call(`{"jsonrpc":"2.0","method":"math.add","id":{}}`,
+		`{"jsonrpc":"2.0","error":{"code":-32600,"message":"id must be a string, number or null"},"id":null}`)
+	call(`{"jsonrpc":"2.0","method":1,"id":10}`,
+		`{"jsonrpc":"2.0","error":{"code":-32600,"message":"jsonrpc and method must be strings"},"id":null}`)
+	call(`{"jsonrpc":"2.0","method"`, `{"jsonrpc":"2.0","error":{"code":-32700,"message":"invalid json"},"id":null}`)
+
+	// 批量请求，通知不返回结果
+	call(`[{"jsonrpc":"2.0","method":"math.add","params":{"a":1,"b":1},"id":1},{"jsonrpc":"2.0","method":"notify"},1]`,
+		`[{"jsonrpc":"2.0","result":2,"id":1},{"jsonrpc":"2.0","error":{"code":-32600,"message":"request must be an object"},"id":null}]`)
+	call(`[]`, `{"jsonrpc":"2.0","error":{"code":-32600,"message":"empty batch"},"id":null}`)
+	call(`[1,2,3,4]`, `{"jsonrpc":"2.0","error":{"code":-32600,"message":"batch exceeds 3 requests"},"id":null}`)
+	notified = 0
+	client.Post("/rpc/v1").JSON(&[]map[string]string{{"jsonrpc": "2.0", "method": "notify"}, {"jsonrpc": "2.0", "method": "fail"}}).
+		MustDo(t).AssertStatus(t, http.StatusNoContent).AssertText(t, "")
+	if notified != 1 {
+		t.Errorf("expect notified once, got %d", notified)
+	}
+
+	client.Post("/rpc/v1").Text(`{"jsonrpc":"2.0","method":"math.add","id":1}`).MustDo(t).AssertStatus(t, http.StatusUnsupportedMediaType)
+}
@@ -15,6 +15,7 @@
 package grope
 
 import (
+	"sync"
 	"time"
 )
 
@@ -25,11 +26,14 @@ type Limit struct {
 	LimitIntervalMillisecond int64         // 请求允许的最小间隔时间（毫秒），0表示不限
 	limitChan                chan struct{} // 限流通道
 	times                    []int64       // 请求时间数组
+	stop                     chan struct{}
+	stopOnce                 sync.Once
 }
 
 // new 新建限流策略
 func (l *Limit) init() {
 	l.limitChan = make(chan struct{}, l.LimitCount)
+	l.stop = make(chan struct{})
 	l.times = []int64{}
 	for i := 0; i < l.LimitCount; i++ {
 		time.Sleep(10 * time.Nanosecond)
@@ -42,14 +46,42 @@ func (l *Limit) limit() {
 		timeNow := time.Now().UnixNano() / 1e6
 		// 如果当前时间与时间数组第一时间差大于限定时间段，并且当前时间与时间数组最后时间差大于最小请求间隔，则放行新的请求
 		if timeNow-l.times[0] > l.LimitMillisecond && timeNow-l.times[len(l.times)-1] > l.LimitIntervalMillisecond {
-			<-l.limitChan // 取出一个元素，放行
-			l.resetTimes(time.Now().UnixNano() / 1e6)
+			select {
+			case <-l.limitChan: // 取出一个元素，放行
+				l.resetTimes(time.Now().UnixNano() / 1e6)
+			case <-l.stop:
+				return
+			}
 		} else {
-			time.Sleep(10 * time.Nanosecond)
+			select {
+			case <-l.stop:
+				return
+			default:
+				time.Sleep(10 * time.Nanosecond)
+			}
 		}
 	}
 }
 
+// acquire 尝试占用一个请求名额，名额已满时返回false
+func (l *Limit) acquire() bool {
+	select {
+	case l.limitChan <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// close 停止限流，路由被替换后调用
+func (l *Limit) close() {
+	l.stopOnce.Do(func() {
+		if nil != l.stop {
+			close(l.stop)
+		}
+	})
+}
+
 // add 新增一个元素
 func (l *Limit) add(time int64) {
 	if len(l.times) < l.LimitCount {
@@ -66,3 +98,36 @@ func (l *Limit) resetTimes(time int64) {
 	l.times = l.times[1:]
 	l.times = append(l.times, time)
 }
+
+// setLimit 替换路由限流策略，limit为nil表示移除限流，原限流策略随即停止
+//
+// 持有路由树写锁复制并原子替换扩展方案，处理中的请求继续使用替换前的扩展方案
+func (n *node) setLimit(limit *Limit) {
+	n.lock.Lock()
+	extend := &Extend{}
+	if current := n.extension(); nil != current {
+		*extend = *current
+	}
+	old := extend.Limit
+	if nil != limit {
+		limit.init()
+		go limit.limit()
+	}
+	extend.Limit = limit
+	n.extend.Store(extend)
+	n.lock.Unlock()
+	if nil != old {
+		old.close()
+	}
+}
+
+// closeLimits 停止服务及其虚拟主机中全部路由的限流，服务被替换后调用
+func (ghs *GHttpServe) closeLimits() {
+	for _, serve := range ghs.serves() {
+		serve.nodal.walk(func(nd *node) {
+			if extend := nd.extension(); nil != extend && nil != extend.Limit {
+				extend.Limit.close()
+			}
+		})
+	}
+}
@@ -15,6 +15,9 @@
 package grope
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -39,3 +42,63 @@ func loop(limit *Limit, t *testing.T) {
 		//time.Sleep(100 * time.Millisecond)
 	}
 }
+
+func TestNodeSetLimit(t *testing.T) {
+	root := newNode()
+	root.add("/a", http.MethodGet, &Extend{MaxBodySize: 10}, func(ctx *Context) {}, nil)
+	nd, _ := root.fetch("/a", http.MethodGet)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			if _, limited := root.fetch("/a", http.MethodGet); limited {
+				continue
+			}
+			if extend := nd.extension(); nil == extend || extend.MaxBodySize != 10 {
+				t.Errorf("unexpected extend %+v", extend)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		nd.setLimit(&Limit{LimitMillisecond: 1000, LimitCount: 1000})
+		nd.setLimit(nil)
+	}
+	<-done
+	if extend := nd.extension(); nil != extend.Limit || extend.MaxBodySize != 10 {
+		t.Errorf("expect limit removed and max body size kept, got %+v", extend)
+	}
+}
+
+func TestLimitPerRequest(t *testing.T) {
+	gs := NewHTTPServe()
+	router := gs.Group("/limit")
+	router.Gets("/a", &Extend{Limit: &Limit{LimitMillisecond: 60000, LimitCount: 1}}, func(ctx *Context) {
+		ctx.ResponseText(http.StatusOK, "a")
+	})
+	router.Get("/b", func(ctx *Context) {
+		ctx.ResponseText(http.StatusOK, "b")
+	})
+	gs.WaitRoutes()
+	request := func(pattern string) string {
+		rec := httptest.NewRecorder()
+		gs.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, pattern, nil))
+		return rec.Body.String()
+	}
+	if body := request("/limit/a"); body != "a" {
+		t.Fatalf("expect first request passed, got %s", body)
+	}
+	if body := request("/limit/a"); !strings.Contains(body, "request limit") {
+		t.Fatalf("expect second request limited, got %s", body)
+	}
+	if body := request("/limit/b"); body != "b" {
+		t.Errorf("expect unlimited route passed, got %s", body)
+	}
+	nd, _ := gs.nodal.fetch("/limit/a", http.MethodGet)
+	nd.setLimit(nil)
+	for i := 0; i < 3; i++ {
+		if body := request("/limit/a"); body != "a" {
+			t.Errorf("expect request passed after limit removed, got %s", body)
+		}
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 func newNode(filters ...Filter) *node {
@@ -28,6 +29,8 @@ func newNode(filters ...Filter) *node {
 		root:      true,
 		filters:   filters,
 		nextNodes: []*node{},
+		lock:      &sync.RWMutex{},
+		pending:   &sync.WaitGroup{},
 	}
 }
 
@@ -38,6 +41,8 @@ func nextNode(n *node, patternPiece string) *node {
 		filters:      n.filters,
 		preNode:      n,
 		nextNodes:    []*node{},
+		lock:         n.lock,
+		pending:      n.pending,
 	}
 }
 
@@ -48,16 +53,14 @@ type node struct {
 	method       string   // eg:http.MethodGet
 	handler      Handler  // 待实现接收请求方法
 	filters      []Filter // 过滤器/拦截器数组
-	extend       *Extend  // 扩展方案，如限流等
-	error        *struct {
-		Message string `json:"message"`
-	}
-	preNode   *node
-	nextNodes []*node
+	preNode      *node
+	nextNodes    []*node
 
-	proxy *Proxy // 请求代理结构
+	extend atomic.Value // *Extend 扩展方案，如限流等，可通过 setLimit 在运行时替换，使用 extension 获取
+	proxy  *Proxy       // 请求代理结构
 
-	lockNode sync.Mutex
+	lock    *sync.RWMutex   // 路由树读写锁，由根结点创建并在所有子结点间共享
+	pending *sync.WaitGroup // 尚未完成的异步路由注册，与 lock 一样在路由树中共享
 }
 
 // add
@@ -74,6 +77,8 @@ func (n *node) add(pattern, method string, extend *Extend, handler Handler, prox
 	if pattern[0] != '/' {
 		panic("path must begin with '/'")
 	}
+	n.lock.Lock()
+	defer n.lock.Unlock()
 	patternSplitArr := strings.Split(pattern, "/")[1:]                                 // [a, b, :c, d, :e, :f, g]
 	n.addFunc(pattern, method, patternSplitArr, 0, extend, handler, proxy, filters...) // 默认splitArr从0开始解析
 }
@@ -121,9 +126,7 @@ func (n *node) addFunc(pattern, method string, patternSplitArr []string, index i
 		}
 	}
 	nextNode := nextNode(n, patternPiece)
-	n.lockNode.Lock()
 	n.nextNodes = append(n.nextNodes, nextNode)
-	n.lockNode.Unlock()
 	nextNode.addSplitArr(pattern, method, patternSplitArr, index, extend, handler, proxy, filters...)
 }
 
@@ -135,17 +138,20 @@ func (n *node) fill(pattern, method string, extend *Extend, handler Handler, pro
 	n.filters = append(n.filters, filters...)
 	n.pattern = pattern
 	n.method = method
-	n.extend = extend
+	n.extend.Store(extend)
 	n.handler = handler
 	if nil != proxy && nil != proxy.Target {
+		if err := proxy.init(); nil != err {
+			log.Error("proxy init", log.Field("pattern", pattern), log.Err(err))
+		}
 		n.proxy = proxy
 	}
 	if gnomon.StringIsNotEmpty(method) {
 		fmt.Printf("grope url %s %s \n", method, pattern)
 	}
 	if nil != extend && nil != extend.Limit {
-		n.extend.Limit.init()
-		go n.extend.Limit.limit()
+		extend.Limit.init()
+		go extend.Limit.limit()
 	}
 }
 
@@ -154,27 +160,25 @@ func (n *node) fill(pattern, method string, extend *Extend, handler Handler, pro
 // pattern /a/b/:c/d/:e/:f/g
 //
 // method eg:http.MethodGet
-func (n *node) fetch(pattern, method string) *node {
+//
+// limited 路由配置了限流策略且当前请求被限流
+func (n *node) fetch(pattern, method string) (nodal *node, limited bool) {
 	if !n.root {
 		panic("only root can fetch node")
 	}
 	if pattern[0] != '/' {
 		panic("path must begin with '/'")
 	}
-	patternSplitArr := strings.Split(pattern, "/")[1:] // [a, b, :c, d, :e, :f, g]
-	nodal := n.fetchSplitArr(pattern, method, patternSplitArr, 0)
-	if nil != nodal && nil != nodal.extend && nil != nodal.extend.Limit {
-		if len(nodal.extend.Limit.limitChan) >= nodal.extend.Limit.LimitCount {
-			nodal.error = &struct {
-				Message string `json:"message"`
-			}{
-				Message: "request limit, please retry later",
-			}
-		} else {
-			nodal.extend.Limit.limitChan <- struct{}{}
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	patternSplitArr := strings.Split(pattern, "/")[1:]           // [a, b, :c, d, :e, :f, g]
+	nodal = n.fetchSplitArr(pattern, method, patternSplitArr, 0) // 默认splitArr从0开始解析
+	if nil != nodal {
+		if extend := nodal.extension(); nil != extend && nil != extend.Limit {
+			limited = !extend.Limit.acquire()
 		}
 	}
-	return nodal // 默认splitArr从0开始解析
+	return
 }
 
 // fetchFunc
@@ -191,31 +195,18 @@ func (n *node) fetchSplitArr(pattern string, method string, patternSplitArr []st
 	index++
 	nChanStaticPiece := make(chan *node)
 	nChanDynamicPiece := make(chan *node)
-	count := 2
 	go func() {
 		nChanStaticPiece <- n.fetchFuncAsync(pattern, patternPiece, method, patternSplitArr, index)
 	}()
 	go func() {
 		nChanDynamicPiece <- n.fetchFuncAsync(pattern, "?", method, patternSplitArr, index)
 	}()
-	for {
-		select {
-		case nd := <-nChanStaticPiece:
-			count--
-			if nil != nd {
-				return nd
-			} else if count == 0 {
-				return nil
-			}
-		case nd := <-nChanDynamicPiece:
-			count--
-			if nil != nd {
-				return nd
-			} else if count == 0 {
-				return nil
-			}
-		}
+	// 等待两侧查找均结束，确保返回后不再读取路由树，静态路由优先
+	staticNode, dynamicNode := <-nChanStaticPiece, <-nChanDynamicPiece
+	if nil != staticNode {
+		return staticNode
 	}
+	return dynamicNode
 }
 
 func (n *node) fetchFuncAsync(pattern, patternPiece string, method string, patternSplitArr []string, index int) *node {
@@ -235,6 +226,26 @@ func (n *node) fetchFuncAsync(pattern, patternPiece string, method string, patte
 	return nil
 }
 
+// walk 遍历当前结点及所有子结点，遍历期间持有路由树读锁，f 中不能注册路由
+func (n *node) walk(f func(nd *node)) {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	n.walkNodes(f)
+}
+
+func (n *node) walkNodes(f func(nd *node)) {
+	f(n)
+	for _, nd := range n.nextNodes {
+		nd.walkNodes(f)
+	}
+}
+
+// extension 获取路由扩展方案，未设置则返回nil
+func (n *node) extension() *Extend {
+	extend, _ := n.extend.Load().(*Extend)
+	return extend
+}
+
 // parseHandler 解析请求处理方法
 func (n *node) parseHandler(ctx *Context) {
 	defer func() {
@@ -244,7 +255,7 @@ func (n *node) parseHandler(ctx *Context) {
 		}
 	}()
 	if nil != n.proxy {
-		// todo 反向代理
+		n.proxy.serve(ctx)
 	} else {
 		n.handler(ctx)
 	}
@@ -0,0 +1,358 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"encoding/json"
+	"github.com/aberic/gnomon"
+	"github.com/aberic/gnomon/grope/tune"
+	"gopkg.in/yaml.v3"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Doc 路由文档描述，用于生成OpenAPI文档
+type Doc struct {
+	Summary            string              // 概要
+	Description        string              // 详细描述
+	Tags               []string            // 分组标签
+	Request            interface{}         // 请求体结构，如“&Test{}”
+	RequestContentType string              // 请求体内容类型，默认“application/json”
+	Responses          map[int]interface{} // 状态码对应的响应结构，如“{200: &Test{}}”，值为nil表示无响应体
+	Params             []*DocParam         // 请求参数，路径中的“:id”参数未声明时自动生成
+	Deprecated         bool                // 是否已废弃
+	hidden             bool                // 是否在文档中隐藏，如文档路由本身
+}
+
+// DocParam 路由请求参数描述
+type DocParam struct {
+	Name        string // 参数名
+	In          string // 参数位置，可选“query”、“header”、“path”、“cookie”，默认“query”
+	Description string // 参数描述
+	Type        string // 参数类型，如“string”、“integer”、“number”、“boolean”，默认“string”
+	Required    bool   // 是否必填，路径参数始终必填
+}
+
+// OpenAPIInfo OpenAPI文档基本信息
+type OpenAPIInfo struct {
+	Title       string `json:"title" yaml:"title"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Version     string `json:"version" yaml:"version"`
+}
+
+// OpenAPIServer OpenAPI服务地址
+type OpenAPIServer struct {
+	URL         string `json:"url" yaml:"url"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// OpenAPI OpenAPI 3 文档
+type OpenAPI struct {
+	OpenAPI    string                                  `json:"openapi" yaml:"openapi"`
+	Info       *OpenAPIInfo                            `json:"info" yaml:"info"`
+	Servers    []*OpenAPIServer                        `json:"servers,omitempty" yaml:"servers,omitempty"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths" yaml:"paths"`
+	Components *OpenAPIComponents                      `json:"components,omitempty" yaml:"components,omitempty"`
+}
+
+// OpenAPIOperation OpenAPI请求操作
+type OpenAPIOperation struct {
+	Summary     string                      `json:"summary,omitempty" yaml:"summary,omitempty"`
+	Description string                      `json:"description,omitempty" yaml:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Parameters  []*OpenAPIParameter         `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	RequestBody *OpenAPIBody                `json:"requestBody,omitempty" yaml:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses" yaml:"responses"`
+	Deprecated  bool                        `json:"deprecated,omitempty" yaml:"deprecated,omitempty"`
+	Host        string                      `json:"x-host,omitempty" yaml:"x-host,omitempty"` // 虚拟主机匹配规则，服务本身的路由为空
+}
+
+// OpenAPIParameter OpenAPI请求参数
+type OpenAPIParameter struct {
+	Name        string         `json:"name" yaml:"name"`
+	In          string         `json:"in" yaml:"in"`
+	Description string         `json:"description,omitempty" yaml:"description,omitempty"`
+	Required    bool           `json:"required,omitempty" yaml:"required,omitempty"`
+	Schema      *OpenAPISchema `json:"schema" yaml:"schema"`
+}
+
+// OpenAPIBody OpenAPI请求体
+type OpenAPIBody struct {
+	Required bool                         `json:"required,omitempty" yaml:"required,omitempty"`
+	Content  map[string]*OpenAPIMediaType `json:"content" yaml:"content"`
+}
+
+// OpenAPIResponse OpenAPI响应
+type OpenAPIResponse struct {
+	Description string                       `json:"description" yaml:"description"`
+	Content     map[string]*OpenAPIMediaType `json:"content,omitempty" yaml:"content,omitempty"`
+}
+
+// OpenAPIMediaType OpenAPI内容类型
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema" yaml:"schema"`
+}
+
+// OpenAPIComponents OpenAPI公共组件
+type OpenAPIComponents struct {
+	Schemas map[string]*OpenAPISchema `json:"schemas,omitempty" yaml:"schemas,omitempty"`
+}
+
+// OpenAPISchema OpenAPI数据结构
+type OpenAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty" yaml:"type,omitempty"`
+	Format               string                    `json:"format,omitempty" yaml:"format,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty" yaml:"items,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty" yaml:"properties,omitempty"`
+	AdditionalProperties *OpenAPISchema            `json:"additionalProperties,omitempty" yaml:"additionalProperties,omitempty"`
+	Required             []string                  `json:"required,omitempty" yaml:"required,omitempty"`
+	Nullable             bool                      `json:"nullable,omitempty" yaml:"nullable,omitempty"`
+}
+
+// OpenAPI 根据服务及其虚拟主机中已注册的路由生成OpenAPI 3文档，虚拟主机的路由通过“x-host”标注所属主机
+//
+// 不同主机中路径及请求方法均相同的路由只保留一个，服务本身的路由优先，其次按虚拟主机匹配规则排序，
+// 此时可通过虚拟主机的 OpenAPI 方法为其单独生成文档
+//
+// info 文档基本信息
+//
+// servers 服务地址，如“https://api.example.com”
+func (ghs *GHttpServe) OpenAPI(info *OpenAPIInfo, servers ...string) *OpenAPI {
+	doc := &OpenAPI{
+		OpenAPI:    "3.0.3",
+		Info:       info,
+		Paths:      map[string]map[string]*OpenAPIOperation{},
+		Components: &OpenAPIComponents{Schemas: map[string]*OpenAPISchema{}},
+	}
+	for _, server := range servers {
+		doc.Servers = append(doc.Servers, &OpenAPIServer{URL: server})
+	}
+	for _, serve := range ghs.serves() {
+		serve.nodal.walk(func(nd *node) {
+			if gnomon.StringIsEmpty(nd.method) || nd.method == http.MethodConnect || nd.method == http.MethodTrace {
+				return
+			}
+			var routeDoc *Doc
+			if extend := nd.extension(); nil != extend {
+				routeDoc = extend.Doc
+			}
+			if nil != routeDoc && routeDoc.hidden {
+				return
+			}
+			path, op := openAPIOperation(nd.pattern, routeDoc, doc.Components.Schemas)
+			method := strings.ToLower(nd.method)
+			if nil == doc.Paths[path] {
+				doc.Paths[path] = map[string]*OpenAPIOperation{}
+			} else if _, exist := doc.Paths[path][method]; exist {
+				return
+			}
+			op.Host = serve.host
+			doc.Paths[path][method] = op
+		})
+	}
+	if len(doc.Components.Schemas) == 0 {
+		doc.Components = nil
+	}
+	return doc
+}
+
+// OpenAPIRoute 注册OpenAPI文档路由
+//
+// pattern 文档路由，如“/openapi.json”，以“.yaml”或“.yml”结尾时返回YAML格式，否则返回JSON格式
+//
+// info 文档基本信息
+//
+// servers 服务地址，如“https://api.example.com”
+func (ghs *GHttpServe) OpenAPIRoute(pattern string, info *OpenAPIInfo, servers ...string) {
+	yamlFormat := strings.HasSuffix(pattern, ".yaml") || strings.HasSuffix(pattern, ".yml")
+	ghs.nodal.add(pattern, http.MethodGet, &Extend{Doc: &Doc{hidden: true}}, func(ctx *Context) {
+		doc := ghs.OpenAPI(info, servers...)
+		var (
+			data []byte
+			err  error
+		)
+		if yamlFormat {
+			data, err = yaml.Marshal(doc)
+			ctx.HeaderSet("Content-Type", tune.ContentTypeYaml)
+		} else {
+			data, err = json.Marshal(doc)
+			ctx.HeaderSet("Content-Type", tune.ContentTypeJSON)
+		}
+		if nil != err {
+			ctx.responseMessage(http.StatusInternalServerError, err.Error())
+			return
+		}
+		ctx.responded = true
+		ctx.Status(http.StatusOK)
+		_ = ctx.response(data)
+	}, nil)
+}
+
+// openAPIOperation 根据路由及文档描述生成请求操作，返回OpenAPI格式的路径，如“/demo/{id}”
+func openAPIOperation(pattern string, doc *Doc, schemas map[string]*OpenAPISchema) (string, *OpenAPIOperation) {
+	if nil == doc {
+		doc = &Doc{}
+	}
+	var (
+		op       = &OpenAPIOperation{Summary: doc.Summary, Description: doc.Description, Tags: doc.Tags, Deprecated: doc.Deprecated}
+		pieces   = strings.Split(pattern, "/")
+		declared = map[string]bool{}
+	)
+	for _, param := range doc.Params {
+		in := param.In
+		if in == "" {
+			in = "query"
+		}
+		declared[in+":"+param.Name] = true
+		paramType := param.Type
+		if paramType == "" {
+			paramType = "string"
+		}
+		op.Parameters = append(op.Parameters, &OpenAPIParameter{
+			Name:        param.Name,
+			In:          in,
+			Description: param.Description,
+			Required:    param.Required || in == "path",
+			Schema:      &OpenAPISchema{Type: paramType},
+		})
+	}
+	for index, piece := range pieces {
+		if strings.HasPrefix(piece, ":") {
+			name := piece[1:]
+			pieces[index] = "{" + name + "}"
+			if !declared["path:"+name] {
+				op.Parameters = append(op.Parameters, &OpenAPIParameter{
+					Name: name, In: "path", Required: true, Schema: &OpenAPISchema{Type: "string"},
+				})
+			}
+		}
+	}
+	if nil != doc.Request {
+		contentType := doc.RequestContentType
+		if contentType == "" {
+			contentType = tune.ContentTypeJSON
+		}
+		op.RequestBody = &OpenAPIBody{Required: true, Content: map[string]*OpenAPIMediaType{
+			contentType: {Schema: openAPISchemaOf(reflect.TypeOf(doc.Request), schemas)},
+		}}
+	}
+	op.Responses = map[string]*OpenAPIResponse{}
+	if len(doc.Responses) == 0 {
+		op.Responses["default"] = &OpenAPIResponse{Description: "default response"}
+	}
+	for statusCode, model := range doc.Responses {
+		response := &OpenAPIResponse{Description: http.StatusText(statusCode)}
+		if response.Description == "" {
+			response.Description = strconv.Itoa(statusCode)
+		}
+		if nil != model {
+			response.Content = map[string]*OpenAPIMediaType{
+				tune.ContentTypeJSON: {Schema: openAPISchemaOf(reflect.TypeOf(model), schemas)},
+			}
+		}
+		op.Responses[strconv.Itoa(statusCode)] = response
+	}
+	return strings.Join(pieces, "/"), op
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// openAPISchemaOf 根据类型生成数据结构，具名结构体写入公共组件并返回引用
+func openAPISchemaOf(t reflect.Type, schemas map[string]*OpenAPISchema) *OpenAPISchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return &OpenAPISchema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &OpenAPISchema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &OpenAPISchema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &OpenAPISchema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &OpenAPISchema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &OpenAPISchema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &OpenAPISchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &OpenAPISchema{Type: "string", Format: "byte"}
+		}
+		return &OpenAPISchema{Type: "array", Items: openAPISchemaOf(t.Elem(), schemas)}
+	case reflect.Map:
+		return &OpenAPISchema{Type: "object", AdditionalProperties: openAPISchemaOf(t.Elem(), schemas)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return openAPIStructSchema(t, schemas)
+		}
+		name := openAPISchemaName(t)
+		if _, exist := schemas[name]; !exist {
+			schemas[name] = &OpenAPISchema{} // 占位，避免结构体自引用时无限递归
+			schemas[name] = openAPIStructSchema(t, schemas)
+		}
+		return &OpenAPISchema{Ref: "#/components/schemas/" + name}
+	}
+	return &OpenAPISchema{}
+}
+
+// openAPIStructSchema 通过 gnomon.SchemaParse 解析结构体字段及json标签生成数据结构
+func openAPIStructSchema(t reflect.Type, schemas map[string]*OpenAPISchema) *OpenAPISchema {
+	schema := &OpenAPISchema{Type: "object", Properties: map[string]*OpenAPISchema{}}
+	for _, field := range gnomon.SchemaParse("json", reflect.New(t).Interface()).Fields {
+		if field.Tag == "-" {
+			continue
+		}
+		tags := strings.Split(field.Tag, ",")
+		name, omitEmpty := tags[0], false
+		if name == "" {
+			name = field.Name
+		}
+		for _, option := range tags[1:] {
+			omitEmpty = omitEmpty || option == "omitempty"
+		}
+		fieldSchema := openAPISchemaOf(field.Type, schemas)
+		if field.Type.Kind() == reflect.Ptr {
+			if fieldSchema.Ref == "" {
+				fieldSchema.Nullable = true
+			}
+		} else if !omitEmpty {
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = fieldSchema
+	}
+	sort.Strings(schema.Required)
+	return schema
+}
+
+// openAPISchemaName 公共组件中的结构体名称，如“grope.Test”
+func openAPISchemaName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	if index := strings.LastIndex(pkg, "/"); index >= 0 {
+		pkg = pkg[index+1:]
+	}
+	if pkg == "" {
+		return t.Name()
+	}
+	return pkg + "." + t.Name()
+}
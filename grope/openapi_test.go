@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"encoding/json"
+	"gopkg.in/yaml.v3"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+type openAPIUser struct {
+	Name     string            `json:"name"`
+	Age      int               `json:"age,omitempty"`
+	Birthday time.Time         `json:"birthday"`
+	Friends  []*openAPIUser    `json:"friends,omitempty"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	Password string            `json:"-"`
+}
+
+type openAPIBase struct {
+	ID        int64  `json:"id"`
+	Created   string `json:"created,omitempty"`
+	Name      string `json:"base_name"`
+	Conflict1 int
+}
+
+type openAPIAudit struct {
+	Creator   string `json:"creator"`
+	Conflict1 int
+	Name      string
+}
+
+type openAPIEmbedded struct {
+	openAPIBase
+	*openAPIAudit
+	Name  string      `json:"name"`
+	Inner openAPIBase `json:"inner"`
+	Named openAPIAudit
+}
+
+func TestOpenAPIEmbeddedSchema(t *testing.T) {
+	schemas := map[string]*OpenAPISchema{}
+	openAPISchemaOf(reflect.TypeOf(openAPIEmbedded{}), schemas)
+	schema := schemas["grope.openAPIEmbedded"]
+	var properties []string
+	for name := range schema.Properties {
+		properties = append(properties, name)
+	}
+	sort.Strings(properties)
+	data, _ := json.Marshal(&openAPIEmbedded{openAPIBase: openAPIBase{Created: "now"}, openAPIAudit: &openAPIAudit{}})
+	encoded := map[string]interface{}{}
+	_ = json.Unmarshal(data, &encoded)
+	var expect []string
+	for name := range encoded {
+		expect = append(expect, name)
+	}
+	sort.Strings(expect)
+	if !reflect.DeepEqual(properties, expect) {
+		t.Errorf("expect properties %v, got %v", expect, properties)
+	}
+	if !reflect.DeepEqual(schema.Required, []string{"Name", "Named", "base_name", "creator", "id", "inner", "name"}) {
+		t.Errorf("unexpected required %v", schema.Required)
+	}
+	if schema.Properties["inner"].Ref != "#/components/schemas/grope.openAPIBase" {
+		t.Errorf("unexpected inner schema %+v", schema.Properties["inner"])
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	gs := NewHTTPServe()
+	router := gs.Group("/v1")
+	router.Gets("/users/:id", &Extend{Doc: &Doc{
+		Summary:   "get user",
+		Tags:      []string{"user"},
+		Params:    []*DocParam{{Name: "verbose", Type: "boolean"}},
+		Responses: map[int]interface{}{http.StatusOK: &openAPIUser{}, http.StatusNotFound: nil},
+	}}, func(ctx *Context) {})
+	router.Posts("/users", &Extend{Doc: &Doc{Request: &openAPIUser{}}}, func(ctx *Context) {})
+	router.Delete("/users/:id", func(ctx *Context) {})
+	gs.OpenAPIRoute("/openapi.json", &OpenAPIInfo{Title: "gnomon", Version: "1.0.0"})
+	gs.OpenAPIRoute("/openapi.yaml", &OpenAPIInfo{Title: "gnomon", Version: "1.0.0"})
+	gs.WaitRoutes()
+
+	rec := httptest.NewRecorder()
+	gs.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	doc := &OpenAPI{}
+	if err := json.Unmarshal(rec.Body.Bytes(), doc); nil != err {
+		t.Fatal(err)
+	}
+	if len(doc.Paths) != 2 {
+		t.Fatalf("expect 2 paths, got %v", doc.Paths)
+	}
+	get := doc.Paths["/v1/users/{id}"]["get"]
+	if nil == get || get.Summary != "get user" || len(get.Parameters) != 2 {
+		t.Fatalf("unexpected get operation %+v", get)
+	}
+	if get.Responses["200"].Content["application/json"].Schema.Ref != "#/components/schemas/grope.openAPIUser" {
+		t.Errorf("unexpected response schema")
+	}
+	if nil == doc.Paths["/v1/users/{id}"]["delete"] || nil == doc.Paths["/v1/users"]["post"].RequestBody {
+		t.Errorf("missing operations")
+	}
+	user := doc.Components.Schemas["grope.openAPIUser"]
+	if nil == user || len(user.Properties) != 5 || len(user.Required) != 2 {
+		t.Fatalf("unexpected user schema %+v", user)
+	}
+	if user.Properties["birthday"].Format != "date-time" || user.Properties["friends"].Items.Ref == "" {
+		t.Errorf("unexpected property schema")
+	}
+
+	rec = httptest.NewRecorder()
+	gs.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.yaml", nil))
+	yamlDoc := map[string]interface{}{}
+	if err := yaml.Unmarshal(rec.Body.Bytes(), &yamlDoc); nil != err {
+		t.Fatal(err)
+	}
+	if yamlDoc["openapi"] != "3.0.3" {
+		t.Errorf("unexpected yaml document %v", yamlDoc)
+	}
+}
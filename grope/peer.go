@@ -0,0 +1,224 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrPeerCertMissing peer certificate missing
+	ErrPeerCertMissing = errors.New("peer certificate missing")
+	// ErrPeerCertUnverified peer certificate unverified
+	ErrPeerCertUnverified = errors.New("peer certificate unverified")
+)
+
+// PeerIdentity 客户端证书身份信息
+type PeerIdentity struct {
+	Subject        pkix.Name  // 证书主题
+	Issuer         pkix.Name  // 证书签发者
+	CommonName     string     // 证书主题中的CommonName
+	DNSNames       []string   // SAN中的DNS名称
+	EmailAddresses []string   // SAN中的邮箱地址
+	IPAddresses    []net.IP   // SAN中的IP地址
+	URIs           []*url.URL // SAN中的URI
+	SPIFFEID       string     // SAN中的SPIFFE ID，如“spiffe://example.org/ns/default/sa/api”
+	SerialNumber   *big.Int   // 证书序列号
+	NotBefore      time.Time  // 证书生效时间
+	NotAfter       time.Time  // 证书失效时间
+	Verified       bool       // 证书是否已通过根证书校验
+}
+
+// PeerCertificates 获取客户端提供的证书链，第一个为客户端证书，非TLS请求或客户端未提供证书时返回空
+func (c *Context) PeerCertificates() []*x509.Certificate {
+	if nil == c.request.TLS {
+		return nil
+	}
+	return c.request.TLS.PeerCertificates
+}
+
+// PeerIdentity 获取客户端证书身份信息，客户端未提供证书时返回nil
+func (c *Context) PeerIdentity() *PeerIdentity {
+	certs := c.PeerCertificates()
+	if len(certs) == 0 {
+		return nil
+	}
+	leaf := certs[0]
+	identity := &PeerIdentity{
+		Subject:        leaf.Subject,
+		Issuer:         leaf.Issuer,
+		CommonName:     leaf.Subject.CommonName,
+		DNSNames:       leaf.DNSNames,
+		EmailAddresses: leaf.EmailAddresses,
+		IPAddresses:    leaf.IPAddresses,
+		URIs:           leaf.URIs,
+		SerialNumber:   leaf.SerialNumber,
+		NotBefore:      leaf.NotBefore,
+		NotAfter:       leaf.NotAfter,
+		Verified:       len(c.request.TLS.VerifiedChains) > 0,
+	}
+	for _, uri := range leaf.URIs {
+		if strings.EqualFold(uri.Scheme, "spiffe") {
+			identity.SPIFFEID = uri.String()
+			break
+		}
+	}
+	return identity
+}
+
+// CertAuth 客户端证书授权策略
+//
+// 规则之间满足其一即可通过授权，未设置任何规则时仅要求客户端提供证书；
+// 规则中的字符串均支持 path.Match 通配符，如“*.example.com”、“spiffe://example.org/ns/*/sa/api”
+type CertAuth struct {
+	// 允许的证书主题，与 gnomon.CertRequest 中的Subject类型相同，
+	// 主题中非空的属性均需匹配，数组类型属性要求证书包含其中的每一项
+	Subjects []pkix.Name
+	// 允许的SAN中的DNS名称
+	DNSNames []string
+	// 允许的SAN中的邮箱地址
+	EmailAddresses []string
+	// 允许的SAN中的URI，包括SPIFFE ID
+	URIs []string
+	// 允许的SAN中的IP地址网段，如“10.0.0.0/8”
+	IPNets []*net.IPNet
+	// 是否允许未通过根证书校验的证书，如 ClientAuthRequest 且未设置根证书时，默认不允许
+	AllowUnverified bool
+	// 未提供证书或证书未校验（401）处理方法
+	Unauthorized AuthHandler
+	// 证书不满足授权规则（403）处理方法
+	Forbidden AuthHandler
+}
+
+// CertFilter 客户端证书授权过滤器，需要配合开启客户端证书的 ListenAndServeTLSConfig 使用
+func CertFilter(auth *CertAuth) Filter {
+	return auth.filter
+}
+
+func (ca *CertAuth) filter(ctx *Context) {
+	identity := ctx.PeerIdentity()
+	if nil == identity {
+		ca.unauthorized(ctx, ErrPeerCertMissing)
+		return
+	}
+	if !identity.Verified && !ca.AllowUnverified {
+		ca.unauthorized(ctx, ErrPeerCertUnverified)
+		return
+	}
+	if !ca.authorized(identity) {
+		ca.forbidden(ctx, ErrPermissionDenied)
+	}
+}
+
+// authorized 证书是否满足授权规则之一
+func (ca *CertAuth) authorized(identity *PeerIdentity) bool {
+	if len(ca.Subjects) == 0 && len(ca.DNSNames) == 0 && len(ca.EmailAddresses) == 0 && len(ca.URIs) == 0 && len(ca.IPNets) == 0 {
+		return true
+	}
+	for _, subject := range ca.Subjects {
+		if matchSubject(subject, identity.Subject) {
+			return true
+		}
+	}
+	if matchAny(ca.DNSNames, identity.DNSNames) || matchAny(ca.EmailAddresses, identity.EmailAddresses) {
+		return true
+	}
+	var uris []string
+	for _, uri := range identity.URIs {
+		uris = append(uris, uri.String())
+	}
+	if matchAny(ca.URIs, uris) {
+		return true
+	}
+	for _, ipNet := range ca.IPNets {
+		for _, ip := range identity.IPAddresses {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (ca *CertAuth) unauthorized(ctx *Context, err error) {
+	if nil != ca.Unauthorized {
+		ca.Unauthorized(ctx, err)
+	}
+	if !ctx.responded {
+		ctx.responseMessage(http.StatusUnauthorized, err.Error())
+	}
+}
+
+func (ca *CertAuth) forbidden(ctx *Context, err error) {
+	if nil != ca.Forbidden {
+		ca.Forbidden(ctx, err)
+	}
+	if !ctx.responded {
+		ctx.responseMessage(http.StatusForbidden, err.Error())
+	}
+}
+
+// matchSubject 证书主题是否满足授权主题中所有非空属性
+func matchSubject(pattern, subject pkix.Name) bool {
+	return matchValue(pattern.CommonName, subject.CommonName) &&
+		matchValue(pattern.SerialNumber, subject.SerialNumber) &&
+		matchAll(pattern.Country, subject.Country) &&
+		matchAll(pattern.Organization, subject.Organization) &&
+		matchAll(pattern.OrganizationalUnit, subject.OrganizationalUnit) &&
+		matchAll(pattern.Locality, subject.Locality) &&
+		matchAll(pattern.Province, subject.Province) &&
+		matchAll(pattern.StreetAddress, subject.StreetAddress) &&
+		matchAll(pattern.PostalCode, subject.PostalCode)
+}
+
+// matchValue 空规则视为匹配
+func matchValue(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	matched, err := path.Match(pattern, value)
+	return nil == err && matched
+}
+
+// matchAll 每条规则都需要匹配证书中的某一项
+func matchAll(patterns, values []string) bool {
+	for _, pattern := range patterns {
+		if !matchAny([]string{pattern}, values) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAny 任一规则匹配证书中的任一项
+func matchAny(patterns, values []string) bool {
+	for _, pattern := range patterns {
+		for _, value := range values {
+			if matched, err := path.Match(pattern, value); nil == err && matched {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func newPeerCert(t *testing.T, subject pkix.Name, uri string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if nil != err {
+		t.Fatal(err)
+	}
+	spiffe, _ := url.Parse(uri)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      subject,
+		DNSNames:     []string{"api.svc.example.com"},
+		URIs:         []*url.URL{spiffe},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if nil != err {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if nil != err {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestCertFilter(t *testing.T) {
+	gs := NewHTTPServe()
+	router := gs.Group("/peer")
+	router.Get("/whoami", func(ctx *Context) {
+		identity := ctx.PeerIdentity()
+		_ = ctx.ResponseText(http.StatusOK, identity.CommonName+" "+identity.SPIFFEID+" "+identity.SerialNumber.String())
+	}, CertFilter(&CertAuth{
+		Subjects: []pkix.Name{{Organization: []string{"gnomon"}, OrganizationalUnit: []string{"ops"}}},
+		URIs:     []string{"spiffe://example.org/ns/*/sa/api"},
+	}))
+	router.Get("/any", func(ctx *Context) {
+		_ = ctx.ResponseText(http.StatusOK, "ok")
+	}, CertFilter(&CertAuth{AllowUnverified: true}))
+	gs.WaitRoutes()
+
+	do := func(path string, cert *x509.Certificate, verified bool) (int, string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.TLS = &tls.ConnectionState{HandshakeComplete: true}
+		if nil != cert {
+			req.TLS.PeerCertificates = []*x509.Certificate{cert}
+			if verified {
+				req.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+			}
+		}
+		rec := httptest.NewRecorder()
+		gs.ServeHTTP(rec, req)
+		return rec.Code, rec.Body.String()
+	}
+	api := newPeerCert(t, pkix.Name{CommonName: "api", Organization: []string{"gnomon"}}, "spiffe://example.org/ns/prod/sa/api")
+	ops := newPeerCert(t, pkix.Name{CommonName: "ops", Organization: []string{"gnomon"}, OrganizationalUnit: []string{"ops", "dev"}}, "spiffe://example.org/ns/prod/sa/ops")
+	web := newPeerCert(t, pkix.Name{CommonName: "web", Organization: []string{"gnomon"}}, "spiffe://example.org/ns/prod/sa/web")
+
+	if code, body := do("/peer/whoami", api, true); code != http.StatusOK || body != "api spiffe://example.org/ns/prod/sa/api 42" {
+		t.Errorf("unexpected response %d %s", code, body)
+	}
+	if code, _ := do("/peer/whoami", ops, true); code != http.StatusOK {
+		t.Errorf("expect subject match, got %d", code)
+	}
+	if code, _ := do("/peer/whoami", web, true); code != http.StatusForbidden {
+		t.Errorf("expect 403, got %d", code)
+	}
+	if code, _ := do("/peer/whoami", api, false); code != http.StatusUnauthorized {
+		t.Errorf("expect 401 for unverified certificate, got %d", code)
+	}
+	if code, _ := do("/peer/whoami", nil, false); code != http.StatusUnauthorized {
+		t.Errorf("expect 401 without certificate, got %d", code)
+	}
+	if code, _ := do("/peer/any", web, false); code != http.StatusOK {
+		t.Errorf("expect unverified certificate allowed, got %d", code)
+	}
+}
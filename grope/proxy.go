@@ -0,0 +1,271 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"errors"
+	"github.com/aberic/gnomon/balance"
+	"github.com/aberic/gnomon/log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrProxyTargetUnavailable proxy target unavailable
+	ErrProxyTargetUnavailable = errors.New("proxy target unavailable")
+	// ErrProxyTargetExist proxy target already exist
+	ErrProxyTargetExist = errors.New("proxy target already exist")
+	// ErrProxyTargetNotExist proxy target not exist
+	ErrProxyTargetNotExist = errors.New("proxy target not exist")
+)
+
+// init 根据代理目标及权重为每个目标子集新建负载均衡器，权重小于1的目标按1处理
+func (p *Proxy) init() error {
+	p.balancers = map[string]balance.Balancer{}
+	for _, target := range p.Target {
+		p.balance(target)
+	}
+	transport := p.Transport
+	if nil == transport {
+		transport = &Transport{
+			Timeout:               30 * time.Second,
+			KeepAlive:             30 * time.Second,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+			MaxIdleConnsPerHost:   100,
+		}
+	}
+	ht, err := getTLSTransport(transport)
+	if nil != err {
+		return err
+	}
+	p.transport = ht
+	return nil
+}
+
+// balance 将代理目标按权重加入所属子集的负载均衡器
+func (p *Proxy) balance(target *Target) {
+	balancer, exist := p.balancers[target.Subset]
+	if !exist {
+		balancer = balance.NewBalance(p.Balance)
+		p.balancers[target.Subset] = balancer
+	}
+	balancer.Add(target)
+	if target.Weight > 1 {
+		balancer.Weight(target, target.Weight)
+	}
+}
+
+// subset 根据分流规则选择目标子集，均未命中时使用默认子集
+func (p *Proxy) subset(ctx *Context) string {
+	for _, rule := range p.Rules {
+		if rule.match(ctx) {
+			return rule.Subset
+		}
+	}
+	return ""
+}
+
+// acquire 通过目标子集的负载均衡器选择代理目标
+func (p *Proxy) acquire(subset string) (*Target, error) {
+	p.lock.RLock()
+	balancer, exist := p.balancers[subset]
+	p.lock.RUnlock()
+	if !exist {
+		return nil, ErrProxyTargetUnavailable
+	}
+	obj, err := balancer.Acquire()
+	if nil != err {
+		return nil, err
+	}
+	return obj.(*Target), nil
+}
+
+// find 根据主机及端口查找代理目标，调用方需持有锁
+func (p *Proxy) find(host, port string) *Target {
+	for _, target := range p.Target {
+		if target.Host == host && target.Port == port {
+			return target
+		}
+	}
+	return nil
+}
+
+// addTarget 新增代理目标
+func (p *Proxy) addTarget(target *Target) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if nil != p.find(target.Host, target.Port) {
+		return ErrProxyTargetExist
+	}
+	p.Target = append(p.Target, target)
+	p.balance(target)
+	return nil
+}
+
+// removeTarget 移除代理目标，进行中的请求不受影响
+func (p *Proxy) removeTarget(host, port string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	target := p.find(host, port)
+	if nil == target {
+		return ErrProxyTargetNotExist
+	}
+	p.balancers[target.Subset].Remove(target)
+	targets := make([]*Target, 0, len(p.Target))
+	for _, t := range p.Target {
+		if t != target {
+			targets = append(targets, t)
+		}
+	}
+	p.Target = targets
+	return nil
+}
+
+// weightTarget 设置代理目标权重，已排空的目标同时恢复分配请求
+func (p *Proxy) weightTarget(host, port string, weight int) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	target := p.find(host, port)
+	if nil == target {
+		return ErrProxyTargetNotExist
+	}
+	target.Weight = weight
+	if target.drained {
+		target.drained = false
+		p.balance(target)
+	} else {
+		p.balancers[target.Subset].Weight(target, weight)
+	}
+	return nil
+}
+
+// drainTarget 排空代理目标，不再分配新的请求，进行中的请求数可通过路由信息查看
+func (p *Proxy) drainTarget(host, port string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	target := p.find(host, port)
+	if nil == target {
+		return ErrProxyTargetNotExist
+	}
+	if !target.drained {
+		target.drained = true
+		p.balancers[target.Subset].Remove(target)
+	}
+	return nil
+}
+
+// roundTripper 将方法适配为 http.RoundTripper
+type roundTripper func(req *http.Request) (*http.Response, error)
+
+func (rt roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return rt(req)
+}
+
+// scheme 代理请求协议
+func (p *Proxy) scheme() string {
+	if nil != p.Transport && nil != p.Transport.TLSConfig {
+		return "https"
+	}
+	return "http"
+}
+
+// serve 通过负载均衡选择代理目标并转发请求，目标不可用时返回502
+func (p *Proxy) serve(ctx *Context) {
+	if nil == p.balancers || nil == p.transport {
+		ctx.responseMessage(http.StatusBadGateway, ErrProxyTargetUnavailable.Error())
+		return
+	}
+	subset := p.subset(ctx)
+	target, err := p.acquire(subset)
+	if nil != err {
+		ctx.responseMessage(http.StatusBadGateway, ErrProxyTargetUnavailable.Error())
+		return
+	}
+	atomic.AddInt32(&target.active, 1)
+	defer func() { atomic.AddInt32(&target.active, -1) }()
+	if nil != p.Mirror {
+		if primary := p.Mirror.mirror(ctx, p); nil != primary {
+			defer func(start time.Time) {
+				result := &mirrorPrimary{latency: time.Since(start)}
+				if nil != ctx.resp {
+					result.status = ctx.resp.status
+				}
+				primary <- result
+			}(time.Now())
+		}
+	}
+	reverseProxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			p.direct(ctx, target, req)
+		},
+		Transport: p.transport,
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			log.Error("proxy", log.Field("target", req.URL.Host), log.Field("path", req.URL.Path), log.Err(err))
+			ctx.responseMessage(http.StatusBadGateway, ErrProxyTargetUnavailable.Error())
+		},
+	}
+	if nil != p.Retry {
+		reverseProxy.Transport = roundTripper(func(req *http.Request) (*http.Response, error) {
+			attempt := 0
+			return p.Retry.Do(req, func(req *http.Request) (*http.Response, error) {
+				if attempt++; attempt > 1 {
+					// 重试时重新选择代理目标，避免持续请求故障目标
+					if next, err := p.acquire(subset); nil == err && next != target {
+						atomic.AddInt32(&target.active, -1)
+						atomic.AddInt32(&next.active, 1)
+						target = next
+						p.direct(ctx, target, req)
+					}
+					log.Debug("proxy retry", log.Field("target", req.URL.Host), log.Field("path", req.URL.Path), log.Field("attempt", attempt))
+				}
+				return p.transport.RoundTrip(req)
+			})
+		})
+	}
+	reverseProxy.ServeHTTP(ctx.writer, ctx.request)
+}
+
+// direct 将请求地址改写为代理目标地址，并设置转发相关的请求头
+func (p *Proxy) direct(ctx *Context, target *Target, req *http.Request) {
+	req.URL.Scheme = p.scheme()
+	req.URL.Host = net.JoinHostPort(target.Host, target.Port)
+	if target.Pattern != "" {
+		req.URL.Path, req.URL.RawPath = target.path(ctx.valueMap), ""
+	}
+	req.Host = req.URL.Host
+	req.Header.Set("X-Forwarded-Host", ctx.Host())
+	req.Header.Set("X-Forwarded-Proto", ctx.Scheme())
+	if _, exist := req.Header["User-Agent"]; !exist {
+		req.Header.Set("User-Agent", "")
+	}
+}
+
+// path 将代理目标路径中的“:param”替换为请求路径中的同名参数值
+func (t *Target) path(values map[string]string) string {
+	pieces := strings.Split(t.Pattern, "/")
+	for index, piece := range pieces {
+		if strings.HasPrefix(piece, ":") {
+			pieces[index] = values[piece[1:]]
+		}
+	}
+	return strings.Join(pieces, "/")
+}
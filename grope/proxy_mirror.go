@@ -0,0 +1,229 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/aberic/gnomon/log"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sync/atomic"
+	"time"
+)
+
+// ProxyMirror 代理流量镜像，用于在切换上游前以线上流量验证新版本
+//
+// 采样命中的请求在转发至代理目标的同时，将包括请求体在内的副本异步发送至影子目标，
+// 影子响应被丢弃，仅记录与主请求的状态码及耗时差异，影子目标的失败不影响主请求
+type ProxyMirror struct {
+	Target      *Target       // 影子目标，Pattern 同代理目标，Weight 及 Subset 无效
+	Percent     float64       // 采样比例（0~100），0表示镜像全部请求
+	Timeout     time.Duration // 影子请求超时时间，默认10秒
+	MaxBodySize int64         // 允许镜像的最大请求体长度（字节），超出则不镜像该请求，默认1MB
+	// 每次镜像完成后执行，用于记录差异明细，在后台协程中执行
+	Record        func(result *MirrorResult)
+	mirrored      uint64
+	diffs         uint64
+	failed        uint64
+	latency       int64 // 主请求累计耗时（纳秒）
+	shadowLatency int64 // 影子请求累计耗时（纳秒）
+}
+
+// MirrorResult 一次流量镜像中主请求与影子请求的对比结果
+type MirrorResult struct {
+	Method        string        // 请求方法
+	Path          string        // 影子请求路径
+	Status        int           // 主请求响应状态码
+	ShadowStatus  int           // 影子请求响应状态码，请求失败时为0
+	Latency       time.Duration // 主请求耗时
+	ShadowLatency time.Duration // 影子请求耗时
+	Err           error         // 影子请求错误
+}
+
+// Diff 主请求与影子请求的响应状态码是否不同，影子请求失败视为不同
+func (mr *MirrorResult) Diff() bool {
+	return mr.Status != mr.ShadowStatus
+}
+
+// MirrorStats 流量镜像统计
+type MirrorStats struct {
+	Mirrored      uint64        `json:"mirrored"`      // 已完成的镜像次数
+	Diffs         uint64        `json:"diffs"`         // 响应状态码不同的次数
+	Errors        uint64        `json:"errors"`        // 影子请求失败次数
+	Latency       time.Duration `json:"latency"`       // 主请求平均耗时
+	ShadowLatency time.Duration `json:"shadowLatency"` // 影子请求平均耗时
+}
+
+// Stats 流量镜像统计
+func (pm *ProxyMirror) Stats() *MirrorStats {
+	stats := &MirrorStats{
+		Mirrored: atomic.LoadUint64(&pm.mirrored),
+		Diffs:    atomic.LoadUint64(&pm.diffs),
+		Errors:   atomic.LoadUint64(&pm.failed),
+	}
+	if stats.Mirrored > 0 {
+		stats.Latency = time.Duration(atomic.LoadInt64(&pm.latency) / int64(stats.Mirrored))
+		stats.ShadowLatency = time.Duration(atomic.LoadInt64(&pm.shadowLatency) / int64(stats.Mirrored))
+	}
+	return stats
+}
+
+// String 流量镜像描述，如“localhost:9090 10% mirrored=20 diffs=1 errors=0 latency=2ms shadowLatency=3ms”
+func (pm *ProxyMirror) String() string {
+	target := ""
+	if nil != pm.Target {
+		target = net.JoinHostPort(pm.Target.Host, pm.Target.Port) + pm.Target.Pattern
+	}
+	percent := pm.Percent
+	if percent <= 0 || percent > 100 {
+		percent = 100
+	}
+	stats := pm.Stats()
+	return fmt.Sprintf("%s %g%% mirrored=%d diffs=%d errors=%d latency=%s shadowLatency=%s", target, percent,
+		stats.Mirrored, stats.Diffs, stats.Errors, stats.Latency, stats.ShadowLatency)
+}
+
+// mirrorPrimary 主请求的响应状态码及耗时
+type mirrorPrimary struct {
+	status  int
+	latency time.Duration
+}
+
+// mirror 采样命中时缓存请求体并异步发送影子请求，返回用于传递主请求结果的通道，未镜像时返回nil
+func (pm *ProxyMirror) mirror(ctx *Context, p *Proxy) chan<- *mirrorPrimary {
+	if nil == pm.Target || (pm.Percent > 0 && pm.Percent < 100 && rand.Float64()*100 >= pm.Percent) {
+		return nil
+	}
+	body, ok := pm.body(ctx)
+	if !ok {
+		return nil
+	}
+	timeout := pm.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	// 影子请求不随客户端断开而取消
+	c, cancel := context.WithTimeout(context.Background(), timeout)
+	req := ctx.request.WithContext(c)
+	u := *ctx.request.URL
+	req.URL = &u
+	req.Header = ctx.request.Header.Clone()
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	p.direct(ctx, pm.Target, req)
+	primary := make(chan *mirrorPrimary, 1)
+	go pm.shadow(req, p.transport, cancel, primary)
+	return primary
+}
+
+// body 读取并缓存请求体，主请求继续使用缓存的请求体
+//
+// 请求体超出 MaxBodySize 或读取失败时不镜像该请求，主请求仍可读取到完整的请求体或相同的错误
+func (pm *ProxyMirror) body(ctx *Context) ([]byte, bool) {
+	origin := ctx.request.Body
+	if nil == origin || origin == http.NoBody {
+		return nil, true
+	}
+	size := pm.MaxBodySize
+	if size <= 0 {
+		size = 1 << 20
+	}
+	if ctx.request.ContentLength > size {
+		return nil, false
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(origin, size+1))
+	ctx.request.Body = &mirrorBody{Reader: io.MultiReader(bytes.NewReader(body), origin), Closer: origin}
+	if nil != err || int64(len(body)) > size {
+		return nil, false
+	}
+	return body, true
+}
+
+// shadow 发送影子请求并丢弃响应，等待主请求完成后记录对比结果
+func (pm *ProxyMirror) shadow(req *http.Request, transport http.RoundTripper, cancel context.CancelFunc, primary <-chan *mirrorPrimary) {
+	defer cancel()
+	result := &MirrorResult{Method: req.Method, Path: req.URL.Path}
+	writer := &mirrorWriter{header: http.Header{}}
+	reverseProxy := &httputil.ReverseProxy{
+		Director:  func(*http.Request) {},
+		Transport: transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			result.Err = err
+		},
+	}
+	start := time.Now()
+	reverseProxy.ServeHTTP(writer, req)
+	result.ShadowLatency = time.Since(start)
+	if nil == result.Err {
+		result.ShadowStatus = writer.status
+	}
+	p := <-primary
+	result.Status, result.Latency = p.status, p.latency
+	pm.record(result)
+}
+
+// record 累计镜像统计，状态码不同时记录日志
+func (pm *ProxyMirror) record(result *MirrorResult) {
+	atomic.AddInt64(&pm.latency, int64(result.Latency))
+	atomic.AddInt64(&pm.shadowLatency, int64(result.ShadowLatency))
+	if nil != result.Err {
+		atomic.AddUint64(&pm.failed, 1)
+	}
+	if result.Diff() {
+		atomic.AddUint64(&pm.diffs, 1)
+		log.Debug("proxy mirror diff", log.Field("method", result.Method), log.Field("path", result.Path),
+			log.Field("status", result.Status), log.Field("shadowStatus", result.ShadowStatus),
+			log.Field("latency", result.Latency.String()), log.Field("shadowLatency", result.ShadowLatency.String()), log.Err(result.Err))
+	}
+	atomic.AddUint64(&pm.mirrored, 1)
+	if nil != pm.Record {
+		pm.Record(result)
+	}
+}
+
+// mirrorBody 缓存后的请求体，关闭时关闭原始请求体
+type mirrorBody struct {
+	io.Reader
+	io.Closer
+}
+
+// mirrorWriter 记录影子响应状态码并丢弃响应内容
+type mirrorWriter struct {
+	header http.Header
+	status int
+}
+
+func (mw *mirrorWriter) Header() http.Header {
+	return mw.header
+}
+
+func (mw *mirrorWriter) WriteHeader(statusCode int) {
+	if mw.status == 0 {
+		mw.status = statusCode
+	}
+}
+
+func (mw *mirrorWriter) Write(b []byte) (int, error) {
+	if mw.status == 0 {
+		mw.status = http.StatusOK
+	}
+	return len(b), nil
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"github.com/aberic/gnomon/balance"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProxyMirror(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		_, _ = w.Write([]byte("primary " + string(body)))
+	}))
+	defer primary.Close()
+	bodies := make(chan string, 10)
+	release := make(chan struct{})
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies <- r.Method + " " + r.URL.Path + " " + string(body)
+		if r.Method == http.MethodPut {
+			select {
+			case <-release:
+			case <-time.After(time.Second):
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		_, _ = w.Write([]byte("shadow"))
+	}))
+	defer shadow.Close()
+	target := func(server *httptest.Server) *Target {
+		u, _ := url.Parse(server.URL)
+		host, port, _ := net.SplitHostPort(u.Host)
+		return &Target{Host: host, Port: port, Pattern: "/v2/:id"}
+	}
+
+	results := make(chan *MirrorResult, 10)
+	mirror := &ProxyMirror{Target: target(shadow), MaxBodySize: 8, Record: func(result *MirrorResult) { results <- result }}
+	gs := NewHTTPServe()
+	router := gs.Group("/api")
+	for _, method := range []string{http.MethodPost, http.MethodPut} {
+		router.repo(method, "/items/:id", nil, nil, &Proxy{Balance: balance.Round, Target: []*Target{target(primary)}, Mirror: mirror})
+	}
+	client := NewTestClient(gs)
+
+	client.Post("/api/items/1").Text("hello").MustDo(t).AssertText(t, "primary hello")
+	if body := <-bodies; body != "POST /v2/1 hello" {
+		t.Errorf("unexpected shadow request %q", body)
+	}
+	if result := <-results; result.Diff() || result.Status != http.StatusOK || nil != result.Err {
+		t.Errorf("unexpected mirror result %+v", result)
+	}
+
+	// 影子响应较慢且失败时不影响主请求
+	start := time.Now()
+	client.Put("/api/items/2").Text("world").MustDo(t).AssertText(t, "primary world")
+	if time.Since(start) >= time.Second {
+		t.Errorf("expect primary response without waiting shadow")
+	}
+	close(release)
+	if result := <-results; !result.Diff() || result.ShadowStatus != http.StatusInternalServerError {
+		t.Errorf("unexpected mirror result %+v", result)
+	}
+	<-bodies
+
+	// 请求体超出限制时不镜像，主请求仍读取到完整的请求体
+	client.Post("/api/items/3").Text("too large body").MustDo(t).AssertText(t, "primary too large body")
+	select {
+	case body := <-bodies:
+		t.Errorf("expect no shadow request, got %q", body)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	stats := mirror.Stats()
+	if stats.Mirrored != 2 || stats.Diffs != 1 || stats.Errors != 0 || stats.ShadowLatency <= 0 {
+		t.Errorf("unexpected mirror stats %+v", stats)
+	}
+	if route := gs.Routes()[0]; !strings.Contains(route.Proxy.Mirror, "100% mirrored=2 diffs=1 errors=0") {
+		t.Errorf("unexpected route mirror %q", route.Proxy.Mirror)
+	}
+
+	sampled := &ProxyMirror{Target: target(shadow), Percent: 30}
+	gs.Group("/sample").repo(http.MethodGet, "/items/:id", nil, nil, &Proxy{Balance: balance.Round, Target: []*Target{target(primary)}, Mirror: sampled})
+	count := 0
+	for i := 0; i < 200; i++ {
+		client.Get("/sample/items/1").MustDo(t).AssertStatus(t, http.StatusOK)
+		select {
+		case <-bodies:
+			count++
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	if count < 30 || count > 90 {
+		t.Errorf("expect about 30%% sampled, got %d", count)
+	}
+}
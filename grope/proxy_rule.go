@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// ProxyRule 代理分流规则，用于金丝雀发布等场景
+//
+// Header、Cookie、Query 及 Claim 最多设置其一作为匹配来源，Percent 大于0时对匹配的请求再按比例分流，
+// 二者均未设置的规则匹配所有请求，示例：
+//
+//	{Name: "beta", Header: "X-Canary", Values: []string{"true"}, Subset: "canary"} // 携带请求头的请求使用canary子集
+//	{Name: "5%", Percent: 5, Sticky: "cookie:uid", Subset: "canary"}              // 按uid固定5%的用户使用canary子集
+type ProxyRule struct {
+	Name   string   // 规则名称，用于观察规则命中情况
+	Header string   // 匹配的请求头名称
+	Cookie string   // 匹配的cookie名称
+	Query  string   // 匹配的请求参数名称
+	Claim  string   // 匹配的JWT声明名称，需要在 JWTFilter 之后执行，数组类型的声明任一项匹配即可
+	Values []string // 期望的值，支持 path.Match 通配符，为空表示存在即匹配
+	// 按比例分流（0~100），0表示不按比例分流，同一粘性依据的请求始终得到相同结果
+	Percent float64
+	// 比例分流的粘性依据，格式为“header:名称”、“cookie:名称”、“query:名称”或“claim:名称”，
+	// 为空或请求中不存在时使用客户端IP
+	Sticky string
+	Subset string // 命中后使用的代理目标子集，对应 Target.Subset
+	hits   uint64
+}
+
+// Hits 规则命中次数
+func (pr *ProxyRule) Hits() uint64 {
+	return atomic.LoadUint64(&pr.hits)
+}
+
+// String 规则描述，如“beta header:X-Canary=[true] -> canary hits=3”
+func (pr *ProxyRule) String() string {
+	var conds []string
+	if source, key := pr.source(); source != "" {
+		cond := fmt.Sprintf("%s:%s", source, key)
+		if len(pr.Values) > 0 {
+			cond = fmt.Sprintf("%s=[%s]", cond, strings.Join(pr.Values, ","))
+		}
+		conds = append(conds, cond)
+	}
+	if pr.Percent > 0 {
+		cond := fmt.Sprintf("%g%%", pr.Percent)
+		if pr.Sticky != "" {
+			cond = fmt.Sprintf("%s sticky=%s", cond, pr.Sticky)
+		}
+		conds = append(conds, cond)
+	}
+	if len(conds) == 0 {
+		conds = append(conds, "*")
+	}
+	return fmt.Sprintf("%s %s -> %s hits=%d", pr.Name, strings.Join(conds, " "), pr.Subset, pr.Hits())
+}
+
+// source 规则的匹配来源及名称
+func (pr *ProxyRule) source() (string, string) {
+	switch {
+	case pr.Header != "":
+		return "header", pr.Header
+	case pr.Cookie != "":
+		return "cookie", pr.Cookie
+	case pr.Query != "":
+		return "query", pr.Query
+	case pr.Claim != "":
+		return "claim", pr.Claim
+	}
+	return "", ""
+}
+
+// match 请求是否命中规则，命中时累加命中次数
+func (pr *ProxyRule) match(ctx *Context) bool {
+	if source, key := pr.source(); source != "" {
+		values, exist := requestValues(ctx, source, key)
+		if !exist || (len(pr.Values) > 0 && !matchAny(pr.Values, values)) {
+			return false
+		}
+	}
+	if pr.Percent > 0 && pr.Percent < 100 && pr.bucket(ctx) >= pr.Percent*100 {
+		return false
+	}
+	atomic.AddUint64(&pr.hits, 1)
+	return true
+}
+
+// bucket 根据粘性依据将请求映射到[0, 10000)的区间，规则名称参与计算使不同规则的分流相互独立
+func (pr *ProxyRule) bucket(ctx *Context) float64 {
+	key := ""
+	if index := strings.Index(pr.Sticky, ":"); index > 0 {
+		if values, exist := requestValues(ctx, pr.Sticky[:index], pr.Sticky[index+1:]); exist && len(values) > 0 {
+			key = values[0]
+		}
+	}
+	if key == "" {
+		key = ctx.ClientIP()
+	}
+	return float64(crc32.ChecksumIEEE([]byte(pr.Name+"\n"+key)) % 10000)
+}
+
+// requestValues 获取请求中指定来源的值
+func requestValues(ctx *Context, source, key string) ([]string, bool) {
+	switch source {
+	case "header":
+		values, exist := ctx.request.Header[http.CanonicalHeaderKey(key)]
+		return values, exist
+	case "cookie":
+		value, err := ctx.Cookie(key)
+		return []string{value}, nil == err
+	case "query":
+		values, exist := ctx.request.URL.Query()[key]
+		return values, exist
+	case "claim":
+		claim, exist := ctx.Claims()[key]
+		if !exist {
+			return nil, false
+		}
+		if array, ok := claim.([]interface{}); ok {
+			values := make([]string, 0, len(array))
+			for _, item := range array {
+				values = append(values, fmt.Sprint(item))
+			}
+			return values, true
+		}
+		return []string{fmt.Sprint(claim)}, true
+	}
+	return nil, false
+}
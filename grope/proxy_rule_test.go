@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"fmt"
+	"github.com/aberic/gnomon/balance"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestProxyRule(t *testing.T) {
+	backendStable, targetStable := newProxyBackend("stable")
+	defer backendStable.Close()
+	backendCanary, targetCanary := newProxyBackend("canary")
+	defer backendCanary.Close()
+	targetCanary.Subset = "canary"
+
+	beta := &ProxyRule{Name: "beta", Header: "X-Canary", Values: []string{"true"}, Subset: "canary"}
+	staff := &ProxyRule{Name: "staff", Claim: "roles", Values: []string{"staff"}, Subset: "canary"}
+	debug := &ProxyRule{Name: "debug", Query: "debug", Subset: "canary"}
+	percent := &ProxyRule{Name: "percent", Percent: 20, Sticky: "cookie:uid", Subset: "canary"}
+	gs := NewHTTPServe()
+	claims := func(ctx *Context) {
+		if role := ctx.HeaderGet("X-Role"); role != "" {
+			ctx.claims = map[string]interface{}{"roles": []interface{}{"user", role}}
+		}
+	}
+	gs.Group("/api", claims).repo(http.MethodGet, "/users/:id", nil, nil, &Proxy{Balance: balance.Round,
+		Target: []*Target{targetStable, targetCanary}, Rules: []*ProxyRule{beta, staff, debug, percent}})
+
+	client := NewTestClient(gs)
+	backend := func(path string, header ...string) string {
+		req := client.Get(path)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header(header[i], header[i+1])
+		}
+		text := req.MustDo(t).AssertStatus(t, http.StatusOK).Text()
+		return text[:strings.Index(text, " ")]
+	}
+	if name := backend("/api/users/1", "X-Canary", "true"); name != "canary" {
+		t.Errorf("expect canary by header, got %s", name)
+	}
+	if name := backend("/api/users/1", "X-Canary", "false", "Cookie", "uid=0"); name != backend("/api/users/1", "Cookie", "uid=0") {
+		t.Errorf("expect unmatched header fall through to next rules, got %s", name)
+	}
+	if name := backend("/api/users/1", "X-Role", "staff"); name != "canary" {
+		t.Errorf("expect canary by claim, got %s", name)
+	}
+	if name := backend("/api/users/1?debug="); name != "canary" {
+		t.Errorf("expect canary by query, got %s", name)
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 500; i++ {
+		uid := fmt.Sprintf("uid=%d", i)
+		name := backend("/api/users/1", "Cookie", uid)
+		for j := 0; j < 2; j++ {
+			if again := backend("/api/users/1", "Cookie", uid); again != name {
+				t.Fatalf("expect sticky backend for %s, got %s and %s", uid, name, again)
+			}
+		}
+		counts[name]++
+	}
+	if counts["canary"] < 60 || counts["canary"] > 140 {
+		t.Errorf("expect about 20%% canary, got %v", counts)
+	}
+
+	if beta.Hits() != 1 || staff.Hits() != 1 || debug.Hits() != 1 {
+		t.Errorf("expect hits 1, got beta=%d staff=%d debug=%d", beta.Hits(), staff.Hits(), debug.Hits())
+	}
+	if expect := "beta header:X-Canary=[true] -> canary hits=1"; beta.String() != expect {
+		t.Errorf("expect %q, got %q", expect, beta.String())
+	}
+	if expect := "percent 20% sticky=cookie:uid -> canary"; !strings.HasPrefix(percent.String(), expect) {
+		t.Errorf("expect %q, got %q", expect, percent.String())
+	}
+	route := gs.Routes()[0]
+	if len(route.Proxy.Rules) != 4 || !strings.HasPrefix(route.Proxy.Rules[0], "1. beta ") ||
+		!strings.Contains(route.Proxy.Targets[1], "subset=canary") {
+		t.Errorf("unexpected route proxy %+v", route.Proxy)
+	}
+}
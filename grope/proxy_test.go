@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"fmt"
+	"github.com/aberic/gnomon"
+	"github.com/aberic/gnomon/balance"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newProxyBackend 新建代理目标测试服务，响应内容为服务名称、请求路径及转发请求头
+func newProxyBackend(name string) (*httptest.Server, *Target) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s %s %s %s", name, r.URL.RequestURI(), r.Header.Get("X-Forwarded-Host"), r.Header.Get("X-Forwarded-Proto"))
+	}))
+	u, _ := url.Parse(server.URL)
+	host, port, _ := net.SplitHostPort(u.Host)
+	return server, &Target{Host: host, Port: port}
+}
+
+func TestProxy_serve(t *testing.T) {
+	backendA, targetA := newProxyBackend("a")
+	defer backendA.Close()
+	backendB, targetB := newProxyBackend("b")
+	defer backendB.Close()
+	targetA.Pattern, targetB.Pattern = "/user/:id", "/user/:id"
+	targetA.Weight = 3
+
+	gs := NewHTTPServe()
+	router := gs.Group("/proxy")
+	router.repo(http.MethodGet, "/users/:id", nil, nil, &Proxy{Balance: balance.Round, Target: []*Target{targetA, targetB}})
+	backendDown, targetDown := newProxyBackend("down")
+	backendDown.Close()
+	router.repo(http.MethodGet, "/down", nil, nil, &Proxy{Balance: balance.Round, Target: []*Target{targetDown}})
+
+	counts := map[string]int{}
+	for i := 0; i < 8; i++ {
+		rec := httptest.NewRecorder()
+		gs.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/proxy/users/7?v=1", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expect 200, got %d %s", rec.Code, rec.Body.String())
+		}
+		body := rec.Body.String()
+		counts[body[:1]]++
+		if expect := body[:1] + " /user/7?v=1 example.com http"; body != expect {
+			t.Errorf("expect %q, got %q", expect, body)
+		}
+	}
+	if counts["a"] != 6 || counts["b"] != 2 {
+		t.Errorf("expect weighted round 6:2, got %v", counts)
+	}
+
+	rec := httptest.NewRecorder()
+	gs.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/proxy/down", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("expect 502, got %d", rec.Code)
+	}
+}
+
+func TestGHttpRouter_Proxies(t *testing.T) {
+	backend, target := newProxyBackend("backend")
+	defer backend.Close()
+	get, post := *target, *target
+	get.Pattern, post.Pattern = "/user/:id", "/user"
+
+	gs := NewHTTPServe()
+	router := gs.Group("/proxy")
+	router.Proxies(http.MethodGet, "/users/:id", &Proxy{Balance: balance.Round, Target: []*Target{&get}}, nil)
+	router.Proxies(http.MethodPost, "/users", &Proxy{Balance: balance.Round, Target: []*Target{&post}}, nil)
+	gs.WaitRoutes()
+
+	for _, c := range []struct{ method, path, expect string }{
+		{http.MethodGet, "/proxy/users/7", "backend /user/7 example.com http"},
+		{http.MethodPost, "/proxy/users", "backend /user example.com http"},
+	} {
+		rec := httptest.NewRecorder()
+		gs.ServeHTTP(rec, httptest.NewRequest(c.method, c.path, nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != c.expect {
+			t.Errorf("%s %s expect %q, got %d %q", c.method, c.path, c.expect, rec.Code, rec.Body.String())
+		}
+	}
+	rec := httptest.NewRecorder()
+	gs.ServeHTTP(rec, httptest.NewRequest(http.MethodTrace, "/proxy/users/7", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expect 404 for unregistered method, got %d", rec.Code)
+	}
+}
+
+func TestProxy_retry(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		_, _ = fmt.Fprintf(w, "%s %s", r.URL.Path, body)
+	}))
+	defer healthy.Close()
+	target := func(server *httptest.Server) *Target {
+		u, _ := url.Parse(server.URL)
+		host, port, _ := net.SplitHostPort(u.Host)
+		return &Target{Host: host, Port: port, Pattern: "/order/:id"}
+	}
+
+	gs := NewHTTPServe()
+	gs.Group("/api").repo(http.MethodPost, "/orders/:id", nil, nil, &Proxy{Balance: balance.Round,
+		Target: []*Target{target(failing), target(healthy)}, Retry: &gnomon.HTTPRetry{MaxAttempts: 2, Backoff: time.Millisecond}})
+	client := NewTestClient(gs)
+	for i := 0; i < 4; i++ {
+		client.Post("/api/orders/1").Header("Idempotency-Key", fmt.Sprint(i)).Text("item").MustDo(t).AssertText(t, "/order/1 item")
+	}
+	statuses := map[int]int{}
+	for i := 0; i < 4; i++ {
+		statuses[client.Post("/api/orders/1").Text("item").MustDo(t).StatusCode]++
+	}
+	if statuses[http.StatusServiceUnavailable] != 2 || statuses[http.StatusOK] != 2 {
+		t.Errorf("expect request without idempotency key not retried, got %v", statuses)
+	}
+	if route := gs.Routes()[0]; !strings.HasPrefix(route.Proxy.Retry, "attempts=2 statuses=[502 503 504]") {
+		t.Errorf("unexpected route retry %q", route.Proxy.Retry)
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/aberic/gnomon"
 	"github.com/aberic/gnomon/balance"
 	"net/http"
+	"sync"
 )
 
 // Handler 待实现接收请求方法
@@ -32,13 +33,23 @@ type Filter func(ctx *Context)
 
 // Extend 请求扩展
 type Extend struct {
-	Limit *Limit
+	Limit       *Limit
+	MaxBodySize int64        // 请求体允许的最大长度（字节），超出则返回413，0表示使用服务配置，负数表示不限
+	Concurrency *Concurrency // 并发限制，多个路由共用同一策略时共享并发名额
+	Doc         *Doc         // 路由文档描述，用于生成OpenAPI文档
 }
 
-// Proxy 请求代理结构，目前仅支持HTTP
+// Proxy 请求代理结构，Transport 未设置 TLSConfig 时使用HTTP，否则使用HTTPS
 type Proxy struct {
-	Balance balance.Class // 负载模型
-	Target  []*Target     // 代理目标结构
+	Balance   balance.Class               // 负载模型
+	Target    []*Target                   // 代理目标结构
+	Transport *Transport                  // 代理请求传输配置，nil则使用默认配置
+	Rules     []*ProxyRule                // 分流规则，按顺序匹配，命中后使用规则指定的目标子集，均未命中时使用未设置子集的目标
+	Mirror    *ProxyMirror                // 流量镜像，将请求副本异步发送至影子目标
+	Retry     *gnomon.HTTPRetry           // 重试策略，重试时在同一目标子集中重新选择代理目标
+	balancers map[string]balance.Balancer // 目标子集名称与负载均衡器的映射
+	transport http.RoundTripper
+	lock      sync.RWMutex
 }
 
 // Target 代理目标结构
@@ -47,6 +58,9 @@ type Target struct {
 	Port    string // eg:8080
 	Pattern string // eg:“/demo/id/name”
 	Weight  int    // 负载权重，如果负载模型选择权重模型则有效
+	Subset  string // 所属目标子集，如“canary”，供 ProxyRule 选择，为空表示默认子集
+	active  int32  // 进行中的请求数
+	drained bool   // 是否已排空，排空后不再分配新的请求
 }
 
 // GHttpRouter Http服务路由结构
@@ -59,6 +73,15 @@ func (ghr *GHttpRouter) repo(method, pattern string, extend *Extend, handler Han
 	ghr.nodal.add(gnomon.StringBuild(ghr.pattern, pattern), method, extend, handler, proxy, filters...)
 }
 
+// register 异步注册路由，可通过 GHttpServe.WaitRoutes 等待注册完成
+func (ghr *GHttpRouter) register(method, pattern string, extend *Extend, handler Handler, proxy *Proxy, filters ...Filter) {
+	ghr.nodal.pending.Add(1)
+	go func() {
+		defer ghr.nodal.pending.Done()
+		ghr.repo(method, pattern, extend, handler, proxy, filters...)
+	}()
+}
+
 // execURL 特殊处理Url
 //
 // pattern 项目路径，如“/demo/:id/:name”，与路由根路径相结合，最终会通过类似“http://127.0.0.1:8080/test/demo/1/g”方式进行访问
@@ -101,7 +124,7 @@ func (ghr *GHttpRouter) repo(method, pattern string, extend *Extend, handler Han
 //
 // filters 待实现拦截器/过滤器方法数组
 func (ghr *GHttpRouter) Get(pattern string, handler Handler, filters ...Filter) {
-	go ghr.repo(http.MethodGet, pattern, nil, handler, nil, filters...)
+	ghr.register(http.MethodGet, pattern, nil, handler, nil, filters...)
 }
 
 // Head 发起一个 Head 请求接收项目
@@ -118,7 +141,7 @@ func (ghr *GHttpRouter) Get(pattern string, handler Handler, filters ...Filter)
 //
 // filters 待实现拦截器/过滤器方法数组
 func (ghr *GHttpRouter) Head(pattern string, handler Handler, filters ...Filter) {
-	go ghr.repo(http.MethodHead, pattern, nil, handler, nil, filters...)
+	ghr.register(http.MethodHead, pattern, nil, handler, nil, filters...)
 }
 
 // Post 发起一个 Post 请求接收项目
@@ -134,7 +157,7 @@ func (ghr *GHttpRouter) Head(pattern string, handler Handler, filters ...Filter)
 //
 // filters 待实现拦截器/过滤器方法数组
 func (ghr *GHttpRouter) Post(pattern string, handler Handler, filters ...Filter) {
-	go ghr.repo(http.MethodPost, pattern, nil, handler, nil, filters...)
+	ghr.register(http.MethodPost, pattern, nil, handler, nil, filters...)
 }
 
 // Put 发起一个 Put 请求接收项目
@@ -149,7 +172,7 @@ func (ghr *GHttpRouter) Post(pattern string, handler Handler, filters ...Filter)
 //
 // filters 待实现拦截器/过滤器方法数组
 func (ghr *GHttpRouter) Put(pattern string, handler Handler, filters ...Filter) {
-	go ghr.repo(http.MethodPut, pattern, nil, handler, nil, filters...)
+	ghr.register(http.MethodPut, pattern, nil, handler, nil, filters...)
 }
 
 // Patch 发起一个 Patch 请求接收项目
@@ -166,7 +189,7 @@ func (ghr *GHttpRouter) Put(pattern string, handler Handler, filters ...Filter)
 //
 // filters 待实现拦截器/过滤器方法数组
 func (ghr *GHttpRouter) Patch(pattern string, handler Handler, filters ...Filter) {
-	go ghr.repo(http.MethodPatch, pattern, nil, handler, nil, filters...)
+	ghr.register(http.MethodPatch, pattern, nil, handler, nil, filters...)
 }
 
 // Delete 发起一个 Delete 请求接收项目
@@ -182,7 +205,7 @@ func (ghr *GHttpRouter) Patch(pattern string, handler Handler, filters ...Filter
 //
 // filters 待实现拦截器/过滤器方法数组
 func (ghr *GHttpRouter) Delete(pattern string, handler Handler, filters ...Filter) {
-	go ghr.repo(http.MethodDelete, pattern, nil, handler, nil, filters...)
+	ghr.register(http.MethodDelete, pattern, nil, handler, nil, filters...)
 }
 
 // Connect 发起一个 Connect 请求接收项目
@@ -197,7 +220,7 @@ func (ghr *GHttpRouter) Delete(pattern string, handler Handler, filters ...Filte
 //
 // filters 待实现拦截器/过滤器方法数组
 func (ghr *GHttpRouter) Connect(pattern string, handler Handler, filters ...Filter) {
-	go ghr.repo(http.MethodConnect, pattern, nil, handler, nil, filters...)
+	ghr.register(http.MethodConnect, pattern, nil, handler, nil, filters...)
 }
 
 // Option 发起一个 Options 请求接收项目
@@ -214,7 +237,7 @@ func (ghr *GHttpRouter) Connect(pattern string, handler Handler, filters ...Filt
 //
 // filters 待实现拦截器/过滤器方法数组
 func (ghr *GHttpRouter) Option(pattern string, handler Handler, filters ...Filter) {
-	go ghr.repo(http.MethodOptions, pattern, nil, handler, nil, filters...)
+	ghr.register(http.MethodOptions, pattern, nil, handler, nil, filters...)
 }
 
 // Trace 发起一个 Trace 请求接收项目
@@ -229,7 +252,7 @@ func (ghr *GHttpRouter) Option(pattern string, handler Handler, filters ...Filte
 //
 // filters 待实现拦截器/过滤器方法数组
 func (ghr *GHttpRouter) Trace(pattern string, handler Handler, filters ...Filter) {
-	go ghr.repo(http.MethodTrace, pattern, nil, handler, nil, filters...)
+	ghr.register(http.MethodTrace, pattern, nil, handler, nil, filters...)
 }
 
 // Gets 发起一个 Get 请求接收项目
@@ -245,7 +268,7 @@ func (ghr *GHttpRouter) Trace(pattern string, handler Handler, filters ...Filter
 //
 // filters 待实现拦截器/过滤器方法数组
 func (ghr *GHttpRouter) Gets(pattern string, extend *Extend, handler Handler, filters ...Filter) {
-	go ghr.repo(http.MethodGet, pattern, extend, handler, nil, filters...)
+	ghr.register(http.MethodGet, pattern, extend, handler, nil, filters...)
 }
 
 // Heads 发起一个 Head 请求接收项目
@@ -262,7 +285,7 @@ func (ghr *GHttpRouter) Gets(pattern string, extend *Extend, handler Handler, fi
 //
 // filters 待实现拦截器/过滤器方法数组
 func (ghr *GHttpRouter) Heads(pattern string, extend *Extend, handler Handler, filters ...Filter) {
-	go ghr.repo(http.MethodHead, pattern, extend, handler, nil, filters...)
+	ghr.register(http.MethodHead, pattern, extend, handler, nil, filters...)
 }
 
 // Posts 发起一个 Post 请求接收项目
@@ -278,7 +301,7 @@ func (ghr *GHttpRouter) Heads(pattern string, extend *Extend, handler Handler, f
 //
 // filters 待实现拦截器/过滤器方法数组
 func (ghr *GHttpRouter) Posts(pattern string, extend *Extend, handler Handler, filters ...Filter) {
-	go ghr.repo(http.MethodPost, pattern, extend, handler, nil, filters...)
+	ghr.register(http.MethodPost, pattern, extend, handler, nil, filters...)
 }
 
 // Puts 发起一个 Put 请求接收项目
@@ -293,7 +316,7 @@ func (ghr *GHttpRouter) Posts(pattern string, extend *Extend, handler Handler, f
 //
 // filters 待实现拦截器/过滤器方法数组
 func (ghr *GHttpRouter) Puts(pattern string, extend *Extend, handler Handler, filters ...Filter) {
-	go ghr.repo(http.MethodPut, pattern, extend, handler, nil, filters...)
+	ghr.register(http.MethodPut, pattern, extend, handler, nil, filters...)
 }
 
 // Patches 发起一个 Patch 请求接收项目
@@ -310,7 +333,7 @@ func (ghr *GHttpRouter) Puts(pattern string, extend *Extend, handler Handler, fi
 //
 // filters 待实现拦截器/过滤器方法数组
 func (ghr *GHttpRouter) Patches(pattern string, extend *Extend, handler Handler, filters ...Filter) {
-	go ghr.repo(http.MethodPatch, pattern, extend, handler, nil, filters...)
+	ghr.register(http.MethodPatch, pattern, extend, handler, nil, filters...)
 }
 
 // Deletes 发起一个 Delete 请求接收项目
@@ -326,7 +349,7 @@ func (ghr *GHttpRouter) Patches(pattern string, extend *Extend, handler Handler,
 //
 // filters 待实现拦截器/过滤器方法数组
 func (ghr *GHttpRouter) Deletes(pattern string, extend *Extend, handler Handler, filters ...Filter) {
-	go ghr.repo(http.MethodDelete, pattern, extend, handler, nil, filters...)
+	ghr.register(http.MethodDelete, pattern, extend, handler, nil, filters...)
 }
 
 // Connects 发起一个 Connect 请求接收项目
@@ -341,7 +364,7 @@ func (ghr *GHttpRouter) Deletes(pattern string, extend *Extend, handler Handler,
 //
 // filters 待实现拦截器/过滤器方法数组
 func (ghr *GHttpRouter) Connects(pattern string, extend *Extend, handler Handler, filters ...Filter) {
-	go ghr.repo(http.MethodConnect, pattern, extend, handler, nil, filters...)
+	ghr.register(http.MethodConnect, pattern, extend, handler, nil, filters...)
 }
 
 // Options 发起一个 Options 请求接收项目
@@ -358,7 +381,7 @@ func (ghr *GHttpRouter) Connects(pattern string, extend *Extend, handler Handler
 //
 // filters 待实现拦截器/过滤器方法数组
 func (ghr *GHttpRouter) Options(pattern string, extend *Extend, handler Handler, filters ...Filter) {
-	go ghr.repo(http.MethodOptions, pattern, extend, handler, nil, filters...)
+	ghr.register(http.MethodOptions, pattern, extend, handler, nil, filters...)
 }
 
 // Traces 发起一个 Trace 请求接收项目
@@ -373,20 +396,22 @@ func (ghr *GHttpRouter) Options(pattern string, extend *Extend, handler Handler,
 //
 // filters 待实现拦截器/过滤器方法数组
 func (ghr *GHttpRouter) Traces(pattern string, extend *Extend, handler Handler, filters ...Filter) {
-	go ghr.repo(http.MethodTrace, pattern, extend, handler, nil, filters...)
+	ghr.register(http.MethodTrace, pattern, extend, handler, nil, filters...)
 }
 
 // Proxies 发起一个 Proxy 请求接收项目
 //
 // PROXY 代理http请求相关
 //
+// method 代理的请求方法，如“http.MethodGet”，同一代理需要代理多个请求方法时应分别新建 Proxy
+//
 // pattern 项目路径，如“/demo/:id/:name”，与路由根路径相结合，最终会通过类似“http://127.0.0.1:8080/test/demo/1/g”方式进行访问
 //
-// model 期望接收的结构，如“&Test{}”，最终在Handler方法中得以调用
+// proxy 请求代理结构
 //
-// handler 待实现接收请求方法
+// extend 扩展方案，如限流等
 //
 // filters 待实现拦截器/过滤器方法数组
-func (ghr *GHttpRouter) Proxies(pattern string, proxy *Proxy, extend *Extend, filters ...Filter) {
-	go ghr.repo(http.MethodTrace, pattern, extend, nil, proxy, filters...)
+func (ghr *GHttpRouter) Proxies(method, pattern string, proxy *Proxy, extend *Extend, filters ...Filter) {
+	ghr.register(method, pattern, extend, nil, proxy, filters...)
 }
@@ -0,0 +1,241 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/aberic/gnomon"
+	"github.com/aberic/gnomon/grope/tune"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"text/tabwriter"
+)
+
+// Route 已注册的路由信息
+type Route struct {
+	Host        string      `json:"host,omitempty"`        // 虚拟主机匹配规则，如“api.example.com”，为空表示服务本身的路由
+	Method      string      `json:"method"`                // 请求方法，如“GET”
+	Pattern     string      `json:"pattern"`               // 完整路由，如“/test/demo/:id”
+	Filters     int         `json:"filters"`               // 过滤器数量，包括服务及路由组的过滤器
+	Limit       *Limit      `json:"limit,omitempty"`       // 限流策略
+	MaxBodySize int64       `json:"maxBodySize,omitempty"` // 请求体允许的最大长度（字节）
+	Concurrency string      `json:"concurrency,omitempty"` // 并发限制及统计，如“limit=8/10 inFlight=3 waiting=0/20 rejected=5 aimd”
+	Proxy       *RouteProxy `json:"proxy,omitempty"`       // 请求代理信息
+}
+
+// RouteProxy 路由请求代理信息
+type RouteProxy struct {
+	Balance string   `json:"balance"`          // 负载模型，如“round”
+	Targets []string `json:"targets"`          // 代理目标，如“localhost:8080/demo weight=1 subset=canary”，已排空的目标附加“drained active=0”
+	Rules   []string `json:"rules,omitempty"`  // 按匹配顺序排列的分流规则及命中次数，如“1. beta header:X-Canary=[true] -> canary hits=3”
+	Mirror  string   `json:"mirror,omitempty"` // 流量镜像及对比统计，如“localhost:9090 10% mirrored=20 diffs=1 errors=0 latency=2ms shadowLatency=3ms”
+	Retry   string   `json:"retry,omitempty"`  // 重试策略，如“attempts=3 statuses=[502 503 504] backoff=100ms”
+}
+
+// RouteMatch 请求匹配结果
+type RouteMatch struct {
+	Route  *Route            `json:"route"`            // 命中的路由
+	Values map[string]string `json:"values,omitempty"` // URL及虚拟主机中自定义的参数集合，如“/demo/:id”中的id
+	Params map[string]string `json:"params,omitempty"` // 请求params
+}
+
+func newRoute(nd *node) *Route {
+	route := &Route{Method: nd.method, Pattern: nd.pattern, Filters: len(nd.filters)}
+	if extend := nd.extension(); nil != extend {
+		route.Limit = extend.Limit
+		route.MaxBodySize = extend.MaxBodySize
+		if nil != extend.Concurrency {
+			route.Concurrency = extend.Concurrency.String()
+		}
+	}
+	if nil != nd.proxy {
+		route.Proxy = &RouteProxy{Balance: nd.proxy.Balance.String()}
+		nd.proxy.lock.RLock()
+		for _, target := range nd.proxy.Target {
+			desc := fmt.Sprintf("%s:%s%s weight=%d", target.Host, target.Port, target.Pattern, target.Weight)
+			if target.Subset != "" {
+				desc = fmt.Sprintf("%s subset=%s", desc, target.Subset)
+			}
+			if target.drained {
+				desc = fmt.Sprintf("%s drained active=%d", desc, atomic.LoadInt32(&target.active))
+			}
+			route.Proxy.Targets = append(route.Proxy.Targets, desc)
+		}
+		nd.proxy.lock.RUnlock()
+		for index, rule := range nd.proxy.Rules {
+			route.Proxy.Rules = append(route.Proxy.Rules, fmt.Sprintf("%d. %s", index+1, rule))
+		}
+		if nil != nd.proxy.Mirror {
+			route.Proxy.Mirror = nd.proxy.Mirror.String()
+		}
+		if nil != nd.proxy.Retry {
+			route.Proxy.Retry = nd.proxy.Retry.String()
+		}
+	}
+	return route
+}
+
+// WaitRoutes 等待服务及其虚拟主机中已调用的路由注册全部完成
+//
+// Get、Post 等方法异步注册路由，在启动监听前或测试中需要路由立即生效时调用
+func (ghs *GHttpServe) WaitRoutes() {
+	for _, serve := range ghs.serves() {
+		serve.nodal.pending.Wait()
+	}
+}
+
+// Routes 获取服务及其虚拟主机中已注册的所有路由，按虚拟主机、路由及请求方法排序
+func (ghs *GHttpServe) Routes() []*Route {
+	var routes []*Route
+	for _, serve := range ghs.serves() {
+		serve.nodal.walk(func(nd *node) {
+			if gnomon.StringIsNotEmpty(nd.method) {
+				route := newRoute(nd)
+				route.Host = serve.host
+				routes = append(routes, route)
+			}
+		})
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Host != routes[j].Host {
+			return routes[i].Host < routes[j].Host
+		}
+		if routes[i].Pattern == routes[j].Pattern {
+			return routes[i].Method < routes[j].Method
+		}
+		return routes[i].Pattern < routes[j].Pattern
+	})
+	return routes
+}
+
+// Match 测试指定请求方法、主机及路径将会命中的路由，与 ServeHTTP 一致地匹配虚拟主机，不会触发限流等处理
+//
+// method 请求方法，如“GET”
+//
+// host 请求主机，如“api.example.com”，可以携带端口，为空或未匹配任何虚拟主机时在当前服务中查找
+//
+// path 请求路径，可以携带params，如“/test/demo/1?name=hello”
+func (ghs *GHttpServe) Match(method, host, path string) (*RouteMatch, bool) {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	reqURL, err := url.ParseRequestURI(path)
+	if nil != err {
+		return nil, false
+	}
+	serve, hostValues := ghs.virtualHost(host)
+	pattern, paramMap := serve.parseURLParams(&http.Request{URL: reqURL})
+	serve.nodal.lock.RLock()
+	defer serve.nodal.lock.RUnlock()
+	nd := serve.nodal.fetchSplitArr(pattern, method, strings.Split(pattern, "/")[1:], 0)
+	if nil == nd {
+		return nil, false
+	}
+	match := &RouteMatch{Route: newRoute(nd), Values: map[string]string{}, Params: paramMap}
+	match.Route.Host = serve.host
+	for key, value := range hostValues {
+		match.Values[key] = value
+	}
+	psURLReq := strings.Split(pattern, "/")[1:]
+	for index, p := range strings.Split(nd.pattern, "/")[1:] {
+		if len(p) > 0 && p[0] == ':' {
+			match.Values[p[1:]] = psURLReq[index]
+		}
+	}
+	return match, true
+}
+
+// RoutesHandler 路由表调试处理方法，可挂载到任意路由
+//
+// 默认返回文本格式的路由表，请求params中format=json或Accept为"application/json"时返回JSON格式；
+// 请求params中携带method及path时返回该请求将会命中的路由，如“?method=GET&path=/test/demo/1”，携带host时按虚拟主机匹配
+func (ghs *GHttpServe) RoutesHandler() Handler {
+	return func(ctx *Context) {
+		jsonFormat := ctx.Param("format") == "json" || strings.Contains(ctx.HeaderGet("Accept"), tune.ContentTypeJSON)
+		if path := ctx.Param("path"); path != "" {
+			method := ctx.Param("method")
+			if method == "" {
+				method = http.MethodGet
+			}
+			match, ok := ghs.Match(strings.ToUpper(method), ctx.Param("host"), path)
+			if !ok {
+				ctx.responseMessage(http.StatusNotFound, fmt.Sprintf("no route matches %s %s%s", method, ctx.Param("host"), path))
+				return
+			}
+			if jsonFormat {
+				_ = ctx.ResponseJSON(http.StatusOK, match)
+				return
+			}
+			_ = ctx.ResponseText(http.StatusOK, routesTable([]*Route{match.Route}))
+			return
+		}
+		routes := ghs.Routes()
+		if jsonFormat {
+			_ = ctx.ResponseJSON(http.StatusOK, &struct {
+				Routes []*Route `json:"routes"`
+			}{Routes: routes})
+			return
+		}
+		_ = ctx.ResponseText(http.StatusOK, routesTable(routes))
+	}
+}
+
+// routesTable 将路由信息格式化为文本表格
+func routesTable(routes []*Route) string {
+	var (
+		buf bytes.Buffer
+		tw  = tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	)
+	_, _ = fmt.Fprintln(tw, "METHOD\tHOST\tPATTERN\tFILTERS\tLIMIT\tMAX BODY\tPROXY")
+	for _, route := range routes {
+		host, limit, maxBody, proxy := "-", "-", "-", "-"
+		if route.Host != "" {
+			host = route.Host
+		}
+		if nil != route.Limit {
+			limit = fmt.Sprintf("%d/%dms interval=%dms",
+				route.Limit.LimitCount, route.Limit.LimitMillisecond, route.Limit.LimitIntervalMillisecond)
+		}
+		if route.Concurrency != "" {
+			if nil == route.Limit {
+				limit = fmt.Sprintf("concurrency [%s]", route.Concurrency)
+			} else {
+				limit = fmt.Sprintf("%s concurrency [%s]", limit, route.Concurrency)
+			}
+		}
+		if route.MaxBodySize != 0 {
+			maxBody = fmt.Sprintf("%d", route.MaxBodySize)
+		}
+		if nil != route.Proxy {
+			proxy = fmt.Sprintf("%s [%s]", route.Proxy.Balance, strings.Join(route.Proxy.Targets, ", "))
+			if len(route.Proxy.Rules) > 0 {
+				proxy = fmt.Sprintf("%s rules [%s]", proxy, strings.Join(route.Proxy.Rules, ", "))
+			}
+			if route.Proxy.Mirror != "" {
+				proxy = fmt.Sprintf("%s mirror [%s]", proxy, route.Proxy.Mirror)
+			}
+			if route.Proxy.Retry != "" {
+				proxy = fmt.Sprintf("%s retry [%s]", proxy, route.Proxy.Retry)
+			}
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n", route.Method, host, route.Pattern, route.Filters, limit, maxBody, proxy)
+	}
+	_ = tw.Flush()
+	return buf.String()
+}
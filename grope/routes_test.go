@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"encoding/json"
+	"github.com/aberic/gnomon/balance"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRoutes(t *testing.T) {
+	gs := NewHTTPServe(func(ctx *Context) {})
+	router := gs.Group("/v1", func(ctx *Context) {})
+	router.Gets("/users/:id", &Extend{Limit: &Limit{LimitMillisecond: 1000, LimitCount: 10}}, func(ctx *Context) {})
+	router.Post("/users", func(ctx *Context) {})
+	router.Proxies(http.MethodGet, "/remote", &Proxy{Balance: balance.Round, Target: []*Target{
+		{Host: "localhost", Port: "8080", Pattern: "/demo", Weight: 1},
+	}}, nil)
+	gs.Group("/debug").Get("/routes", gs.RoutesHandler())
+	gs.WaitRoutes()
+	routes := gs.Routes()
+	if len(routes) != 4 || routes[0].Pattern != "/debug/routes" {
+		t.Fatalf("unexpected routes %d", len(routes))
+	}
+	for _, route := range routes {
+		if route.Pattern == "/v1/users/:id" && (route.Filters != 2 || nil == route.Limit || route.Limit.LimitCount != 10) {
+			t.Errorf("unexpected route %+v", route)
+		}
+		if route.Pattern == "/v1/remote" && (nil == route.Proxy || route.Proxy.Balance != "round" || len(route.Proxy.Targets) != 1) {
+			t.Errorf("unexpected proxy route %+v", route)
+		}
+	}
+
+	match, ok := gs.Match(http.MethodGet, "", "/v1/users/7?verbose=true")
+	if !ok || match.Route.Pattern != "/v1/users/:id" || match.Values["id"] != "7" || match.Params["verbose"] != "true" {
+		t.Fatalf("unexpected match %+v", match)
+	}
+	if _, ok = gs.Match(http.MethodPut, "", "/v1/users/7"); ok {
+		t.Errorf("expect no match")
+	}
+
+	rec := httptest.NewRecorder()
+	gs.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/routes", nil))
+	if !strings.Contains(rec.Body.String(), "/v1/users/:id") || !strings.HasPrefix(rec.Body.String(), "METHOD") {
+		t.Errorf("unexpected table %s", rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	gs.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/routes?format=json&method=post&path=/v1/users", nil))
+	result := &RouteMatch{}
+	if err := json.Unmarshal(rec.Body.Bytes(), result); nil != err || result.Route.Method != http.MethodPost {
+		t.Errorf("unexpected json %s", rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	gs.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/routes?path=/none", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expect 404, got %d", rec.Code)
+	}
+}
+
+func TestRoutesVirtualHost(t *testing.T) {
+	gs := NewHTTPServe()
+	gs.Group("/v1").Get("/users", func(ctx *Context) {})
+	gs.Host("api.example.com").Group("/v1").Get("/users", func(ctx *Context) {})
+	gs.Host(":tenant.example.com").Group("/v1").Post("/orders", func(ctx *Context) {})
+	gs.WaitRoutes()
+
+	var routes []string
+	for _, route := range gs.Routes() {
+		routes = append(routes, route.Host+" "+route.Method+" "+route.Pattern)
+	}
+	expect := []string{" GET /v1/users", ":tenant.example.com POST /v1/orders", "api.example.com GET /v1/users"}
+	if strings.Join(routes, ",") != strings.Join(expect, ",") {
+		t.Errorf("expect routes %v, got %v", expect, routes)
+	}
+	if table := routesTable(gs.Routes()); !strings.Contains(table, "api.example.com") {
+		t.Errorf("expect host column, got %s", table)
+	}
+
+	doc := gs.OpenAPI(&OpenAPIInfo{Title: "gnomon", Version: "1.0.0"})
+	if op := doc.Paths["/v1/users"]["get"]; nil == op || op.Host != "" {
+		t.Errorf("expect serve route to take precedence, got %+v", op)
+	}
+	if op := doc.Paths["/v1/orders"]["post"]; nil == op || op.Host != ":tenant.example.com" {
+		t.Errorf("expect virtual host route, got %+v", op)
+	}
+	if op := gs.Host("api.example.com").OpenAPI(&OpenAPIInfo{}).Paths["/v1/users"]["get"]; nil == op || op.Host != "api.example.com" {
+		t.Errorf("expect virtual host document, got %+v", op)
+	}
+
+	// 与 ServeHTTP 一致地按主机匹配虚拟主机
+	if match, ok := gs.Match(http.MethodGet, "API.example.com:8080", "/v1/users"); !ok || match.Route.Host != "api.example.com" {
+		t.Errorf("expect virtual host route, got %+v", match)
+	}
+	if match, ok := gs.Match(http.MethodGet, "example.org", "/v1/users"); !ok || match.Route.Host != "" {
+		t.Errorf("expect serve route for unknown host, got %+v", match)
+	}
+	match, ok := gs.Match(http.MethodPost, "acme.example.com", "/v1/orders")
+	if !ok || match.Route.Host != ":tenant.example.com" || match.Values["tenant"] != "acme" {
+		t.Errorf("expect pattern host route, got %+v", match)
+	}
+	if _, ok = gs.Match(http.MethodPost, "", "/v1/orders"); ok {
+		t.Errorf("expect no match without host")
+	}
+	rec := httptest.NewRecorder()
+	gs.Host("api.example.com").Group("/debug").Get("/routes", gs.RoutesHandler())
+	gs.WaitRoutes()
+	req := httptest.NewRequest(http.MethodGet, "/debug/routes?format=json&method=post&host=acme.example.com&path=/v1/orders", nil)
+	req.Host = "api.example.com"
+	gs.ServeHTTP(rec, req)
+	result := &RouteMatch{}
+	if err := json.Unmarshal(rec.Body.Bytes(), result); nil != err || result.Route.Host != ":tenant.example.com" {
+		t.Errorf("unexpected json %s", rec.Body.String())
+	}
+}
@@ -16,10 +16,13 @@ package grope
 
 import (
 	"encoding/json"
+	"github.com/aberic/gnomon"
 	"github.com/aberic/gnomon/grope/tune"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 )
 
 // newGHttpServe 新建一个Http服务
@@ -30,7 +33,34 @@ func newGHttpServe(filters ...Filter) *GHttpServe {
 
 // GHttpServe Http服务
 type GHttpServe struct {
-	nodal *node
+	nodal        *node
+	maxBodySize  int64                  // 请求体允许的最大长度（字节），0表示不限
+	parent       *GHttpServe            // 虚拟主机所属的服务
+	host         string                 // 虚拟主机匹配规则，如“api.example.com”，非虚拟主机为空
+	exactHosts   map[string]*GHttpServe // 精确匹配的虚拟主机集合
+	patternHosts []*virtualHost         // 通配符及参数匹配的虚拟主机数组
+	hostLock     sync.RWMutex
+	trusted      *gnomon.TrustedProxies // 可信代理，nil表示使用 gnomon.IPTrustedProxiesSet 的设置
+	templates    *Templates             // 页面渲染使用的模板
+}
+
+// SetMaxBodySize 设置请求体允许的最大长度（字节），超出则返回413
+//
+// size 0表示不限，路由可通过 Extend.MaxBodySize 单独设置，虚拟主机未设置时使用所属服务的配置
+func (ghs *GHttpServe) SetMaxBodySize(size int64) {
+	ghs.maxBodySize = size
+}
+
+// SetTrustedProxies 设置可信代理，仅当请求来自可信代理时 Context.ClientIP、Context.Scheme 及 Context.Host 才使用转发请求头
+//
+// cidrs 可信代理的IP或CIDR网段，如“10.0.0.0/8”、“127.0.0.1”
+func (ghs *GHttpServe) SetTrustedProxies(cidrs ...string) error {
+	trusted, err := gnomon.NewTrustedProxies(cidrs...)
+	if nil != err {
+		return err
+	}
+	ghs.trusted = trusted
+	return nil
 }
 
 // Group 设置路由根路径
@@ -50,17 +80,27 @@ func (ghs *GHttpServe) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 // doMethod 处理请求具体方法
 func (ghs *GHttpServe) doServe(w http.ResponseWriter, r *http.Request) {
-	var ctx = &Context{writer: w, request: r, valueMap: map[string]string{}}
-	pattern, paramMap := ghs.parseURLParams(r)
+	var (
+		resp = &responseWriter{ResponseWriter: w}
+		ctx  = &Context{writer: resp, resp: resp, request: r, valueMap: map[string]string{}, serve: ghs}
+	)
+	serve, hostValues := ghs.virtualHost(r.Host)
+	ctx.templates = serve.templateSet()
+	for key, value := range hostValues {
+		ctx.valueMap[key] = value
+	}
+	pattern, paramMap := serve.parseURLParams(r)
 	ctx.paramMap = paramMap
-	n := ghs.nodal.fetch(pattern, r.Method)
+	n, limited := serve.nodal.fetch(pattern, r.Method)
 	if nil == n {
 		http.NotFound(w, r)
 		return
-	} else if nil != n.error {
+	} else if limited {
 		w.Header().Set("Content-Type", tune.ContentTypeJSON)
 		w.WriteHeader(http.StatusOK)
-		bytes, _ := json.Marshal(n.error)
+		bytes, _ := json.Marshal(&struct {
+			Message string `json:"message"`
+		}{Message: "request limit, please retry later"})
 		_, _ = w.Write(bytes)
 		return
 	}
@@ -71,18 +111,38 @@ func (ghs *GHttpServe) doServe(w http.ResponseWriter, r *http.Request) {
 			ctx.valueMap[p[1:]] = psURLReq[index]
 		}
 	}
-	ghs.execRoute(ctx, n)
+	if !serve.limitBody(ctx, n) {
+		return
+	}
+	serve.execRoute(ctx, n)
 }
 
 // execRoute 处理请求逻辑
 func (ghs *GHttpServe) execRoute(ctx *Context, nodal *node) {
+	if extend := nodal.extension(); nil != extend && nil != extend.Concurrency {
+		concurrency := extend.Concurrency
+		if !concurrency.acquire(ctx.request.Context()) {
+			ctx.HeaderSet("Retry-After", "1")
+			ctx.responseMessage(http.StatusServiceUnavailable, ErrConcurrencyLimit.Error())
+			return
+		}
+		defer func(start time.Time) { concurrency.release(time.Since(start)) }(time.Now())
+	}
+	defer ctx.finish()
 	for _, filter := range nodal.filters { // 过滤无效请求
 		filter(ctx)
 		if ctx.responded {
 			return
 		}
+		if ctx.bodyTooLarge {
+			ctx.responseBodyTooLarge()
+			return
+		}
 	}
 	nodal.parseHandler(ctx)
+	if ctx.bodyTooLarge && !ctx.resp.written() {
+		ctx.responseBodyTooLarge()
+	}
 }
 
 func (ghs *GHttpServe) parseURLParams(r *http.Request) (pattern string, paramMap map[string]string) {
@@ -0,0 +1,304 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/aberic/gnomon"
+	"github.com/aberic/gnomon/log"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrSessionInvalid session invalid
+	ErrSessionInvalid = errors.New("session invalid")
+	// ErrSessionNotExist session not exist
+	ErrSessionNotExist = errors.New("session not exist")
+)
+
+// SessionOption 会话策略
+type SessionOption struct {
+	Name            string        // 会话cookie名称，默认“GROPESESSID”
+	SignKey         []byte        // 会话cookie签名密钥（HMAC-SHA256），必填
+	EncryptKey      []byte        // 会话数据加密密钥（AES，长度16、24或32），仅cookie存储时有效，为空则不加密
+	Store           SessionStore  // 服务端会话存储，nil表示会话数据全部保存在cookie中
+	IdleTimeout     time.Duration // 会话空闲超时时间，默认30分钟
+	AbsoluteTimeout time.Duration // 会话绝对超时时间，自创建起计算，默认24小时
+	Path            string        // 会话cookie路径，默认“/”
+	Domain          string        // 会话cookie域名
+	Secure          bool          // 会话cookie是否仅通过https传输
+}
+
+// SessionFilter 会话过滤器
+//
+// 会话可通过 Context.Session 获取，首次获取时加载或新建，处理结束前自动保存；
+// 未获取会话的请求不读写会话存储，新建的会话仅在被修改后保存并写入cookie
+func SessionFilter(option *SessionOption) Filter {
+	if len(option.SignKey) == 0 {
+		panic("session sign key must be set")
+	}
+	if len(option.EncryptKey) > 0 {
+		if _, err := aes.NewCipher(option.EncryptKey); nil != err {
+			panic(err)
+		}
+	}
+	if option.Name == "" {
+		option.Name = "GROPESESSID"
+	}
+	if option.IdleTimeout <= 0 {
+		option.IdleTimeout = 30 * time.Minute
+	}
+	if option.AbsoluteTimeout <= 0 {
+		option.AbsoluteTimeout = 24 * time.Hour
+	}
+	return option.filter
+}
+
+func (so *SessionOption) filter(ctx *Context) {
+	ctx.sessionOption = so
+	ctx.resp.before(func() {
+		if nil != ctx.session {
+			so.save(ctx, ctx.session)
+		}
+	})
+}
+
+// session 加载请求会话，不存在或已失效则新建
+func (so *SessionOption) session(ctx *Context) *Session {
+	session, err := so.load(ctx)
+	if nil != err {
+		session = newSession()
+	}
+	return session
+}
+
+// load 根据请求cookie加载会话，会话不存在或已过期则返回错误
+func (so *SessionOption) load(ctx *Context) (*Session, error) {
+	value, err := ctx.Cookie(so.Name)
+	if nil != err {
+		return nil, err
+	}
+	payload, err := so.verify(value)
+	if nil != err {
+		return nil, err
+	}
+	var data []byte
+	if nil == so.Store {
+		data = payload
+		if len(so.EncryptKey) > 0 {
+			if len(data) < aes.BlockSize {
+				return nil, ErrSessionInvalid
+			}
+			data = gnomon.AESDecryptCFB(data, so.EncryptKey)
+		}
+	} else if data, err = so.Store.Get(string(payload)); nil != err {
+		return nil, err
+	}
+	session := &Session{}
+	if err = json.Unmarshal(data, &session.data); nil != err {
+		return nil, err
+	}
+	now := time.Now()
+	if now.Sub(time.Unix(0, session.data.Accessed)) > so.IdleTimeout ||
+		now.Sub(time.Unix(0, session.data.Created)) > so.AbsoluteTimeout {
+		if nil != so.Store {
+			_ = so.Store.Delete(session.data.ID)
+		}
+		return nil, ErrSessionInvalid
+	}
+	return session, nil
+}
+
+// save 保存会话并写入会话cookie
+func (so *SessionOption) save(ctx *Context, session *Session) {
+	session.lock.Lock()
+	defer session.lock.Unlock()
+	if session.fresh && !session.dirty {
+		// 新建且未被修改的会话无需保存
+		return
+	}
+	if session.destroyed {
+		if session.fresh {
+			return
+		}
+		if nil != so.Store {
+			_ = so.Store.Delete(session.data.ID)
+		}
+		ctx.SetCookie(so.Name, "", -1, so.Path, so.Domain, so.Secure, true)
+		return
+	}
+	if nil != so.Store && session.oldID != "" {
+		_ = so.Store.Delete(session.oldID)
+	}
+	session.data.Accessed = time.Now().UnixNano()
+	remain := so.AbsoluteTimeout - time.Since(time.Unix(0, session.data.Created))
+	data, err := json.Marshal(session.data)
+	if nil != err {
+		log.Error("session save", log.Err(err))
+		return
+	}
+	var payload []byte
+	if nil == so.Store {
+		payload = data
+		if len(so.EncryptKey) > 0 {
+			payload = gnomon.AESEncryptCFB(data, so.EncryptKey)
+		}
+	} else {
+		ttl := so.IdleTimeout
+		if remain < ttl {
+			ttl = remain
+		}
+		if err = so.Store.Save(session.data.ID, data, ttl); nil != err {
+			log.Error("session save", log.Err(err))
+			return
+		}
+		payload = []byte(session.data.ID)
+	}
+	ctx.SetCookie(so.Name, so.sign(payload), int(remain/time.Second), so.Path, so.Domain, so.Secure, true)
+}
+
+// sign 签名并编码为“payload.signature”
+func (so *SessionOption) sign(payload []byte) string {
+	mac := hmac.New(sha256.New, so.SignKey)
+	_, _ = mac.Write(payload)
+	return strings.Join([]string{
+		base64.RawURLEncoding.EncodeToString(payload),
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil)),
+	}, ".")
+}
+
+// verify 校验签名并返回payload
+func (so *SessionOption) verify(value string) ([]byte, error) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 2 {
+		return nil, ErrSessionInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if nil != err {
+		return nil, ErrSessionInvalid
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if nil != err {
+		return nil, ErrSessionInvalid
+	}
+	mac := hmac.New(sha256.New, so.SignKey)
+	_, _ = mac.Write(payload)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, ErrSessionInvalid
+	}
+	return payload, nil
+}
+
+// sessionData 会话持久化数据
+type sessionData struct {
+	ID       string                 `json:"id"`
+	Values   map[string]interface{} `json:"values"`
+	Created  int64                  `json:"created"`  // 创建时间（纳秒）
+	Accessed int64                  `json:"accessed"` // 最后访问时间（纳秒）
+}
+
+// Session 请求会话，会话数据以JSON格式持久化
+type Session struct {
+	data      sessionData
+	oldID     string // 轮换前的会话ID，保存时从服务端存储中删除
+	fresh     bool   // 是否为本次请求新建的会话
+	dirty     bool   // 会话数据是否被修改
+	destroyed bool
+	lock      sync.RWMutex
+}
+
+func newSession() *Session {
+	now := time.Now().UnixNano()
+	return &Session{data: sessionData{ID: sessionID(), Values: map[string]interface{}{}, Created: now, Accessed: now}, fresh: true}
+}
+
+// sessionID 生成随机会话ID
+func sessionID() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); nil != err {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// ID 获取会话ID
+func (s *Session) ID() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.data.ID
+}
+
+// Get 获取会话中指定Key的值
+func (s *Session) Get(key string) interface{} {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.data.Values[key]
+}
+
+// Set 设置会话中指定Key的值，值需要支持JSON序列化
+func (s *Session) Set(key string, value interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if nil == s.data.Values {
+		s.data.Values = map[string]interface{}{}
+	}
+	s.data.Values[key] = value
+	s.dirty = true
+}
+
+// Delete 删除会话中指定Key的值
+func (s *Session) Delete(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.data.Values, key)
+	s.dirty = true
+}
+
+// Rotate 轮换会话ID并保留会话数据，建议在登录等权限变化后调用以防止会话固定攻击
+func (s *Session) Rotate() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.oldID == "" {
+		s.oldID = s.data.ID
+	}
+	s.data.ID = sessionID()
+	s.dirty = true
+}
+
+// Destroy 销毁会话并清除会话cookie
+func (s *Session) Destroy() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.destroyed = true
+	s.dirty = true
+	s.data.Values = map[string]interface{}{}
+}
+
+// Session 获取通过 SessionFilter 加载的请求会话，未使用会话过滤器则返回nil
+func (c *Context) Session() *Session {
+	if nil == c.session && nil != c.sessionOption {
+		c.session = c.sessionOption.session(c)
+	}
+	return c.session
+}
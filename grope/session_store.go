@@ -0,0 +1,222 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SessionStore 服务端会话存储
+type SessionStore interface {
+	// Get 获取会话数据，会话不存在或已过期则返回 ErrSessionNotExist
+	Get(id string) ([]byte, error)
+	// Save 保存会话数据
+	//
+	// ttl 会话数据有效时间
+	Save(id string, data []byte, ttl time.Duration) error
+	// Delete 删除会话数据
+	Delete(id string) error
+}
+
+// sessionEntry 会话存储条目
+type sessionEntry struct {
+	Data   []byte `json:"data"`
+	Expire int64  `json:"expire"` // 过期时间（纳秒）
+}
+
+func (se *sessionEntry) expired() bool {
+	return time.Now().UnixNano() > se.Expire
+}
+
+// MemorySessionStore 内存会话存储
+type MemorySessionStore struct {
+	entries  map[string]*sessionEntry
+	lock     sync.RWMutex
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewMemorySessionStore 新建内存会话存储
+//
+// interval 清理过期会话的时间间隔，0表示不主动清理，仅在读取时删除过期会话，主动清理的存储不再使用时需调用 Close
+func NewMemorySessionStore(interval time.Duration) *MemorySessionStore {
+	mss := &MemorySessionStore{entries: map[string]*sessionEntry{}, stop: make(chan struct{})}
+	if interval > 0 {
+		go mss.clean(interval)
+	}
+	return mss
+}
+
+// Get 获取会话数据
+func (mss *MemorySessionStore) Get(id string) ([]byte, error) {
+	mss.lock.RLock()
+	entry, exist := mss.entries[id]
+	mss.lock.RUnlock()
+	if !exist {
+		return nil, ErrSessionNotExist
+	}
+	if entry.expired() {
+		_ = mss.Delete(id)
+		return nil, ErrSessionNotExist
+	}
+	return entry.Data, nil
+}
+
+// Save 保存会话数据
+func (mss *MemorySessionStore) Save(id string, data []byte, ttl time.Duration) error {
+	defer mss.lock.Unlock()
+	mss.lock.Lock()
+	mss.entries[id] = &sessionEntry{Data: data, Expire: time.Now().Add(ttl).UnixNano()}
+	return nil
+}
+
+// Delete 删除会话数据
+func (mss *MemorySessionStore) Delete(id string) error {
+	defer mss.lock.Unlock()
+	mss.lock.Lock()
+	delete(mss.entries, id)
+	return nil
+}
+
+// Close 停止清理过期会话
+func (mss *MemorySessionStore) Close() {
+	mss.stopOnce.Do(func() {
+		close(mss.stop)
+	})
+}
+
+// clean 定时清理过期会话
+func (mss *MemorySessionStore) clean(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-mss.stop:
+			return
+		case <-ticker.C:
+			mss.lock.Lock()
+			for id, entry := range mss.entries {
+				if entry.expired() {
+					delete(mss.entries, id)
+				}
+			}
+			mss.lock.Unlock()
+		}
+	}
+}
+
+// FileSessionStore 文件会话存储，每个会话保存为目录下的一个文件
+type FileSessionStore struct {
+	dir  string
+	lock sync.RWMutex
+}
+
+// NewFileSessionStore 新建文件会话存储
+//
+// dir 会话文件保存目录，不存在则自动创建
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if err := os.MkdirAll(dir, 0700); nil != err {
+		return nil, err
+	}
+	return &FileSessionStore{dir: dir}, nil
+}
+
+// path 会话文件路径，会话ID非法时返回空
+func (fss *FileSessionStore) path(id string) string {
+	if id == "" {
+		return ""
+	}
+	for _, char := range id {
+		if !(char >= '0' && char <= '9' || char >= 'a' && char <= 'f') { // 会话ID仅包含十六进制字符
+			return ""
+		}
+	}
+	return filepath.Join(fss.dir, id)
+}
+
+// Get 获取会话数据
+func (fss *FileSessionStore) Get(id string) ([]byte, error) {
+	path := fss.path(id)
+	if path == "" {
+		return nil, ErrSessionNotExist
+	}
+	fss.lock.RLock()
+	bytes, err := ioutil.ReadFile(path)
+	fss.lock.RUnlock()
+	if nil != err {
+		if os.IsNotExist(err) {
+			return nil, ErrSessionNotExist
+		}
+		return nil, err
+	}
+	entry := &sessionEntry{}
+	if err = json.Unmarshal(bytes, entry); nil != err {
+		return nil, err
+	}
+	if entry.expired() {
+		_ = fss.Delete(id)
+		return nil, ErrSessionNotExist
+	}
+	return entry.Data, nil
+}
+
+// Save 保存会话数据
+func (fss *FileSessionStore) Save(id string, data []byte, ttl time.Duration) error {
+	path := fss.path(id)
+	if path == "" {
+		return ErrSessionInvalid
+	}
+	bytes, err := json.Marshal(&sessionEntry{Data: data, Expire: time.Now().Add(ttl).UnixNano()})
+	if nil != err {
+		return err
+	}
+	defer fss.lock.Unlock()
+	fss.lock.Lock()
+	return ioutil.WriteFile(path, bytes, 0600)
+}
+
+// Delete 删除会话数据
+func (fss *FileSessionStore) Delete(id string) error {
+	path := fss.path(id)
+	if path == "" {
+		return nil
+	}
+	defer fss.lock.Unlock()
+	fss.lock.Lock()
+	if err := os.Remove(path); nil != err && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Clean 删除所有已过期的会话文件
+func (fss *FileSessionStore) Clean() error {
+	files, err := ioutil.ReadDir(fss.dir)
+	if nil != err {
+		return err
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		_, _ = fss.Get(file.Name()) // 读取时删除已过期的会话文件
+	}
+	return nil
+}
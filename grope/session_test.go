@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func sessionServe(option *SessionOption) *GHttpServe {
+	gs := NewHTTPServe(SessionFilter(option))
+	router := gs.Group("/session")
+	router.Get("/login", func(ctx *Context) {
+		ctx.Session().Rotate()
+		ctx.Session().Set("user", "aberic")
+		_ = ctx.ResponseText(http.StatusOK, ctx.Session().ID())
+	})
+	router.Get("/user", func(ctx *Context) {
+		user, _ := ctx.Session().Get("user").(string)
+		_ = ctx.ResponseText(http.StatusOK, user)
+	})
+	router.Get("/logout", func(ctx *Context) {
+		ctx.Session().Destroy()
+	})
+	router.Get("/ping", func(ctx *Context) {
+		_ = ctx.ResponseText(http.StatusOK, "pong")
+	})
+	gs.WaitRoutes()
+	return gs
+}
+
+func sessionDo(gs *GHttpServe, path string, cookie *http.Cookie) (string, *http.Cookie) {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if nil != cookie {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	gs.ServeHTTP(rec, req)
+	cookies := rec.Result().Cookies()
+	if len(cookies) == 0 {
+		return rec.Body.String(), nil
+	}
+	return rec.Body.String(), cookies[0]
+}
+
+func testSession(t *testing.T, option *SessionOption) {
+	gs := sessionServe(option)
+	id, cookie := sessionDo(gs, "/session/login", nil)
+	if nil == cookie || id == "" {
+		t.Fatal("expect session cookie")
+	}
+	user, cookie := sessionDo(gs, "/session/user", cookie)
+	if user != "aberic" {
+		t.Errorf("expect user aberic, got %q", user)
+	}
+	forged := *cookie
+	forged.Value = forged.Value[:len(forged.Value)-2] + "xx"
+	if user, _ = sessionDo(gs, "/session/user", &forged); user != "" {
+		t.Errorf("forged cookie should be rejected, got %q", user)
+	}
+	_, cookie = sessionDo(gs, "/session/logout", cookie)
+	if nil == cookie || cookie.MaxAge >= 0 {
+		t.Errorf("expect session cookie removed")
+	}
+}
+
+func TestSessionCookie(t *testing.T) {
+	testSession(t, &SessionOption{SignKey: []byte("sign"), EncryptKey: []byte("0123456789abcdef")})
+}
+
+func TestSessionMemoryStore(t *testing.T) {
+	testSession(t, &SessionOption{SignKey: []byte("sign"), Store: NewMemorySessionStore(0)})
+}
+
+func TestSessionFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grope-session")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	store, err := NewFileSessionStore(dir)
+	if nil != err {
+		t.Fatal(err)
+	}
+	testSession(t, &SessionOption{SignKey: []byte("sign"), Store: store})
+	if _, err = store.Get("../session"); err != ErrSessionNotExist {
+		t.Errorf("expect invalid session id rejected, got %v", err)
+	}
+}
+
+func TestSessionIdleTimeout(t *testing.T) {
+	store := NewMemorySessionStore(0)
+	gs := sessionServe(&SessionOption{SignKey: []byte("sign"), Store: store, IdleTimeout: 50 * time.Millisecond})
+	oldID, cookie := sessionDo(gs, "/session/login", nil)
+	time.Sleep(100 * time.Millisecond)
+	if user, _ := sessionDo(gs, "/session/user", cookie); user != "" {
+		t.Errorf("expect idle session expired, got %q", user)
+	}
+	if _, err := store.Get(oldID); err != ErrSessionNotExist {
+		t.Errorf("expect expired session removed, got %v", err)
+	}
+}
+
+func TestSessionLazy(t *testing.T) {
+	store := NewMemorySessionStore(0)
+	gs := sessionServe(&SessionOption{SignKey: []byte("sign"), Store: store})
+	// 未使用或仅读取新建会话的请求不写入存储及cookie
+	for _, path := range []string{"/session/ping", "/session/user", "/session/logout"} {
+		if _, cookie := sessionDo(gs, path, nil); nil != cookie {
+			t.Errorf("%s: expect no session cookie, got %v", path, cookie)
+		}
+	}
+	if len(store.entries) != 0 {
+		t.Errorf("expect empty store, got %d entries", len(store.entries))
+	}
+	_, cookie := sessionDo(gs, "/session/login", nil)
+	if nil == cookie || len(store.entries) != 1 {
+		t.Fatal("expect session saved after login")
+	}
+	if _, refreshed := sessionDo(gs, "/session/ping", cookie); nil != refreshed {
+		t.Errorf("expect untouched session not saved, got %v", refreshed)
+	}
+	if _, refreshed := sessionDo(gs, "/session/user", cookie); nil == refreshed {
+		t.Error("expect accessed session refreshed")
+	}
+}
+
+func TestMemorySessionStoreClean(t *testing.T) {
+	store := NewMemorySessionStore(10 * time.Millisecond)
+	_ = store.Save("a", []byte("a"), time.Millisecond)
+	count := func() int {
+		store.lock.RLock()
+		defer store.lock.RUnlock()
+		return len(store.entries)
+	}
+	for i := 0; i < 50 && count() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if count() != 0 {
+		t.Fatal("expect expired session cleaned")
+	}
+	// 关闭后不再清理
+	store.Close()
+	store.Close()
+	_ = store.Save("b", []byte("b"), time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	if count() != 1 {
+		t.Errorf("expect cleaning stopped after close, got %d entries", count())
+	}
+}
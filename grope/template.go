@@ -0,0 +1,284 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/aberic/gnomon/log"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrTemplatesNotSet templates not set
+	ErrTemplatesNotSet = errors.New("templates not set")
+	// ErrTemplateNotFound template not found
+	ErrTemplateNotFound = errors.New("template not found")
+)
+
+// Templates HTML模板注册表
+//
+// Dir 下“layouts/”目录中的文件为布局，“partials/”目录中的文件为公共片段，其余文件为页面，
+// 模板名称为相对 Dir 的路径去除扩展名，如“layouts/base”、“partials/nav”及“users/list”；
+// 每个页面与全部布局及公共片段组成独立的模板集合，因此不同页面可以定义同名的块，如“content”
+//
+// 模板中可使用以下与请求相关的方法：
+//
+//	csrfToken  同 Context.CSRFToken
+//	csrfField  包含CSRF令牌的隐藏表单项，未使用 CSRFFilter 则为空
+//	session    同 Context.Session，未使用 SessionFilter 则为nil
+type Templates struct {
+	Dir    string           // 模板根目录
+	Ext    string           // 模板文件扩展名，默认“.html”
+	Layout string           // 默认布局名称，如“layouts/base”，为空则直接渲染页面，布局通过“{{template "content" .}}”引用页面内容
+	Funcs  template.FuncMap // 自定义模板方法，不能与请求相关的方法同名
+	// 是否在模板文件变化后自动重新加载，每次渲染前检查文件修改时间，建议仅在非生产环境开启
+	Reload   bool
+	lock     sync.RWMutex
+	ext      string
+	pages    map[string]*templatePage
+	modTimes map[string]time.Time
+}
+
+// templatePage 页面模板集合
+//
+// 已加载的模板集合仅用于克隆，克隆时一次性绑定与请求相关的方法，方法通过 templateRequest 获取当前请求，
+// 克隆后的模板集合在首次渲染时完成转义并缓存复用，渲染时不再克隆
+type templatePage struct {
+	set  *template.Template
+	pool sync.Pool // *templateExec
+}
+
+// templateExec 可复用的模板集合，同一时间仅用于一次渲染
+type templateExec struct {
+	set     *template.Template
+	request *templateRequest
+}
+
+// templateRequest 与请求相关的模板方法所使用的请求，ctx 为nil时仅用于解析模板
+type templateRequest struct {
+	ctx *Context
+}
+
+// acquire 获取可复用的模板集合，没有空闲的模板集合时克隆新的模板集合
+func (p *templatePage) acquire() (*templateExec, error) {
+	if exec, ok := p.pool.Get().(*templateExec); ok {
+		return exec, nil
+	}
+	set, err := p.set.Clone()
+	if nil != err {
+		return nil, err
+	}
+	exec := &templateExec{set: set, request: &templateRequest{}}
+	set.Funcs(templateRequestFuncs(exec.request))
+	return exec, nil
+}
+
+// release 归还模板集合，不再持有请求
+func (p *templatePage) release(exec *templateExec) {
+	exec.request.ctx = nil
+	p.pool.Put(exec)
+}
+
+// SetTemplates 加载并设置页面渲染使用的模板，虚拟主机未设置时使用所属服务的模板
+func (ghs *GHttpServe) SetTemplates(templates *Templates) error {
+	if err := templates.Load(); nil != err {
+		return err
+	}
+	ghs.templates = templates
+	return nil
+}
+
+// templateSet 页面渲染使用的模板，虚拟主机未设置时使用所属服务的模板
+func (ghs *GHttpServe) templateSet() *Templates {
+	if nil == ghs.templates && nil != ghs.parent {
+		return ghs.parent.templates
+	}
+	return ghs.templates
+}
+
+// Load 重新加载全部模板，任一模板解析失败则保持原有模板不变
+func (t *Templates) Load() error {
+	ext := t.Ext
+	if ext == "" {
+		ext = ".html"
+	}
+	var (
+		shared   []string
+		pages    []string
+		contents = map[string]string{}
+		modTimes = map[string]time.Time{}
+	)
+	err := filepath.Walk(t.Dir, func(path string, info os.FileInfo, err error) error {
+		if nil != err {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ext {
+			return nil
+		}
+		rel, err := filepath.Rel(t.Dir, path)
+		if nil != err {
+			return err
+		}
+		content, err := ioutil.ReadFile(path)
+		if nil != err {
+			return err
+		}
+		name := strings.TrimSuffix(filepath.ToSlash(rel), ext)
+		if strings.HasPrefix(name, "layouts/") || strings.HasPrefix(name, "partials/") {
+			shared = append(shared, name)
+		} else {
+			pages = append(pages, name)
+		}
+		contents[name] = string(content)
+		modTimes[path] = info.ModTime()
+		return nil
+	})
+	if nil != err {
+		return err
+	}
+	base := template.New("").Funcs(templateRequestFuncs(&templateRequest{}))
+	if nil != t.Funcs {
+		base.Funcs(t.Funcs)
+	}
+	for _, name := range shared {
+		if _, err := base.New(name).Parse(contents[name]); nil != err {
+			return err
+		}
+	}
+	sets := make(map[string]*templatePage, len(pages))
+	for _, name := range pages {
+		set, err := base.Clone()
+		if nil != err {
+			return err
+		}
+		if _, err := set.New(name).Parse(contents[name]); nil != err {
+			return err
+		}
+		sets[name] = &templatePage{set: set}
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.ext, t.pages, t.modTimes = ext, sets, modTimes
+	return nil
+}
+
+// changed 模板文件是否发生增删或修改
+func (t *Templates) changed() bool {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	count := 0
+	err := filepath.Walk(t.Dir, func(path string, info os.FileInfo, err error) error {
+		if nil != err {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != t.ext {
+			return nil
+		}
+		if modTime, ok := t.modTimes[path]; !ok || !info.ModTime().Equal(modTime) {
+			return errTemplateChanged
+		}
+		count++
+		return nil
+	})
+	return nil != err || count != len(t.modTimes)
+}
+
+// errTemplateChanged 用于提前结束模板目录遍历
+var errTemplateChanged = errors.New("template changed")
+
+// execute 渲染页面，Reload 开启且模板文件变化时先重新加载
+func (t *Templates) execute(ctx *Context, name string, data interface{}) ([]byte, error) {
+	if t.Reload && t.changed() {
+		if err := t.Load(); nil != err {
+			log.Error("Templates Reload", log.Field("dir", t.Dir), log.Err(err))
+			return nil, err
+		}
+		log.Info("Templates Reload", log.Field("dir", t.Dir))
+	}
+	t.lock.RLock()
+	page, ok := t.pages[name]
+	t.lock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	exec, err := page.acquire()
+	if nil != err {
+		return nil, err
+	}
+	defer page.release(exec)
+	exec.request.ctx = ctx
+	entry := name
+	if t.Layout != "" {
+		entry = t.Layout
+	}
+	var buf bytes.Buffer
+	if err := exec.set.ExecuteTemplate(&buf, entry, data); nil != err {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// templateRequestFuncs 与请求相关的模板方法，request.ctx 为nil时返回空值
+func templateRequestFuncs(request *templateRequest) template.FuncMap {
+	return template.FuncMap{
+		"csrfToken": func() string {
+			if nil == request.ctx {
+				return ""
+			}
+			return request.ctx.CSRFToken()
+		},
+		"csrfField": func() template.HTML {
+			ctx := request.ctx
+			if nil == ctx || nil == ctx.csrfToken {
+				return ""
+			}
+			return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`,
+				template.HTMLEscapeString(ctx.csrfField), template.HTMLEscapeString(ctx.CSRFToken())))
+		},
+		"session": func() *Session {
+			if nil == request.ctx {
+				return nil
+			}
+			return request.ctx.Session()
+		},
+	}
+}
+
+// Render 使用 GHttpServe.SetTemplates 设置的模板渲染页面并返回"text/html"，渲染失败时不写入任何响应
+//
+// statusCode eg:http.StatusOK
+//
+// name 页面名称，如“users/list”
+func (c *Context) Render(statusCode int, name string, data interface{}) error {
+	if nil == c.templates {
+		return ErrTemplatesNotSet
+	}
+	page, err := c.templates.execute(c, name, data)
+	if nil != err {
+		return err
+	}
+	c.responded = true
+	c.HeaderSet("Content-Type", "text/html; charset=utf-8")
+	c.Status(statusCode)
+	return c.response(page)
+}
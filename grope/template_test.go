@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeTemplates(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); nil != err {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); nil != err {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestContext_Render(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grope-template")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	writeTemplates(t, dir, map[string]string{
+		"layouts/base.html":  `<title>{{block "title" .}}admin{{end}}</title>{{template "partials/nav" .}}<main>{{template "content" .}}</main>`,
+		"partials/nav.html":  `<nav>{{with session}}{{.Get "user"}}{{end}}</nav>`,
+		"index.html":         `{{define "content"}}{{upper .Name}}{{end}}`,
+		"users/edit.html":    `{{define "title"}}edit{{end}}{{define "content"}}<form>{{csrfField}}{{.Name}}</form>{{end}}`,
+		"users/ignored.tmpl": `{{`,
+	})
+	templates := &Templates{
+		Dir:    dir,
+		Layout: "layouts/base",
+		Funcs:  template.FuncMap{"upper": strings.ToUpper},
+		Reload: true,
+	}
+	gs := NewHTTPServe(SessionFilter(&SessionOption{SignKey: []byte("sign")}), CSRFFilter(&CSRF{}))
+	router := gs.Group("/admin")
+	router.repo(http.MethodGet, "/:page", nil, func(ctx *Context) {
+		ctx.Session().Set("user", "aberic")
+		name := ctx.Value("page")
+		if name == "edit" {
+			name = "users/edit"
+		}
+		if err := ctx.Render(http.StatusOK, name, map[string]string{"Name": "<b>grope</b>"}); nil != err {
+			_ = ctx.ResponseText(http.StatusInternalServerError, err.Error())
+		}
+	}, nil)
+	client := NewTestClient(gs)
+
+	client.Get("/admin/index").MustDo(t).AssertStatus(t, http.StatusInternalServerError).AssertText(t, ErrTemplatesNotSet.Error())
+	if err := gs.SetTemplates(templates); nil != err {
+		t.Fatal(err)
+	}
+	resp := client.Get("/admin/index").MustDo(t).AssertStatus(t, http.StatusOK)
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/html; charset=utf-8" {
+		t.Errorf("unexpected content type %q", contentType)
+	}
+	resp.AssertText(t, `<title>admin</title><nav>aberic</nav><main>&lt;B&gt;GROPE&lt;/B&gt;</main>`)
+
+	text := client.Get("/admin/edit").MustDo(t).AssertStatus(t, http.StatusOK).Text()
+	if !strings.HasPrefix(text, `<title>edit</title><nav>aberic</nav><main><form><input type="hidden" name="_csrf" value="`) ||
+		!strings.HasSuffix(text, `">&lt;b&gt;grope&lt;/b&gt;</form></main>`) {
+		t.Errorf("unexpected page %s", text)
+	}
+	if text := client.Get("/admin/missing").MustDo(t).AssertStatus(t, http.StatusInternalServerError).Text(); !strings.Contains(text, ErrTemplateNotFound.Error()) {
+		t.Errorf("expect template not found, got %s", text)
+	}
+
+	// 模板文件变化后重新加载
+	writeTemplates(t, dir, map[string]string{"index.html": `{{define "content"}}v2{{end}}`})
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(dir, "index.html"), future, future); nil != err {
+		t.Fatal(err)
+	}
+	client.Get("/admin/index").MustDo(t).AssertText(t, `<title>admin</title><nav>aberic</nav><main>v2</main>`)
+	writeTemplates(t, dir, map[string]string{"missing.html": `{{define "content"}}found{{end}}`})
+	client.Get("/admin/missing").MustDo(t).AssertText(t, `<title>admin</title><nav>aberic</nav><main>found</main>`)
+
+	// 解析失败时保留原有模板
+	writeTemplates(t, dir, map[string]string{"broken.html": `{{`})
+	if err := templates.Load(); nil == err {
+		t.Error("expect parse error")
+	}
+	templates.Reload = false
+	client.Get("/admin/missing").MustDo(t).AssertStatus(t, http.StatusOK)
+	if _, err := templates.execute(&Context{}, "broken", nil); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("expect ErrTemplateNotFound, got %v", err)
+	}
+}
+
+func TestTemplatesConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grope-template")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	writeTemplates(t, dir, map[string]string{"form.html": `<form>{{csrfField}}{{.}}</form>`})
+	templates := &Templates{Dir: dir}
+	if err := templates.Load(); nil != err {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				field := fmt.Sprintf("field%d", i)
+				page, err := templates.execute(&Context{csrfToken: []byte("token"), csrfField: field}, "form", j)
+				if nil != err {
+					t.Error(err)
+					return
+				}
+				if text := string(page); !strings.Contains(text, `name="`+field+`"`) || !strings.HasSuffix(text, fmt.Sprintf(">%d</form>", j)) {
+					t.Errorf("unexpected page %s", text)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	// 复用的模板集合使用当前请求，未使用 CSRFFilter 时不输出表单项
+	page, _ := templates.execute(&Context{}, "form", 0)
+	if string(page) != `<form>0</form>` {
+		t.Errorf("unexpected page %s", page)
+	}
+}
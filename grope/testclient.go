@@ -0,0 +1,403 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"encoding/xml"
+	"github.com/aberic/gnomon/grope/tune"
+	"github.com/golang/protobuf/proto"
+	"github.com/vmihailenco/msgpack"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// TestingT 测试断言所需的最小接口，*testing.T 与 *testing.B 均已实现
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// TestClient 进程内测试客户端，直接调用 GHttpServe.ServeHTTP 而无需启动监听
+//
+// 客户端持有cookie jar，前一次响应设置的cookie会在后续请求中自动携带
+type TestClient struct {
+	ghs    *GHttpServe
+	host   string
+	jar    http.CookieJar
+	header http.Header
+}
+
+// NewTestClient 新建进程内测试客户端，默认请求地址为“http://example.com”
+func NewTestClient(ghs *GHttpServe) *TestClient {
+	jar, _ := cookiejar.New(nil)
+	return &TestClient{ghs: ghs, host: "http://example.com", jar: jar, header: http.Header{}}
+}
+
+// SetHost 设置请求地址，如“https://localhost:8080”，影响请求的Host、TLS状态及cookie作用域
+func (tc *TestClient) SetHost(host string) *TestClient {
+	tc.host = strings.TrimSuffix(host, "/")
+	return tc
+}
+
+// SetHeader 设置每次请求都携带的请求头
+func (tc *TestClient) SetHeader(key, value string) *TestClient {
+	tc.header.Set(key, value)
+	return tc
+}
+
+// Cookies 获取当前cookie jar中对指定路径生效的cookie
+func (tc *TestClient) Cookies(path string) []*http.Cookie {
+	u, err := url.Parse(tc.host + path)
+	if nil != err {
+		return nil
+	}
+	return tc.jar.Cookies(u)
+}
+
+// ClearCookies 清空cookie jar
+func (tc *TestClient) ClearCookies() {
+	tc.jar, _ = cookiejar.New(nil)
+}
+
+// Get 构建一个 Get 请求
+func (tc *TestClient) Get(path string) *TestRequest {
+	return tc.Request(http.MethodGet, path)
+}
+
+// Head 构建一个 Head 请求
+func (tc *TestClient) Head(path string) *TestRequest {
+	return tc.Request(http.MethodHead, path)
+}
+
+// Post 构建一个 Post 请求
+func (tc *TestClient) Post(path string) *TestRequest {
+	return tc.Request(http.MethodPost, path)
+}
+
+// Put 构建一个 Put 请求
+func (tc *TestClient) Put(path string) *TestRequest {
+	return tc.Request(http.MethodPut, path)
+}
+
+// Patch 构建一个 Patch 请求
+func (tc *TestClient) Patch(path string) *TestRequest {
+	return tc.Request(http.MethodPatch, path)
+}
+
+// Delete 构建一个 Delete 请求
+func (tc *TestClient) Delete(path string) *TestRequest {
+	return tc.Request(http.MethodDelete, path)
+}
+
+// Request 构建一个指定方法的请求
+//
+// path 请求路径，可以携带params，如“/test/demo/1?name=hello”
+func (tc *TestClient) Request(method, path string) *TestRequest {
+	header := http.Header{}
+	for key, values := range tc.header {
+		header[key] = append([]string{}, values...)
+	}
+	return &TestRequest{client: tc, method: method, path: path, header: header, query: url.Values{}}
+}
+
+// TestRequest 测试请求构建器
+type TestRequest struct {
+	client  *TestClient
+	method  string
+	path    string
+	header  http.Header
+	query   url.Values
+	cookies []*http.Cookie
+	body    []byte
+	err     error
+}
+
+// Header 设置请求头
+func (tr *TestRequest) Header(key, value string) *TestRequest {
+	tr.header.Set(key, value)
+	return tr
+}
+
+// Query 追加请求params
+func (tr *TestRequest) Query(key, value string) *TestRequest {
+	tr.query.Add(key, value)
+	return tr
+}
+
+// Cookie 在cookie jar之外额外携带cookie
+func (tr *TestRequest) Cookie(cookie *http.Cookie) *TestRequest {
+	tr.cookies = append(tr.cookies, cookie)
+	return tr
+}
+
+// Body 设置原始请求体及Content-Type
+func (tr *TestRequest) Body(contentType string, body []byte) *TestRequest {
+	tr.header.Set("Content-Type", contentType)
+	tr.body = body
+	return tr
+}
+
+// JSON 设置"application/json"请求体
+func (tr *TestRequest) JSON(model interface{}) *TestRequest {
+	return tr.marshal(tune.ContentTypeJSON, json.Marshal, model)
+}
+
+// XML 设置"application/xml"请求体
+func (tr *TestRequest) XML(model interface{}) *TestRequest {
+	return tr.marshal(tune.ContentTypeXML, xml.Marshal, model)
+}
+
+// Yaml 设置"application/x-yaml"请求体
+func (tr *TestRequest) Yaml(model interface{}) *TestRequest {
+	return tr.marshal(tune.ContentTypeYaml, yaml.Marshal, model)
+}
+
+// MsgPack 设置"application/x-msgpack"请求体
+func (tr *TestRequest) MsgPack(model interface{}) *TestRequest {
+	return tr.marshal(tune.ContentTypeMsgPack, msgpack.Marshal, model)
+}
+
+// ProtoBuf 设置"application/x-protobuf"请求体
+func (tr *TestRequest) ProtoBuf(pm proto.Message) *TestRequest {
+	return tr.marshal(tune.ContentTypeProtoBuf, func(v interface{}) ([]byte, error) {
+		return proto.Marshal(v.(proto.Message))
+	}, pm)
+}
+
+// Form 设置"application/x-www-form-urlencoded"请求体
+func (tr *TestRequest) Form(values url.Values) *TestRequest {
+	return tr.Body(tune.ContentTypePostForm, []byte(values.Encode()))
+}
+
+// Text 设置"text/plain"请求体
+func (tr *TestRequest) Text(text string) *TestRequest {
+	return tr.Body(tune.ContentTypePlain, []byte(text))
+}
+
+func (tr *TestRequest) marshal(contentType string, marshal func(v interface{}) ([]byte, error), model interface{}) *TestRequest {
+	body, err := marshal(model)
+	if nil != err {
+		tr.err = err
+		return tr
+	}
+	return tr.Body(contentType, body)
+}
+
+// Do 在进程内执行请求，并将响应设置的cookie保存到cookie jar中
+//
+// 执行前等待已调用的路由注册全部完成，参见 GHttpServe.WaitRoutes
+func (tr *TestRequest) Do() (*TestResponse, error) {
+	if nil != tr.err {
+		return nil, tr.err
+	}
+	tr.client.ghs.WaitRoutes()
+	target := tr.path
+	if !strings.HasPrefix(target, "/") {
+		target = "/" + target
+	}
+	if len(tr.query) > 0 {
+		if strings.Contains(target, "?") {
+			target += "&" + tr.query.Encode()
+		} else {
+			target += "?" + tr.query.Encode()
+		}
+	}
+	jarURL, err := url.Parse(tr.client.host + target)
+	if nil != err {
+		return nil, err
+	}
+	var body io.Reader
+	if nil != tr.body {
+		body = bytes.NewReader(tr.body)
+	}
+	req := httptest.NewRequest(tr.method, target, body)
+	req.Host = jarURL.Host
+	if jarURL.Scheme == "https" {
+		req.TLS = &tls.ConnectionState{Version: tls.VersionTLS12, HandshakeComplete: true, ServerName: jarURL.Hostname()}
+	}
+	req.Header = tr.header
+	for _, cookie := range tr.client.jar.Cookies(jarURL) {
+		req.AddCookie(cookie)
+	}
+	for _, cookie := range tr.cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	tr.client.ghs.ServeHTTP(rec, req)
+	resp := rec.Result()
+	if cookies := resp.Cookies(); len(cookies) > 0 {
+		tr.client.jar.SetCookies(jarURL, cookies)
+	}
+	return &TestResponse{Response: resp, Body: rec.Body.Bytes()}, nil
+}
+
+// MustDo 在进程内执行请求，请求构建失败时通过t报告错误并返回空响应
+func (tr *TestRequest) MustDo(t TestingT) *TestResponse {
+	t.Helper()
+	resp, err := tr.Do()
+	if nil != err {
+		t.Errorf("grope test request %s %s: %v", tr.method, tr.path, err)
+		return &TestResponse{Response: &http.Response{Header: http.Header{}}}
+	}
+	return resp
+}
+
+// TestResponse 测试响应结果
+type TestResponse struct {
+	*http.Response
+	Body []byte // 响应体
+}
+
+// Text 获取字符串形式的响应体
+func (tr *TestResponse) Text() string {
+	return string(tr.Body)
+}
+
+// DecodeJSON 使用与 Context.ResponseJSON 相同的编码解析响应体
+func (tr *TestResponse) DecodeJSON(model interface{}) error {
+	return json.Unmarshal(tr.Body, model)
+}
+
+// DecodeXML 使用与 Context.ResponseXML 相同的编码解析响应体
+func (tr *TestResponse) DecodeXML(model interface{}) error {
+	return xml.Unmarshal(tr.Body, model)
+}
+
+// DecodeYaml 使用与 Context.ResponseYaml 相同的编码解析响应体
+func (tr *TestResponse) DecodeYaml(model interface{}) error {
+	return yaml.Unmarshal(tr.Body, model)
+}
+
+// DecodeMsgPack 使用与 Context.ResponseMsgPack 相同的编码解析响应体
+func (tr *TestResponse) DecodeMsgPack(model interface{}) error {
+	return msgpack.Unmarshal(tr.Body, model)
+}
+
+// DecodeProtoBuf 使用与 Context.ResponseProtoBuf 相同的编码解析响应体
+func (tr *TestResponse) DecodeProtoBuf(pm proto.Message) error {
+	return proto.Unmarshal(tr.Body, pm)
+}
+
+// AssertStatus 断言响应状态码
+func (tr *TestResponse) AssertStatus(t TestingT, statusCode int) *TestResponse {
+	t.Helper()
+	if tr.StatusCode != statusCode {
+		t.Errorf("expect status %d, got %d, body: %s", statusCode, tr.StatusCode, tr.Body)
+	}
+	return tr
+}
+
+// AssertHeader 断言响应头
+func (tr *TestResponse) AssertHeader(t TestingT, key, value string) *TestResponse {
+	t.Helper()
+	if got := tr.Header.Get(key); got != value {
+		t.Errorf("expect header %s %q, got %q", key, value, got)
+	}
+	return tr
+}
+
+// AssertText 断言字符串形式的响应体
+func (tr *TestResponse) AssertText(t TestingT, text string) *TestResponse {
+	t.Helper()
+	if got := tr.Text(); got != text {
+		t.Errorf("expect body %q, got %q", text, got)
+	}
+	return tr
+}
+
+// AssertJSON 断言响应体以JSON解析后与expect一致，expect为期望的结构，如“&Test{Name: "a"}”
+func (tr *TestResponse) AssertJSON(t TestingT, expect interface{}) *TestResponse {
+	t.Helper()
+	tr.assertDecoded(t, tune.ContentTypeJSON, tr.DecodeJSON, expect)
+	return tr
+}
+
+// AssertXML 断言响应体以XML解析后与expect一致
+func (tr *TestResponse) AssertXML(t TestingT, expect interface{}) *TestResponse {
+	t.Helper()
+	tr.assertDecoded(t, tune.ContentTypeXML, tr.DecodeXML, expect)
+	return tr
+}
+
+// AssertYaml 断言响应体以Yaml解析后与expect一致
+func (tr *TestResponse) AssertYaml(t TestingT, expect interface{}) *TestResponse {
+	t.Helper()
+	tr.assertDecoded(t, tune.ContentTypeYaml, tr.DecodeYaml, expect)
+	return tr
+}
+
+// AssertMsgPack 断言响应体以MsgPack解析后与expect一致
+func (tr *TestResponse) AssertMsgPack(t TestingT, expect interface{}) *TestResponse {
+	t.Helper()
+	tr.assertDecoded(t, tune.ContentTypeMsgPack, tr.DecodeMsgPack, expect)
+	return tr
+}
+
+// AssertProtoBuf 断言响应体以ProtoBuf解析后与expect一致
+func (tr *TestResponse) AssertProtoBuf(t TestingT, expect proto.Message) *TestResponse {
+	t.Helper()
+	if !tr.assertContentType(t, tune.ContentTypeProtoBuf) {
+		return tr
+	}
+	got := reflect.New(reflect.TypeOf(expect).Elem()).Interface().(proto.Message)
+	if err := tr.DecodeProtoBuf(got); nil != err {
+		t.Errorf("decode protobuf body: %v", err)
+	} else if !proto.Equal(got, expect) {
+		t.Errorf("expect body %v, got %v", expect, got)
+	}
+	return tr
+}
+
+func (tr *TestResponse) assertDecoded(t TestingT, contentType string, decode func(model interface{}) error, expect interface{}) {
+	t.Helper()
+	if !tr.assertContentType(t, contentType) {
+		return
+	}
+	expectType := reflect.TypeOf(expect)
+	var got reflect.Value
+	if expectType.Kind() == reflect.Ptr {
+		got = reflect.New(expectType.Elem())
+	} else {
+		got = reflect.New(expectType)
+	}
+	if err := decode(got.Interface()); nil != err {
+		t.Errorf("decode %s body: %v", contentType, err)
+		return
+	}
+	if expectType.Kind() != reflect.Ptr {
+		got = got.Elem()
+	}
+	if !reflect.DeepEqual(got.Interface(), expect) {
+		t.Errorf("expect body %+v, got %+v", expect, got.Interface())
+	}
+}
+
+func (tr *TestResponse) assertContentType(t TestingT, contentType string) bool {
+	t.Helper()
+	if got := tr.Header.Get("Content-Type"); !strings.HasPrefix(got, contentType) {
+		t.Errorf("expect content type %s, got %s", contentType, got)
+		return false
+	}
+	return true
+}
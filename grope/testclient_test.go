@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"fmt"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"net/http"
+	"testing"
+)
+
+type testClientUser struct {
+	Name string `json:"name" xml:"name" yaml:"name" msgpack:"name"`
+	Age  int    `json:"age" xml:"age" yaml:"age" msgpack:"age"`
+}
+
+type testClientRecorder struct {
+	errs []string
+}
+
+func (r *testClientRecorder) Helper() {}
+
+func (r *testClientRecorder) Errorf(format string, args ...interface{}) {
+	r.errs = append(r.errs, fmt.Sprintf(format, args...))
+}
+
+func TestTestClient(t *testing.T) {
+	gs := NewHTTPServe()
+	router := gs.Group("/client")
+	router.Post("/json", func(ctx *Context) {
+		user := &testClientUser{}
+		if err := ctx.ReceiveJSON(user); nil != err {
+			ctx.responseMessage(http.StatusBadRequest, err.Error())
+			return
+		}
+		user.Age++
+		_ = ctx.ResponseJSON(http.StatusOK, user)
+	})
+	router.Post("/xml", func(ctx *Context) {
+		user := &testClientUser{}
+		_ = ctx.ReceiveXML(user)
+		_ = ctx.ResponseXML(http.StatusOK, user)
+	})
+	router.Post("/yaml", func(ctx *Context) {
+		user := &testClientUser{}
+		_ = ctx.ReceiveYaml(user)
+		_ = ctx.ResponseYaml(http.StatusOK, user)
+	})
+	router.Post("/msgpack", func(ctx *Context) {
+		user := &testClientUser{}
+		_ = ctx.ReceiveMsgPack(user)
+		_ = ctx.ResponseMsgPack(http.StatusOK, user)
+	})
+	router.Post("/protobuf", func(ctx *Context) {
+		value := &wrappers.StringValue{}
+		_ = ctx.ReceiveProtoBuf(value)
+		_ = ctx.ResponseProtoBuf(http.StatusOK, value)
+	})
+	router.Get("/login", func(ctx *Context) {
+		ctx.SetCookie("user", ctx.Param("name"), 60, "", "", false, true)
+		_ = ctx.ResponseText(http.StatusOK, "ok")
+	})
+	router.Get("/me", func(ctx *Context) {
+		name, _ := ctx.Cookie("user")
+		_ = ctx.ResponseText(http.StatusOK, name)
+	})
+
+	tc := NewTestClient(gs)
+	user := &testClientUser{Name: "gnomon", Age: 1}
+	tc.Post("/client/json").JSON(user).MustDo(t).
+		AssertStatus(t, http.StatusOK).AssertJSON(t, &testClientUser{Name: "gnomon", Age: 2})
+	tc.Post("/client/xml").XML(user).MustDo(t).AssertXML(t, user)
+	tc.Post("/client/yaml").Yaml(user).MustDo(t).AssertYaml(t, *user)
+	tc.Post("/client/msgpack").MsgPack(user).MustDo(t).AssertMsgPack(t, user)
+	tc.Post("/client/protobuf").ProtoBuf(&wrappers.StringValue{Value: "gnomon"}).MustDo(t).
+		AssertProtoBuf(t, &wrappers.StringValue{Value: "gnomon"})
+
+	tc.Get("/client/login").Query("name", "aberic").MustDo(t).AssertText(t, "ok")
+	tc.Get("/client/me").MustDo(t).AssertText(t, "aberic")
+	if cookies := tc.Cookies("/client/me"); len(cookies) != 1 || cookies[0].Value != "aberic" {
+		t.Errorf("unexpected cookies %v", cookies)
+	}
+	tc.ClearCookies()
+	tc.Get("/client/me").MustDo(t).AssertText(t, "")
+
+	recorder := &testClientRecorder{}
+	tc.Post("/client/json").JSON(user).MustDo(t).
+		AssertStatus(recorder, http.StatusCreated).AssertXML(recorder, user).AssertJSON(recorder, user)
+	tc.Get("/client/none").MustDo(t).AssertStatus(recorder, http.StatusOK)
+	if len(recorder.errs) != 4 {
+		t.Errorf("expect 4 assertion errors, got %v", recorder.errs)
+	}
+}
@@ -0,0 +1,267 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"github.com/aberic/gnomon/log"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrTLSCertEmpty tls certificate is empty
+	ErrTLSCertEmpty = errors.New("tls certificate is empty")
+	// ErrTLSCACert tls ca certificate invalid
+	ErrTLSCACert = errors.New("tls ca certificate invalid")
+)
+
+// ClientAuth 客户端证书校验模式
+type ClientAuth int
+
+const (
+	// ClientAuthNone 不请求客户端证书
+	ClientAuthNone ClientAuth = iota
+	// ClientAuthRequest 请求客户端证书，客户端提供证书时才校验
+	ClientAuthRequest
+	// ClientAuthRequire 要求客户端提供证书并校验
+	ClientAuthRequire
+)
+
+// TLSCert 服务端证书文件
+type TLSCert struct {
+	CertFilePath string // 证书文件，如果证书是由证书颁发机构签署的，则应该是服务器证书、任何中间体和CA证书的连接
+	KeyFilePath  string // 与证书匹配的私钥文件
+}
+
+// TLSOption TLS配置
+type TLSOption struct {
+	// 服务端证书数组，根据客户端SNI选择证书中域名匹配的证书，未匹配时使用第一个证书
+	Certs []*TLSCert
+	// 用于校验客户端证书的根证书文件数组，未设置时仅请求客户端证书而不校验签发者
+	CACertFilePaths []string
+	// 客户端证书校验模式，默认不请求客户端证书
+	ClientAuth ClientAuth
+	// 允许的最低TLS版本，默认 tls.VersionTLS12
+	MinVersion uint16
+	// 允许的加密套件，为空时使用Go默认的加密套件，仅对TLS1.2及以下版本有效
+	CipherSuites []uint16
+	// 检查证书文件变化的间隔时间，文件变化后自动重新加载，默认10秒，负数表示不重新加载
+	ReloadInterval time.Duration
+}
+
+// ServerTLS 支持SNI多证书及证书文件热加载的TLS配置
+type ServerTLS struct {
+	option    *TLSOption
+	certs     []*tls.Certificate          // 按 TLSOption.Certs 顺序加载的证书
+	names     map[string]*tls.Certificate // 证书域名与证书的映射，域名可能为“*.example.com”
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time // 证书文件最后修改时间
+	// 通过ALPN协商的协议列表，由 ListenAndServeTLSConfig 根据 ServeOption.HTTP2 设置
+	nextProtos []string
+	lock       sync.RWMutex
+	stop       chan struct{}
+	stopOnce   sync.Once
+}
+
+// NewServerTLS 根据TLS配置加载证书，并在 ReloadInterval 不小于0时监听证书文件变化
+func NewServerTLS(option *TLSOption) (*ServerTLS, error) {
+	if len(option.Certs) == 0 {
+		return nil, ErrTLSCertEmpty
+	}
+	if option.MinVersion == 0 {
+		option.MinVersion = tls.VersionTLS12
+	}
+	if option.ReloadInterval == 0 {
+		option.ReloadInterval = 10 * time.Second
+	}
+	st := &ServerTLS{option: option, stop: make(chan struct{})}
+	if err := st.Reload(); nil != err {
+		return nil, err
+	}
+	if option.ReloadInterval > 0 {
+		go st.watch()
+	}
+	return st, nil
+}
+
+// Config 获取 tls.Config，证书及客户端根证书在每次握手时读取，因此热加载对已创建的配置同样有效
+func (st *ServerTLS) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion:         st.option.MinVersion,
+		CipherSuites:       st.option.CipherSuites,
+		ClientAuth:         st.clientAuthType(),
+		GetCertificate:     st.getCertificate,
+		GetConfigForClient: st.getConfigForClient,
+		NextProtos:         st.nextProtos,
+		Time:               time.Now,
+		Rand:               rand.Reader,
+	}
+}
+
+// Reload 重新加载全部证书文件，任一文件加载失败则保持原有证书不变
+func (st *ServerTLS) Reload() error {
+	var (
+		certs    []*tls.Certificate
+		names    = map[string]*tls.Certificate{}
+		modTimes = map[string]time.Time{}
+		pool     *x509.CertPool
+	)
+	for _, tlsCert := range st.option.Certs {
+		cert, err := tls.LoadX509KeyPair(tlsCert.CertFilePath, tlsCert.KeyFilePath)
+		if nil != err {
+			return err
+		}
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); nil != err {
+			return err
+		}
+		certs = append(certs, &cert)
+		for _, name := range certNames(cert.Leaf) {
+			if _, exist := names[name]; !exist {
+				names[name] = &cert
+			}
+		}
+		modTimes[tlsCert.CertFilePath] = fileModTime(tlsCert.CertFilePath)
+		modTimes[tlsCert.KeyFilePath] = fileModTime(tlsCert.KeyFilePath)
+	}
+	if len(st.option.CACertFilePaths) > 0 {
+		pool = x509.NewCertPool()
+		for _, caCertFilePath := range st.option.CACertFilePaths {
+			buf, err := ioutil.ReadFile(caCertFilePath)
+			if nil != err {
+				return err
+			}
+			if !pool.AppendCertsFromPEM(buf) {
+				return ErrTLSCACert
+			}
+			modTimes[caCertFilePath] = fileModTime(caCertFilePath)
+		}
+	}
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.certs, st.names, st.clientCAs, st.modTimes = certs, names, pool, modTimes
+	return nil
+}
+
+// Close 停止监听证书文件变化
+func (st *ServerTLS) Close() {
+	st.stopOnce.Do(func() {
+		close(st.stop)
+	})
+}
+
+// watch 定时检查证书文件修改时间，发生变化则重新加载
+func (st *ServerTLS) watch() {
+	ticker := time.NewTicker(st.option.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-st.stop:
+			return
+		case <-ticker.C:
+			if !st.changed() {
+				continue
+			}
+			if err := st.Reload(); nil != err {
+				log.Error("ServerTLS Reload", log.Err(err))
+			} else {
+				log.Info("ServerTLS Reload", log.Field("certs", len(st.option.Certs)))
+			}
+		}
+	}
+}
+
+// changed 证书文件是否发生变化
+func (st *ServerTLS) changed() bool {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	for filePath, modTime := range st.modTimes {
+		if !fileModTime(filePath).Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// getCertificate 根据客户端SNI选择证书，优先精确匹配，其次通配符匹配，均未匹配时使用第一个证书
+func (st *ServerTLS) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if cert, ok := st.names[name]; ok {
+		return cert, nil
+	}
+	if index := strings.Index(name, "."); index > 0 {
+		if cert, ok := st.names["*"+name[index:]]; ok {
+			return cert, nil
+		}
+	}
+	return st.certs[0], nil
+}
+
+// getConfigForClient 为每次握手提供当前加载的客户端根证书
+func (st *ServerTLS) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	config := st.Config()
+	config.GetConfigForClient = nil
+	st.lock.RLock()
+	config.ClientCAs = st.clientCAs
+	st.lock.RUnlock()
+	return config, nil
+}
+
+// clientAuthType 将客户端证书校验模式转换为 tls.ClientAuthType，未设置根证书时仅请求证书而不校验签发者
+func (st *ServerTLS) clientAuthType() tls.ClientAuthType {
+	verify := len(st.option.CACertFilePaths) > 0
+	switch st.option.ClientAuth {
+	case ClientAuthRequest:
+		if verify {
+			return tls.VerifyClientCertIfGiven
+		}
+		return tls.RequestClientCert
+	case ClientAuthRequire:
+		if verify {
+			return tls.RequireAndVerifyClientCert
+		}
+		return tls.RequireAnyClientCert
+	default:
+		return tls.NoClientCert
+	}
+}
+
+// certNames 获取证书中的域名，包括CommonName及SAN中的DNS名称
+func certNames(leaf *x509.Certificate) []string {
+	var names []string
+	for _, name := range leaf.DNSNames {
+		names = append(names, strings.ToLower(name))
+	}
+	if leaf.Subject.CommonName != "" {
+		names = append(names, strings.ToLower(leaf.Subject.CommonName))
+	}
+	return names
+}
+
+func fileModTime(filePath string) time.Time {
+	info, err := os.Stat(filePath)
+	if nil != err {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
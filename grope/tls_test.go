@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert 生成自签名证书及私钥文件
+func writeTestCert(t *testing.T, dir, name string, serial int64, dnsNames ...string) *TLSCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if nil != err {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if nil != err {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if nil != err {
+		t.Fatal(err)
+	}
+	cert := &TLSCert{CertFilePath: filepath.Join(dir, name+".crt"), KeyFilePath: filepath.Join(dir, name+".key")}
+	if err = ioutil.WriteFile(cert.CertFilePath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); nil != err {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(cert.KeyFilePath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); nil != err {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestServerTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grope-tls")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	certA := writeTestCert(t, dir, "a", 1, "a.example.com")
+	certB := writeTestCert(t, dir, "b", 2, "*.b.example.com")
+	st, err := NewServerTLS(&TLSOption{Certs: []*TLSCert{certA, certB}, ReloadInterval: 20 * time.Millisecond})
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", st.Config())
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if nil != err {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			_ = conn.Close()
+		}
+	}()
+	serial := func(serverName string, certs ...tls.Certificate) int64 {
+		conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: true,
+			Certificates:       certs,
+		})
+		if nil != err {
+			return -1
+		}
+		defer func() { _ = conn.Close() }()
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+	}
+	cases := map[string]int64{"a.example.com": 1, "x.b.example.com": 2, "b.example.com": 1, "": 1}
+	for serverName, expect := range cases {
+		if got := serial(serverName); got != expect {
+			t.Errorf("%q expect serial %d, got %d", serverName, expect, got)
+		}
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	writeTestCert(t, dir, "b", 3, "*.b.example.com")
+	for i := 0; i < 50 && serial("x.b.example.com") != 3; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if got := serial("x.b.example.com"); got != 3 {
+		t.Errorf("expect reloaded serial 3, got %d", got)
+	}
+
+	st.option.ClientAuth = ClientAuthRequire
+	st.option.CACertFilePaths = []string{certA.CertFilePath}
+	if err = st.Reload(); nil != err {
+		t.Fatal(err)
+	}
+	requireListener, err := tls.Listen("tcp", "127.0.0.1:0", st.Config())
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer func() { _ = requireListener.Close() }()
+	go func() {
+		for {
+			conn, err := requireListener.Accept()
+			if nil != err {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			_ = conn.Close()
+		}
+	}()
+	dial := func(certs ...tls.Certificate) error {
+		conn, err := tls.Dial("tcp", requireListener.Addr().String(), &tls.Config{
+			InsecureSkipVerify: true,
+			MaxVersion:         tls.VersionTLS12,
+			Certificates:       certs,
+		})
+		if nil != err {
+			return err
+		}
+		defer func() { _ = conn.Close() }()
+		return conn.Handshake()
+	}
+	if err = dial(); nil == err {
+		t.Errorf("expect handshake failure without client certificate")
+	}
+	clientCert, err := tls.LoadX509KeyPair(certA.CertFilePath, certA.KeyFilePath)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err = dial(clientCert); nil != err {
+		t.Errorf("expect handshake success with client certificate, got %v", err)
+	}
+}
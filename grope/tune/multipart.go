@@ -0,0 +1,248 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tune
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"strings"
+)
+
+const sniffLen = 512 // http.DetectContentType 最多使用的字节数
+
+var (
+	// ErrFileTooLarge multipart file too large
+	ErrFileTooLarge = errors.New("multipart file too large")
+	// ErrMultipartTooLarge multipart body too large
+	ErrMultipartTooLarge = errors.New("multipart body too large")
+)
+
+// MultipartOption 流式解析"multipart/form-data"请求配置
+type MultipartOption struct {
+	MaxFileSize     int64            // 单个附件允许的最大长度（字节），0表示不限
+	MaxTotalSize    int64            // 所有表单项及附件合计允许的最大长度（字节），0表示不限
+	MemoryThreshold int64            // 附件超过该长度（字节）后写入临时文件，0表示始终保存在内存中
+	TempDir         string           // 临时文件目录，为空则使用系统默认临时目录
+	Hash            func() hash.Hash // 流式计算附件校验和的方法，如 sha256.New，nil表示不计算
+}
+
+// MultipartForm MultipartForm
+type MultipartForm struct {
+	Params map[string]interface{}
+	Files  map[string][]*FormFile
+}
+
+// RemoveAll 删除所有附件产生的临时文件
+func (mf *MultipartForm) RemoveAll() error {
+	var err error
+	for _, files := range mf.Files {
+		for _, file := range files {
+			if e := file.Remove(); nil != e && nil == err {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// FormFile 表单附件信息
+type FormFile struct {
+	FileName    string               // file name
+	Data        []byte               // file bytes content，写入临时文件时为nil
+	Header      textproto.MIMEHeader // 附件原始头信息
+	ContentType string               // 根据附件内容嗅探得到的内容类型
+	Size        int64                // 附件长度（字节）
+	Checksum    string               // 附件校验和（十六进制），未配置 MultipartOption.Hash 时为空
+	TempPath    string               // 临时文件路径，保存在内存中时为空
+}
+
+// Reader 返回附件内容读取流，使用完毕后需要关闭
+func (ff *FormFile) Reader() (io.ReadCloser, error) {
+	if ff.TempPath == "" {
+		return ioutil.NopCloser(bytes.NewReader(ff.Data)), nil
+	}
+	return os.Open(ff.TempPath)
+}
+
+// Remove 删除附件产生的临时文件
+func (ff *FormFile) Remove() error {
+	if ff.TempPath == "" {
+		return nil
+	}
+	err := os.Remove(ff.TempPath)
+	if nil == err || os.IsNotExist(err) {
+		ff.TempPath = ""
+		return nil
+	}
+	return err
+}
+
+// ParseMultipartFormStream 流式解析请求参数
+//
+// 附件在读取过程中完成大小限制、内容类型嗅探及校验和计算，超过 MultipartOption.MemoryThreshold 的附件写入临时文件
+//
+// option 解析配置，nil表示不限大小且全部保存在内存中
+func ParseMultipartFormStream(r *http.Request, option *MultipartOption) (*MultipartForm, error) {
+	contentType := r.Header.Get("Content-Type")
+	if !strings.Contains(contentType, ContentTypeMultipartPostForm) {
+		return nil, ErrContentType
+	}
+	if nil == option {
+		option = &MultipartOption{}
+	}
+	reader, err := r.MultipartReader()
+	if nil != err {
+		return nil, err
+	}
+	var (
+		form  = &MultipartForm{Params: map[string]interface{}{}, Files: map[string][]*FormFile{}}
+		total int64
+	)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if nil != err {
+			_ = form.RemoveAll()
+			return nil, err
+		}
+		if part.FileName() == "" { // this is FormData
+			var data []byte
+			if data, err = option.readParam(part, &total); nil == err {
+				form.Params[part.FormName()] = string(data)
+			}
+		} else { // This is FileData
+			var file *FormFile
+			if file, err = option.readFile(part, &total); nil == err {
+				form.Files[part.FormName()] = append(form.Files[part.FormName()], file)
+			}
+		}
+		_ = part.Close()
+		if nil != err {
+			_ = form.RemoveAll()
+			return nil, err
+		}
+	}
+	return form, nil
+}
+
+// readParam 读取普通表单项
+func (mo *MultipartOption) readParam(part *multipart.Part, total *int64) ([]byte, error) {
+	var reader io.Reader = part
+	if mo.MaxTotalSize > 0 {
+		reader = io.LimitReader(part, mo.MaxTotalSize-*total+1)
+	}
+	data, err := ioutil.ReadAll(reader)
+	if nil != err {
+		return nil, err
+	}
+	*total += int64(len(data))
+	if mo.MaxTotalSize > 0 && *total > mo.MaxTotalSize {
+		return nil, ErrMultipartTooLarge
+	}
+	return data, nil
+}
+
+// readFile 流式读取附件
+func (mo *MultipartOption) readFile(part *multipart.Part, total *int64) (file *FormFile, err error) {
+	var (
+		buf     bytes.Buffer
+		sniff   []byte
+		tmpFile *os.File
+		hasher  hash.Hash
+		chunk   = make([]byte, 32*1024)
+	)
+	file = &FormFile{FileName: part.FileName(), Header: part.Header}
+	if nil != mo.Hash {
+		hasher = mo.Hash()
+	}
+	defer func() {
+		if nil == tmpFile {
+			return
+		}
+		if e := tmpFile.Close(); nil != e && nil == err {
+			err = e
+		}
+		if nil != err {
+			_ = os.Remove(tmpFile.Name())
+		}
+	}()
+	for {
+		n, e := part.Read(chunk)
+		if n > 0 {
+			data := chunk[:n]
+			file.Size += int64(n)
+			*total += int64(n)
+			if mo.MaxFileSize > 0 && file.Size > mo.MaxFileSize {
+				return nil, ErrFileTooLarge
+			}
+			if mo.MaxTotalSize > 0 && *total > mo.MaxTotalSize {
+				return nil, ErrMultipartTooLarge
+			}
+			if len(sniff) < sniffLen {
+				sniff = append(sniff, data[:minInt(n, sniffLen-len(sniff))]...)
+			}
+			if nil != hasher {
+				_, _ = hasher.Write(data)
+			}
+			if nil != tmpFile {
+				if _, err = tmpFile.Write(data); nil != err {
+					return nil, err
+				}
+			} else {
+				buf.Write(data)
+				if mo.MemoryThreshold > 0 && int64(buf.Len()) > mo.MemoryThreshold {
+					if tmpFile, err = ioutil.TempFile(mo.TempDir, "multipart-"); nil != err {
+						return nil, err
+					}
+					file.TempPath = tmpFile.Name()
+					if _, err = buf.WriteTo(tmpFile); nil != err {
+						return nil, err
+					}
+				}
+			}
+		}
+		if e == io.EOF {
+			break
+		}
+		if nil != e {
+			return nil, e
+		}
+	}
+	if nil == tmpFile {
+		file.Data = buf.Bytes()
+	}
+	file.ContentType = http.DetectContentType(sniff)
+	if nil != hasher {
+		file.Checksum = hex.EncodeToString(hasher.Sum(nil))
+	}
+	return file, nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
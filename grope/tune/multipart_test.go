@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tune
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func multipartRequest(t *testing.T, files map[string][]byte) *http.Request {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	_ = writer.WriteField("name", "gnomon")
+	for name, data := range files {
+		part, err := writer.CreateFormFile(name, name+".txt")
+		if nil != err {
+			t.Fatal(err)
+		}
+		_, _ = part.Write(data)
+	}
+	_ = writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestParseMultipartFormStream(t *testing.T) {
+	small := []byte("small file")
+	large := []byte(strings.Repeat("large file ", 1024))
+	req := multipartRequest(t, map[string][]byte{"small": small, "large": large})
+	form, err := ParseMultipartFormStream(req, &MultipartOption{MemoryThreshold: 1024, Hash: sha256.New})
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer func() { _ = form.RemoveAll() }()
+	if form.Params["name"] != "gnomon" {
+		t.Errorf("unexpected param %v", form.Params["name"])
+	}
+	smallFile := form.Files["small"][0]
+	if smallFile.TempPath != "" || string(smallFile.Data) != string(small) {
+		t.Errorf("small file should stay in memory")
+	}
+	largeFile := form.Files["large"][0]
+	if largeFile.TempPath == "" || nil != largeFile.Data {
+		t.Fatalf("large file should be spooled to disk")
+	}
+	if largeFile.Size != int64(len(large)) || !strings.HasPrefix(largeFile.ContentType, ContentTypePlain) {
+		t.Errorf("unexpected size %d or content type %s", largeFile.Size, largeFile.ContentType)
+	}
+	sum := sha256.Sum256(large)
+	if largeFile.Checksum != hex.EncodeToString(sum[:]) {
+		t.Errorf("unexpected checksum %s", largeFile.Checksum)
+	}
+	reader, err := largeFile.Reader()
+	if nil != err {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(reader)
+	_ = reader.Close()
+	if !bytes.Equal(data, large) {
+		t.Errorf("spooled content mismatch")
+	}
+	path := largeFile.TempPath
+	if err = form.RemoveAll(); nil != err {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("temp file %s should be removed", path)
+	}
+}
+
+func TestParseMultipartFormStreamLimit(t *testing.T) {
+	req := multipartRequest(t, map[string][]byte{"file": bytes.Repeat([]byte{'a'}, 2048)})
+	if _, err := ParseMultipartFormStream(req, &MultipartOption{MaxFileSize: 1024}); err != ErrFileTooLarge {
+		t.Errorf("expect ErrFileTooLarge, got %v", err)
+	}
+	req = multipartRequest(t, map[string][]byte{"a": bytes.Repeat([]byte{'a'}, 600), "b": bytes.Repeat([]byte{'b'}, 600)})
+	if _, err := ParseMultipartFormStream(req, &MultipartOption{MaxTotalSize: 1024}); err != ErrMultipartTooLarge {
+		t.Errorf("expect ErrMultipartTooLarge, got %v", err)
+	}
+}
@@ -21,7 +21,6 @@ import (
 	"github.com/golang/protobuf/proto"
 	"github.com/vmihailenco/msgpack"
 	"gopkg.in/yaml.v3"
-	"io"
 	"io/ioutil"
 	"net/http"
 	"strings"
@@ -132,53 +131,8 @@ func ParseForm(r *http.Request) (map[string]interface{}, error) {
 }
 
 // ParseMultipartForm 解析请求参数
+//
+// 所有附件内容均读入内存，大附件请使用 ParseMultipartFormStream
 func ParseMultipartForm(r *http.Request) (*MultipartForm, error) {
-	contentType := r.Header.Get("Content-Type")
-	if strings.Contains(contentType, ContentTypeMultipartPostForm) {
-		reader, err := r.MultipartReader()
-		if nil == err {
-			form := &MultipartForm{Params: map[string]interface{}{}, Files: map[string][]*FormFile{}}
-			for {
-				part, err := reader.NextPart()
-				if err == io.EOF {
-					break
-				}
-				if part == nil {
-					return nil, err
-				}
-				if part.FileName() == "" { // this is FormData
-					if data, err := ioutil.ReadAll(part); nil == err {
-						form.Params[part.FormName()] = string(data)
-					} else {
-						return nil, err
-					}
-				} else { // This is FileData
-					if bytes, err := ioutil.ReadAll(part); nil == err {
-						form.Files[part.FormName()] = append(form.Files[part.FormName()], &FormFile{
-							FileName: part.FileName(),
-							Data:     bytes,
-						})
-					} else {
-						return nil, err
-					}
-				}
-				func() { _ = part.Close() }()
-			}
-			return form, nil
-		}
-		return nil, err
-	}
-	return nil, ErrContentType
-}
-
-// MultipartForm MultipartForm
-type MultipartForm struct {
-	Params map[string]interface{}
-	Files  map[string][]*FormFile
-}
-
-// FormFile 表单附件信息
-type FormFile struct {
-	FileName string // file name
-	Data     []byte // file bytes content
+	return ParseMultipartFormStream(r, nil)
 }
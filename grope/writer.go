@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grope
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// responseWriter 记录响应状态的 http.ResponseWriter
+type responseWriter struct {
+	http.ResponseWriter
+	status  int      // 已写入的状态码，0表示尚未写入
+	size    int64    // 已写入的响应体长度
+	befores []func() // 写入响应头之前需要执行的方法集合，如写入会话cookie等
+}
+
+// before 注册一个写入响应头之前需要执行的方法
+func (rw *responseWriter) before(f func()) {
+	rw.befores = append(rw.befores, f)
+}
+
+// prepare 执行写入响应头之前需要执行的方法，仅执行一次
+func (rw *responseWriter) prepare() {
+	befores := rw.befores
+	rw.befores = nil
+	for _, f := range befores {
+		f()
+	}
+}
+
+// WriteHeader 记录并写入状态码
+func (rw *responseWriter) WriteHeader(statusCode int) {
+	if rw.status == 0 {
+		rw.prepare()
+		rw.status = statusCode
+	}
+	rw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.prepare()
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.size += int64(n)
+	return n, err
+}
+
+// Flush 实现 http.Flusher
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack 实现 http.Hijacker，用于websocket等协议升级
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := rw.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, errors.New("http.Hijacker is not supported")
+}
+
+// Push 实现 http.Pusher，用于HTTP/2服务端推送
+func (rw *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := rw.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// written 是否已经写入了响应
+func (rw *responseWriter) written() bool {
+	return rw.status != 0
+}
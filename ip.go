@@ -16,24 +16,251 @@
 package gnomon
 
 import (
+	"fmt"
 	"net"
 	"net/http"
+	"strings"
+	"sync"
+)
+
+var (
+	trustedProxies     = &TrustedProxies{}
+	trustedProxiesLock sync.RWMutex
 )
 
 // IPGet 返回客户端 IP
+//
+// 仅当请求直接来源为可信代理时才解析“Forwarded”、“X-Forwarded-For”及“X-Real-IP”，
+// 可信代理通过 IPTrustedProxiesSet 设置，默认不信任任何代理
 func IPGet(req *http.Request) string {
-	remoteAddr := req.RemoteAddr
-	if ip := req.Header.Get("X-Real-IP"); ip != "" {
-		remoteAddr = ip
-	} else if ip = req.Header.Get("X-Forwarded-For"); ip != "" {
-		remoteAddr = ip
-	} else {
-		remoteAddr, _, _ = net.SplitHostPort(remoteAddr)
+	return IPForwarded(req).IP
+}
+
+// IPForwarded 返回经由可信代理转发的原始请求信息，可信代理通过 IPTrustedProxiesSet 设置
+func IPForwarded(req *http.Request) *Forwarded {
+	trustedProxiesLock.RLock()
+	tp := trustedProxies
+	trustedProxiesLock.RUnlock()
+	return tp.Resolve(req)
+}
+
+// IPTrustedProxiesSet 设置 IPGet 使用的可信代理
+//
+// cidrs 可信代理的IP或CIDR网段，如“10.0.0.0/8”、“127.0.0.1”
+func IPTrustedProxiesSet(cidrs ...string) error {
+	tp, err := NewTrustedProxies(cidrs...)
+	if nil != err {
+		return err
+	}
+	trustedProxiesLock.Lock()
+	trustedProxies = tp
+	trustedProxiesLock.Unlock()
+	return nil
+}
+
+// IPNetParse 解析IP或CIDR网段，单个IP视为/32或/128网段
+func IPNetParse(cidr string) (*net.IPNet, error) {
+	cidr = strings.TrimSpace(cidr)
+	if !strings.Contains(cidr, "/") {
+		ip := net.ParseIP(cidr)
+		if nil == ip {
+			return nil, fmt.Errorf("invalid ip %q", cidr)
+		}
+		if ip4 := ip.To4(); nil != ip4 {
+			return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if nil != err {
+		return nil, fmt.Errorf("invalid cidr %q", cidr)
+	}
+	return ipNet, nil
+}
+
+// TrustedProxies 可信代理集合
+type TrustedProxies struct {
+	ipNets []*net.IPNet
+}
+
+// Forwarded 经由可信代理转发的原始请求信息
+type Forwarded struct {
+	IP     string // 客户端IP
+	Scheme string // 原始请求协议，如“https”
+	Host   string // 原始请求主机，如“example.com”
+}
+
+// NewTrustedProxies 新建可信代理集合
+//
+// cidrs 可信代理的IP或CIDR网段，支持IPv4及IPv6
+func NewTrustedProxies(cidrs ...string) (*TrustedProxies, error) {
+	tp := &TrustedProxies{}
+	for _, cidr := range cidrs {
+		ipNet, err := IPNetParse(cidr)
+		if nil != err {
+			return nil, err
+		}
+		tp.ipNets = append(tp.ipNets, ipNet)
 	}
+	return tp, nil
+}
 
-	if remoteAddr == "::1" {
-		remoteAddr = "127.0.0.1"
+// Trusted IP是否为可信代理
+func (tp *TrustedProxies) Trusted(ip net.IP) bool {
+	if nil == tp || nil == ip {
+		return false
 	}
+	for _, ipNet := range tp.ipNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
 
-	return remoteAddr
+// Resolve 解析原始请求信息
+//
+// 请求直接来源不是可信代理时，返回直接来源的IP及请求本身的协议和主机；
+// 否则优先解析RFC 7239“Forwarded”，其次“X-Forwarded-For”、“X-Forwarded-Proto”及“X-Forwarded-Host”，最后“X-Real-IP”，
+// 均自右向左跳过可信代理，第一个非可信代理的地址即为客户端IP
+func (tp *TrustedProxies) Resolve(req *http.Request) *Forwarded {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if nil != err {
+		host = req.RemoteAddr
+	}
+	forwarded := &Forwarded{IP: host, Scheme: "http", Host: req.Host}
+	if nil != req.TLS {
+		forwarded.Scheme = "https"
+	}
+	if tp.Trusted(net.ParseIP(host)) {
+		if values := req.Header["Forwarded"]; len(values) > 0 {
+			tp.resolveForwarded(forwarded, values)
+		} else if values = req.Header["X-Forwarded-For"]; len(values) > 0 {
+			tp.resolveXForwarded(forwarded, req.Header)
+		} else if ip := net.ParseIP(strings.TrimSpace(req.Header.Get("X-Real-IP"))); nil != ip {
+			forwarded.IP = ip.String()
+		}
+	}
+	if forwarded.IP == "::1" {
+		forwarded.IP = "127.0.0.1"
+	}
+	return forwarded
+}
+
+// resolveForwarded 自右向左解析“Forwarded”，每个元素由一个代理追加，描述该代理收到的请求
+func (tp *TrustedProxies) resolveForwarded(forwarded *Forwarded, values []string) {
+	elements := splitHeaderList(values)
+	for i := len(elements) - 1; i >= 0; i-- {
+		params := parseForwardedElement(elements[i])
+		ip := net.ParseIP(forwardedNode(params["for"]))
+		if nil == ip {
+			return
+		}
+		forwarded.IP = ip.String()
+		if proto := params["proto"]; proto != "" {
+			forwarded.Scheme = strings.ToLower(proto)
+		}
+		if host := params["host"]; host != "" {
+			forwarded.Host = host
+		}
+		if !tp.Trusted(ip) {
+			return
+		}
+	}
+}
+
+// resolveXForwarded 自右向左解析“X-Forwarded-For”，“X-Forwarded-Proto”及“X-Forwarded-Host”
+// 与其逐跳对应时取相同位置的值，否则取最近一跳可信代理设置的最右侧值
+func (tp *TrustedProxies) resolveXForwarded(forwarded *Forwarded, header http.Header) {
+	var (
+		hops   = splitHeaderList(header["X-Forwarded-For"])
+		protos = splitHeaderList(header["X-Forwarded-Proto"])
+		hosts  = splitHeaderList(header["X-Forwarded-Host"])
+		index  = -1
+	)
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(hops[i])
+		if nil == ip {
+			break
+		}
+		forwarded.IP, index = ip.String(), i
+		if !tp.Trusted(ip) {
+			break
+		}
+	}
+	if index < 0 {
+		return
+	}
+	if value := hopValue(protos, hops, index); value != "" {
+		forwarded.Scheme = strings.ToLower(value)
+	}
+	if value := hopValue(hosts, hops, index); value != "" {
+		forwarded.Host = value
+	}
+}
+
+// hopValue 获取与“X-Forwarded-For”第index跳对应的值
+func hopValue(values, hops []string, index int) string {
+	if len(values) == 0 {
+		return ""
+	}
+	if len(values) == len(hops) {
+		return values[index]
+	}
+	return values[len(values)-1]
+}
+
+// splitHeaderList 拆分逗号分隔的请求头列表，忽略引号内的逗号
+func splitHeaderList(values []string) []string {
+	var list []string
+	for _, value := range values {
+		var (
+			quoted bool
+			start  int
+		)
+		for i := 0; i < len(value); i++ {
+			switch value[i] {
+			case '"':
+				quoted = !quoted
+			case ',':
+				if !quoted {
+					if item := strings.TrimSpace(value[start:i]); item != "" {
+						list = append(list, item)
+					}
+					start = i + 1
+				}
+			}
+		}
+		if item := strings.TrimSpace(value[start:]); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// parseForwardedElement 解析“Forwarded”元素，如“for=192.0.2.60;proto=http;by=203.0.113.43”，参数名称转为小写
+func parseForwardedElement(element string) map[string]string {
+	params := map[string]string{}
+	for _, pair := range strings.Split(element, ";") {
+		index := strings.Index(pair, "=")
+		if index < 0 {
+			continue
+		}
+		params[strings.ToLower(strings.TrimSpace(pair[:index]))] = strings.Trim(strings.TrimSpace(pair[index+1:]), `"`)
+	}
+	return params
+}
+
+// forwardedNode 获取“Forwarded”节点中的IP部分，如“[2001:db8:cafe::17]:4711”返回“2001:db8:cafe::17”
+func forwardedNode(node string) string {
+	if strings.HasPrefix(node, "[") {
+		if index := strings.Index(node, "]"); index > 0 {
+			return node[1:index]
+		}
+		return node
+	}
+	if strings.Count(node, ":") == 1 {
+		return node[:strings.Index(node, ":")]
+	}
+	return node
 }
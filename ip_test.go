@@ -132,3 +132,36 @@ func TestIPCommon_Get_XForwardedForIP6(t *testing.T) {
 		t.Errorf("\t\tShould receive a \"%d\" status. %v %v", statusCode, ballotX, resp.StatusCode)
 	}
 }
+
+func TestTrustedProxies_Resolve(t *testing.T) {
+	tp, err := NewTrustedProxies("10.0.0.0/8", "2001:db8::/32")
+	if nil != err {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		remoteAddr string
+		header     map[string]string
+		expect     Forwarded
+	}{
+		{"8.8.8.8:80", map[string]string{"X-Forwarded-For": "1.1.1.1", "X-Real-IP": "1.1.1.1"}, Forwarded{"8.8.8.8", "http", "example.com"}},
+		{"10.0.0.1:80", map[string]string{"X-Forwarded-For": "1.1.1.1, 2.2.2.2, 10.0.0.2", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "api.example.com"}, Forwarded{"2.2.2.2", "https", "api.example.com"}},
+		{"10.0.0.1:80", map[string]string{"X-Forwarded-For": "1.1.1.1, 10.0.0.2", "X-Forwarded-Proto": "http, https"}, Forwarded{"1.1.1.1", "http", "example.com"}},
+		{"10.0.0.1:80", map[string]string{"X-Real-IP": "3.3.3.3"}, Forwarded{"3.3.3.3", "http", "example.com"}},
+		{"10.0.0.1:80", map[string]string{"Forwarded": `for=1.1.1.1;proto=http, for="[2001:db8::1]:4711";proto=https;host=shop.example.com`}, Forwarded{"1.1.1.1", "http", "shop.example.com"}},
+		{"10.0.0.1:80", map[string]string{"Forwarded": `for=1.1.1.1;proto=http, for="[2001:db9::1]:4711";proto=https;host=shop.example.com`}, Forwarded{"2001:db9::1", "https", "shop.example.com"}},
+		{"10.0.0.1:80", map[string]string{"Forwarded": `for=unknown;proto=https`}, Forwarded{"10.0.0.1", "http", "example.com"}},
+	}
+	for index, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = c.remoteAddr
+		for k, v := range c.header {
+			req.Header.Set(k, v)
+		}
+		if forwarded := tp.Resolve(req); *forwarded != c.expect {
+			t.Errorf("case %d expect %+v, got %+v", index, c.expect, *forwarded)
+		}
+	}
+	if _, err = NewTrustedProxies("10.0.0.0/40"); nil == err {
+		t.Errorf("expect invalid cidr error")
+	}
+}
@@ -15,6 +15,7 @@
 package gnomon
 
 import (
+	"errors"
 	"github.com/dgrijalva/jwt-go"
 )
 
@@ -27,6 +28,15 @@ const (
 	signingMethodHS512
 )
 
+const (
+	// JWTMethodHS256 HS256
+	JWTMethodHS256 = signingMethodHS256
+	// JWTMethodHS384 HS384
+	JWTMethodHS384 = signingMethodHS384
+	// JWTMethodHS512 HS512
+	JWTMethodHS512 = signingMethodHS512
+)
+
 // JWTBuild 创建一个 jwt token
 //
 // "sub": "1",  该JWT所面向的用户
@@ -41,16 +51,38 @@ const (
 //
 // "jti": "37c107e4609ddbcc9c096ea5ee76c667" token提供唯一标识
 func JWTBuild(method int, key interface{}, sub, iss, jti string, iat, nbf, exp int64) (string, error) {
-	var jwtMethod jwt.SigningMethod
+	jwtMethod, err := signingMethod(method)
+	if nil != err {
+		return "", err
+	}
+	return token(jwtMethod, key, sub, iss, jti, iat, nbf, exp)
+}
+
+// JWTBuildClaims 根据自定义声明创建一个 jwt token
+//
+// claims 声明集合，如“sub”、“iss”、“exp”、“aud”以及自定义的“scope”等
+func JWTBuildClaims(method int, key interface{}, claims map[string]interface{}) (string, error) {
+	jwtMethod, err := signingMethod(method)
+	if nil != err {
+		return "", err
+	}
+	token := jwt.NewWithClaims(jwtMethod, jwt.MapClaims(claims))
+	return token.SignedString(key)
+}
+
+// ErrJWTMethod unsupported jwt signing method
+var ErrJWTMethod = errors.New("unsupported jwt signing method")
+
+func signingMethod(method int) (jwt.SigningMethod, error) {
 	switch method {
 	case signingMethodHS256:
-		jwtMethod = jwt.SigningMethodHS256
+		return jwt.SigningMethodHS256, nil
 	case signingMethodHS384:
-		jwtMethod = jwt.SigningMethodHS384
+		return jwt.SigningMethodHS384, nil
 	case signingMethodHS512:
-		jwtMethod = jwt.SigningMethodHS512
+		return jwt.SigningMethodHS512, nil
 	}
-	return token(jwtMethod, key, sub, iss, jti, iat, nbf, exp)
+	return nil, ErrJWTMethod
 }
 
 func token(jwtMethod jwt.SigningMethod, key interface{}, sub, iss, jti string, iat, nbf, exp int64) (tokenString string, err error) {
@@ -81,3 +113,23 @@ func JWTCheck(key interface{}, token string) bool {
 	})
 	return err == nil
 }
+
+// JWTParse 验证传入 token 并返回其中的声明
+//
+// 校验签名以及“exp”、“nbf”、“iat”，未通过则返回错误
+//
+// algs 允许的签名算法，如“HS256”，为空则不限制
+func JWTParse(key interface{}, token string, algs ...string) (map[string]interface{}, error) {
+	parser := &jwt.Parser{ValidMethods: algs, UseJSONNumber: true}
+	tk, err := parser.Parse(token, func(*jwt.Token) (interface{}, error) {
+		return key, nil
+	})
+	if nil != err {
+		return nil, err
+	}
+	claims, ok := tk.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid jwt claims")
+	}
+	return claims, nil
+}
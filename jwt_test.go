@@ -47,3 +47,36 @@ func TestJwtCommon_Check(t *testing.T) {
 	bo4 := JWTCheck(key, tokenString3+"1")
 	t.Log("bo4", bo4)
 }
+
+func TestJwtCommon_Parse(t *testing.T) {
+	key := []byte("Hello World！This is secret!")
+	tokenString, err := JWTBuildClaims(JWTMethodHS256, key, map[string]interface{}{
+		"sub":   "1",
+		"aud":   "gnomon",
+		"scope": "read write",
+		"exp":   time.Now().Unix() + 1000,
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	claims, err := JWTParse(key, tokenString, "HS256")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if claims["sub"] != "1" || claims["scope"] != "read write" {
+		t.Errorf("unexpected claims %v", claims)
+	}
+	if _, err = JWTParse(key, tokenString, "HS512"); nil == err {
+		t.Error("expect invalid signing method")
+	}
+	expired, _ := JWTBuildClaims(JWTMethodHS256, key, map[string]interface{}{"exp": time.Now().Unix() - 10})
+	if _, err = JWTParse(key, expired); nil == err {
+		t.Error("expect expired token")
+	}
+	if _, err = JWTBuildClaims(JWTMethodHS512+1, key, map[string]interface{}{"sub": "1"}); err != ErrJWTMethod {
+		t.Errorf("expect ErrJWTMethod, got %v", err)
+	}
+	if _, err = JWTBuild(-1, key, "1", "rivet", "userMD5", 0, 0, 0); err != ErrJWTMethod {
+		t.Errorf("expect ErrJWTMethod, got %v", err)
+	}
+}
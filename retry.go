@@ -0,0 +1,240 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gnomon
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// HTTPRetry http 请求重试策略
+//
+// 幂等方法（GET、HEAD、OPTIONS、TRACE、PUT、DELETE）失败后按策略重试，其它方法仅在携带幂等键时重试；
+// 请求体在首次请求前缓存，每次重试重新发送完整的请求体，超出 MaxBodySize 的请求不重试
+type HTTPRetry struct {
+	MaxAttempts int   // 最大尝试次数，含首次请求，小于2表示不重试
+	Statuses    []int // 可重试的响应状态码，nil则使用502、503及504
+	// 判断请求错误是否可重试，nil则除调用方取消外的错误均重试，单次尝试超时同样视为可重试
+	Retryable  func(err error) bool
+	Backoff    time.Duration // 首次重试前的退避时间，之后每次重试翻倍，默认100ms
+	MaxBackoff time.Duration // 最大退避时间，默认10s
+	// 退避时间的随机抖动比例（0~1），实际退避时间在[backoff*(1-Jitter), backoff]之间，
+	// 用于避免大量客户端同时重试，0表示使用默认值0.2，负数表示不抖动
+	Jitter        float64
+	PerTryTimeout time.Duration // 单次尝试的超时时间，含读取响应体，0表示不限
+	// 幂等键请求头名称，默认“Idempotency-Key”
+	IdempotencyHeader string
+	MaxBodySize       int64 // 允许缓存以重放的最大请求体长度（字节），默认1MB
+}
+
+// String 重试策略描述，如“attempts=3 statuses=[502 503 504] backoff=100ms perTry=1s”
+func (hr *HTTPRetry) String() string {
+	desc := fmt.Sprintf("attempts=%d statuses=%v backoff=%s", hr.MaxAttempts, hr.statuses(), hr.delay(1))
+	if hr.PerTryTimeout > 0 {
+		desc = fmt.Sprintf("%s perTry=%s", desc, hr.PerTryTimeout)
+	}
+	return desc
+}
+
+// Idempotent 请求是否允许重试，幂等方法或携带幂等键的请求允许重试
+func (hr *HTTPRetry) Idempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	header := hr.IdempotencyHeader
+	if header == "" {
+		header = "Idempotency-Key"
+	}
+	return req.Header.Get(header) != ""
+}
+
+// RetryStatus 响应状态码是否可重试
+func (hr *HTTPRetry) RetryStatus(status int) bool {
+	for _, s := range hr.statuses() {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryError 请求错误是否可重试
+func (hr *HTTPRetry) RetryError(err error) bool {
+	if nil != hr.Retryable {
+		return hr.Retryable(err)
+	}
+	return err != context.Canceled
+}
+
+// Do 按重试策略执行请求，do 执行单次请求，如 HTTPDo
+//
+// 返回最后一次尝试的响应或错误，被放弃的响应会被读取并关闭；请求的 Context 结束后不再重试
+func (hr *HTTPRetry) Do(req *http.Request, do func(req *http.Request) (*http.Response, error)) (*http.Response, error) {
+	attempts := hr.MaxAttempts
+	if attempts < 2 || !hr.Idempotent(req) || !hr.replayable(req) {
+		attempts = 1
+	}
+	parent := req.Context()
+	for attempt := 1; ; attempt++ {
+		try, cancel := req, context.CancelFunc(func() {})
+		if hr.PerTryTimeout > 0 {
+			var c context.Context
+			c, cancel = context.WithTimeout(parent, hr.PerTryTimeout)
+			try = req.WithContext(c)
+		}
+		if attempt > 1 && nil != req.GetBody {
+			body, err := req.GetBody()
+			if nil != err {
+				cancel()
+				return nil, err
+			}
+			if try == req {
+				try = req.WithContext(parent)
+			}
+			try.Body = body
+		}
+		resp, err := do(try)
+		retry := attempt < attempts && nil == parent.Err()
+		if nil != err {
+			retry = retry && hr.RetryError(err)
+		} else {
+			retry = retry && hr.RetryStatus(resp.StatusCode)
+		}
+		if !retry {
+			if nil != resp && hr.PerTryTimeout > 0 {
+				resp.Body = &retryBody{ReadCloser: resp.Body, cancel: cancel}
+			} else {
+				cancel()
+			}
+			return resp, err
+		}
+		if nil != resp {
+			_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+			_ = resp.Body.Close()
+		}
+		cancel()
+		timer := time.NewTimer(hr.backoff(attempt))
+		select {
+		case <-parent.Done():
+			timer.Stop()
+			return nil, parent.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// replayable 缓存请求体以便重试时重新发送，请求体超出限制或读取失败时返回false，请求仍可读取完整的请求体
+func (hr *HTTPRetry) replayable(req *http.Request) bool {
+	if nil == req.Body || req.Body == http.NoBody || nil != req.GetBody {
+		return true
+	}
+	size := hr.MaxBodySize
+	if size <= 0 {
+		size = 1 << 20
+	}
+	if req.ContentLength > size {
+		return false
+	}
+	origin := req.Body
+	body, err := ioutil.ReadAll(io.LimitReader(origin, size+1))
+	if nil != err || int64(len(body)) > size {
+		req.Body = &retryBody{ReadCloser: ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), origin)), closer: origin}
+		return false
+	}
+	_ = origin.Close()
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	return true
+}
+
+func (hr *HTTPRetry) statuses() []int {
+	if nil == hr.Statuses {
+		return []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	}
+	return hr.Statuses
+}
+
+// backoff 第 attempt 次尝试失败后加入随机抖动的退避时间
+func (hr *HTTPRetry) backoff(attempt int) time.Duration {
+	backoff := hr.delay(attempt)
+	jitter := hr.Jitter
+	if jitter == 0 {
+		jitter = 0.2
+	}
+	if jitter > 0 {
+		if jitter > 1 {
+			jitter = 1
+		}
+		backoff -= time.Duration(rand.Float64() * jitter * float64(backoff))
+	}
+	return backoff
+}
+
+// delay 第 attempt 次尝试失败后未加入抖动的退避时间
+func (hr *HTTPRetry) delay(attempt int) time.Duration {
+	backoff, max := hr.Backoff, hr.MaxBackoff
+	if backoff <= 0 {
+		backoff = 100 * time.Millisecond
+	}
+	if max <= 0 {
+		max = 10 * time.Second
+	}
+	for i := 1; i < attempt && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+// retryBody 关闭时同时结束单次尝试的 Context 或关闭原始请求体
+type retryBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+	closer io.Closer
+}
+
+func (rb *retryBody) Close() error {
+	err := rb.ReadCloser.Close()
+	if nil != rb.cancel {
+		rb.cancel()
+	}
+	if nil != rb.closer {
+		err = rb.closer.Close()
+	}
+	return err
+}
+
+// HTTPDoRetry 按重试策略执行自定义请求
+func HTTPDoRetry(req *http.Request, retry *HTTPRetry) (resp *http.Response, err error) {
+	return retry.Do(req, HTTPDo)
+}
+
+// HTTPDoRetryTLS 按重试策略执行自定义 tls 请求
+func HTTPDoRetryTLS(req *http.Request, retry *HTTPRetry, tlsConfig *HTTPTLSConfig) (resp *http.Response, err error) {
+	return retry.Do(req, func(req *http.Request) (*http.Response, error) {
+		return HTTPDoTLS(req, tlsConfig)
+	})
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2020. Aberic - All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * http://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gnomon
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPRetry_Do(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			time.Sleep(200 * time.Millisecond)
+		}
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+	retry := &HTTPRetry{MaxAttempts: 3, Backoff: time.Millisecond, PerTryTimeout: 100 * time.Millisecond}
+	do := func(idempotencyKey string) (int, string) {
+		atomic.StoreInt32(&calls, 0)
+		req, _ := http.NewRequest(http.MethodPost, server.URL, ioutil.NopCloser(strings.NewReader("payload")))
+		if idempotencyKey != "" {
+			req.Header.Set("Idempotency-Key", idempotencyKey)
+		}
+		resp, err := HTTPDoRetry(req, retry)
+		if nil != err {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+	if status, _ := do(""); status != http.StatusServiceUnavailable || atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("expect non-idempotent request not retried, got %d after %d calls", status, calls)
+	}
+	// 首次503、第二次超时，第三次成功且请求体完整
+	if status, body := do("order-1"); status != http.StatusOK || body != "payload" || atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("expect retried request succeed, got %d %q after %d calls", status, body, calls)
+	}
+
+	retry = &HTTPRetry{MaxAttempts: 5, Backoff: time.Millisecond, MaxBodySize: 4}
+	atomic.StoreInt32(&calls, 0)
+	req, _ := http.NewRequest(http.MethodPut, server.URL, ioutil.NopCloser(strings.NewReader("too large")))
+	resp, err := HTTPDoRetry(req, retry)
+	if nil != err || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expect body too large request not retried, got %v %v", resp, err)
+	}
+	_ = resp.Body.Close()
+}
+
+func TestHTTPRetry_backoff(t *testing.T) {
+	retry := &HTTPRetry{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second, Jitter: 0.5}
+	for attempt, expect := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 5: time.Second, 9: time.Second} {
+		if delay := retry.delay(attempt); delay != expect {
+			t.Errorf("attempt %d expect delay %s, got %s", attempt, expect, delay)
+		}
+		for i := 0; i < 20; i++ {
+			if backoff := retry.backoff(attempt); backoff > expect || backoff < expect/2 {
+				t.Errorf("attempt %d expect backoff between %s and %s, got %s", attempt, expect/2, expect, backoff)
+			}
+		}
+	}
+	retry.Jitter = -1
+	if backoff := retry.backoff(2); backoff != 200*time.Millisecond {
+		t.Errorf("expect no jitter, got %s", backoff)
+	}
+	get, _ := http.NewRequest(http.MethodGet, "http://localhost", nil)
+	post, _ := http.NewRequest(http.MethodPost, "http://localhost", nil)
+	if !retry.Idempotent(get) || retry.Idempotent(post) || !retry.RetryStatus(http.StatusBadGateway) || retry.RetryStatus(http.StatusInternalServerError) {
+		t.Errorf("unexpected default retry policy")
+	}
+}
@@ -17,12 +17,14 @@ package gnomon
 import (
 	"go/ast"
 	"reflect"
+	"strings"
 )
 
 // Field 上一结构体所属参数信息
 type Field struct {
 	Name   string        // 参数名
 	Value  reflect.Value // 参数值
+	Type   reflect.Type  // 参数声明类型，参数值为nil指针时仍可获取
 	Tag    string        // 参数标签
 	Kind   reflect.Kind  // 参数类型
 	Fields []*Field      // 自身作为根结构体信息
@@ -47,42 +49,154 @@ func (schema *Schema) GetValue(name string) reflect.Value {
 }
 
 // SchemaParse SchemaParse
+//
+// key 标签名称，如“json”
+//
+// 未在标签中指定名称的匿名结构体参数按 encoding/json 的规则展开到外层，展开后的参数名称为标签中逗号前的部分，未设置则为参数名，
+// 同名参数取嵌套最浅者，深度相同时取设置了标签名称者，仍无法区分则忽略；标签为“-”的参数不参与同名比较
 func SchemaParse(key string, dest interface{}) *Schema {
-	destValue := reflect.ValueOf(dest)
-	destModelType := reflect.Indirect(destValue).Type()
+	destValue := ptrParse(reflect.ValueOf(dest))
 	schema := &Schema{
 		Model:    dest,
-		Name:     destModelType.Name(),
+		Name:     destValue.Type().Name(),
+		Fields:   structFieldsParse(key, destValue),
 		fieldMap: make(map[string]*Field),
 	}
-
-	for i := 0; i < destModelType.NumField(); i++ {
-		sf := destModelType.Field(i)
-		if !sf.Anonymous && ast.IsExported(sf.Name) {
-			destValue = ptrParse(destValue)
-			field := fieldParse(key, sf, destValue.Field(i).Kind(), destValue.Field(i))
-			schema.Fields = append(schema.Fields, field)
-			schema.fieldMap[sf.Name] = field
+	for _, field := range schema.Fields {
+		if _, exist := schema.fieldMap[field.Name]; !exist {
+			schema.fieldMap[field.Name] = field
 		}
 	}
 	return schema
 }
 
+// embeddedField 展开匿名结构体参数过程中的参数
+type embeddedField struct {
+	field  *Field
+	name   string // 标签名称或参数名
+	tagged bool   // 是否通过标签指定名称
+	depth  int    // 匿名结构体嵌套深度
+}
+
+// structFieldsParse 解析结构体参数并展开匿名结构体参数，nil指针的匿名结构体参数按零值展开
+func structFieldsParse(key string, value reflect.Value) []*Field {
+	var (
+		fields  []*embeddedField
+		current = []reflect.Value{value}
+		visited = map[reflect.Type]bool{}
+	)
+	for depth := 0; len(current) > 0; depth++ {
+		var next []reflect.Value
+		for _, structValue := range current {
+			structType := structValue.Type()
+			if visited[structType] {
+				continue
+			}
+			visited[structType] = true
+			for i := 0; i < structType.NumField(); i++ {
+				sf := structType.Field(i)
+				childValue := structValue.Field(i)
+				tag := fieldTag(key, sf)
+				name := strings.Split(tag, ",")[0]
+				if sf.Anonymous && tag != "-" {
+					embeddedType := sf.Type
+					if embeddedType.Kind() == reflect.Ptr {
+						embeddedType = embeddedType.Elem()
+					}
+					if embeddedType.Kind() == reflect.Struct && name == "" {
+						if childValue = ptrParse(childValue); !childValue.IsValid() {
+							childValue = reflect.New(embeddedType).Elem()
+						}
+						next = append(next, childValue)
+						continue
+					}
+				}
+				if !ast.IsExported(sf.Name) {
+					continue
+				}
+				field := fieldParse(key, sf, childValue.Kind(), childValue)
+				embedded := &embeddedField{field: field, name: name, tagged: name != "", depth: depth}
+				if !embedded.tagged {
+					embedded.name = sf.Name
+				}
+				fields = append(fields, embedded)
+			}
+		}
+		current = next
+	}
+	var (
+		result    []*Field
+		names     []string
+		conflicts = map[string][]*embeddedField{}
+	)
+	for _, embedded := range fields {
+		if embedded.field.Tag == "-" {
+			continue
+		}
+		if _, exist := conflicts[embedded.name]; !exist {
+			names = append(names, embedded.name)
+		}
+		conflicts[embedded.name] = append(conflicts[embedded.name], embedded)
+	}
+	dominants := map[*Field]bool{}
+	for _, name := range names {
+		if embedded := dominantField(conflicts[name]); nil != embedded {
+			dominants[embedded.field] = true
+		}
+	}
+	for _, embedded := range fields {
+		if embedded.field.Tag == "-" || dominants[embedded.field] {
+			result = append(result, embedded.field)
+		}
+	}
+	return result
+}
+
+// dominantField 同名参数中生效的参数，参数按嵌套深度排列，无法区分则返回nil
+func dominantField(fields []*embeddedField) *embeddedField {
+	var dominant *embeddedField
+	for index, field := range fields {
+		if field.depth > fields[0].depth {
+			if index == 1 {
+				return fields[0]
+			}
+			break
+		}
+		if field.tagged {
+			if nil != dominant {
+				return nil
+			}
+			dominant = field
+		}
+	}
+	if len(fields) == 1 {
+		return fields[0]
+	}
+	return dominant
+}
+
 // fieldParse
 func fieldParse(key string, sf reflect.StructField, kind reflect.Kind, value reflect.Value) *Field {
 	field := &Field{
 		Name:  sf.Name,
 		Value: value,
+		Type:  sf.Type,
 		Kind:  kind,
 	}
 	value = ptrParse(value)
 	field.Fields = fieldsParse(key, value)
+	field.Tag = fieldTag(key, sf)
+	return field
+}
+
+// fieldTag 获取参数标签
+func fieldTag(key string, sf reflect.StructField) string {
 	if v, ok := sf.Tag.Lookup(key); ok {
-		field.Tag = v
+		return v
 	} else if v, ok := sf.Tag.Lookup(StringBuild(";", key)); ok {
-		field.Tag = v
+		return v
 	}
-	return field
+	return ""
 }
 
 func fieldsParse(key string, value reflect.Value) []*Field {
@@ -90,16 +204,7 @@ func fieldsParse(key string, value reflect.Value) []*Field {
 	default:
 		return nil
 	case reflect.Struct:
-		var fields []*Field
-		fieldModelType := reflect.Indirect(value).Type()
-		for i := 0; i < fieldModelType.NumField(); i++ {
-			sf := fieldModelType.Field(i)
-			if !sf.Anonymous && ast.IsExported(sf.Name) {
-				childValue := value.Field(i)
-				fields = append(fields, fieldParse(key, sf, childValue.Kind(), childValue))
-			}
-		}
-		return fields
+		return structFieldsParse(key, value)
 	case reflect.Slice:
 		var fields []*Field
 		for i := 0; i < value.Len(); i++ {
@@ -14,7 +14,11 @@
 
 package gnomon
 
-import "testing"
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
 
 type User struct {
 	Name string `orm:"column:id" json:"name"`
@@ -73,3 +77,41 @@ func rangeFields(fields []*Field, t *testing.T) {
 		rangeFields(f.Fields, t)
 	}
 }
+
+type schemaBase struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"base_name"`
+	Extra string
+}
+
+type schemaAudit struct {
+	Creator string `json:"creator"`
+	Extra   string
+}
+
+type schemaEmbedded struct {
+	schemaBase
+	*schemaAudit
+	Name   string     `json:"name"`
+	Secret string     `json:"-"`
+	Inner  schemaBase `json:"inner"`
+}
+
+func TestParseEmbedded(t *testing.T) {
+	schema := SchemaParse("json", &schemaEmbedded{schemaBase: schemaBase{ID: 7}})
+	var names []string
+	for _, f := range schema.Fields {
+		names = append(names, f.Name+":"+f.Tag)
+	}
+	// Extra 在同一深度出现两次且均未设置标签名称，被忽略
+	expect := "Name:name,Secret:-,Inner:inner,ID:id,Name:base_name,Creator:creator"
+	if got := strings.Join(names, ","); got != expect {
+		t.Fatalf("expect fields %s, got %s", expect, got)
+	}
+	if schema.GetField("Name").Tag != "name" || schema.GetValue("ID").Int() != 7 {
+		t.Errorf("unexpected field map")
+	}
+	if creator := schema.Fields[5]; creator.Type.Kind() != reflect.String || creator.Value.String() != "" {
+		t.Errorf("unexpected field from nil embedded pointer %+v", creator)
+	}
+}